@@ -0,0 +1,321 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shruggr/inspiration/query"
+	"github.com/shruggr/inspiration/subscribe"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// Server exposes the query engine over HTTP.
+type Server struct {
+	engine *query.Engine
+	hub    *subscribe.Hub
+	logger *slog.Logger
+	mux    *http.ServeMux
+}
+
+// NewServer creates an HTTP query server backed by engine. Subscriptions are
+// served from hub if it is not nil.
+func NewServer(engine *query.Engine, hub *subscribe.Hub, logger *slog.Logger) *Server {
+	s := &Server{
+		engine: engine,
+		hub:    hub,
+		logger: logger,
+		mux:    http.NewServeMux(),
+	}
+	if hub != nil {
+		s.mux.HandleFunc("GET /v1/subscribe", s.handleSubscribe)
+	}
+	s.mux.HandleFunc("GET /v1/tags/{key}", s.handleTagScan)
+	s.mux.HandleFunc("GET /v1/tags/{key}/{value}", s.handleTagLookup)
+	s.mux.HandleFunc("GET /v1/query", s.handleQuery)
+	s.mux.HandleFunc("GET /v1/blocks/queued", s.handleQueuedBlocks)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+type resultJSON struct {
+	TxID            string   `json:"txid"`
+	BlockHash       string   `json:"blockHash"`
+	BlockHeight     uint32   `json:"blockHeight"`
+	SubtreeHash     string   `json:"subtreeHash"`
+	SubtreeIndex    uint32   `json:"subtreeIndex"`
+	SubtreePosition uint64   `json:"subtreePosition"`
+	Vouts           []uint32 `json:"vouts"`
+	Vins            []uint32 `json:"vins"`
+	Unconfirmed     bool     `json:"unconfirmed"`
+}
+
+type pageJSON struct {
+	Results    []resultJSON `json:"results"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+type valueJSON struct {
+	Value   string       `json:"value"`
+	Results []resultJSON `json:"results"`
+}
+
+type scanPageJSON struct {
+	Values    []valueJSON `json:"values"`
+	NextAfter string      `json:"nextAfter,omitempty"`
+}
+
+type queuedBlockJSON struct {
+	Hash            string   `json:"hash"`
+	Height          uint32   `json:"height"`
+	QueuedAt        int64    `json:"queuedAt"`
+	WaitingSeconds  int64    `json:"waitingSeconds"`
+	MissingSubtrees []string `json:"missingSubtrees"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handleTagLookup(w http.ResponseWriter, r *http.Request) {
+	req := query.Request{
+		Key:   r.PathValue("key"),
+		Value: r.PathValue("value"),
+	}
+
+	s.runLookup(w, r, req)
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	expr, err := query.ParseExpr(r.URL.Query().Get("q"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("q: %w", err))
+		return
+	}
+	s.runLookup(w, r, query.Request{Expr: expr})
+}
+
+// runLookup applies the shared height range, cursor and limit parameters to
+// req and writes one page of results.
+func (s *Server) runLookup(w http.ResponseWriter, r *http.Request, req query.Request) {
+	params := r.URL.Query()
+	var err error
+	if req.FromHeight, err = parseHeight(params.Get("fromHeight")); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("fromHeight: %w", err))
+		return
+	}
+	if req.ToHeight, err = parseHeight(params.Get("toHeight")); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("toHeight: %w", err))
+		return
+	}
+	if req.Scope, err = query.ParseScope(params.Get("scope")); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if c := params.Get("cursor"); c != "" {
+		cursor, err := query.ParseCursor(c)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		req.After = &cursor
+	}
+	limit, err := parseLimit(params.Get("limit"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("limit: %w", err))
+		return
+	}
+
+	page, err := s.engine.Lookup(r.Context(), req, limit)
+	if err != nil {
+		s.logger.Error("lookup", "query", describeRequest(req), "error", err)
+		s.writeError(w, http.StatusInternalServerError, fmt.Errorf("query failed"))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, newPageJSON(page))
+}
+
+// handleTagScan returns a page of results for the values of a tag key
+// matching a prefix or range, grouped by value.
+func (s *Server) handleTagScan(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	req := query.ScanRequest{
+		Key:    r.PathValue("key"),
+		Prefix: params.Get("prefix"),
+		Start:  params.Get("start"),
+		End:    params.Get("end"),
+	}
+	if req.Prefix != "" && (req.Start != "" || req.End != "") {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("prefix cannot be combined with start or end"))
+		return
+	}
+	var err error
+	if req.FromHeight, err = parseHeight(params.Get("fromHeight")); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("fromHeight: %w", err))
+		return
+	}
+	if req.ToHeight, err = parseHeight(params.Get("toHeight")); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("toHeight: %w", err))
+		return
+	}
+	limit, err := parseLimit(params.Get("limit"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("limit: %w", err))
+		return
+	}
+	if a := params.Get("after"); a != "" {
+		after, err := query.ParseScanCursor(a)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("after: %w", err))
+			return
+		}
+		req.After = &after
+	}
+
+	page, err := s.engine.Scan(r.Context(), req, limit)
+	if err != nil {
+		s.logger.Error("scan", "key", req.Key, "prefix", req.Prefix, "start", req.Start, "end", req.End, "error", err)
+		s.writeError(w, http.StatusInternalServerError, fmt.Errorf("query failed"))
+		return
+	}
+
+	out := scanPageJSON{Values: make([]valueJSON, len(page.Values))}
+	if page.Next != nil {
+		out.NextAfter = page.Next.String()
+	}
+	for i, v := range page.Values {
+		results := make([]resultJSON, len(v.Results))
+		for j, res := range v.Results {
+			results[j] = newResultJSON(res)
+		}
+		out.Values[i] = valueJSON{Value: v.Value, Results: results}
+	}
+	s.writeJSON(w, http.StatusOK, out)
+}
+
+// handleQueuedBlocks lists blocks waiting on subtrees, how long each has
+// waited and which subtrees it still needs.
+func (s *Server) handleQueuedBlocks(w http.ResponseWriter, r *http.Request) {
+	blocks, err := s.engine.QueuedBlocks(r.Context())
+	if err != nil {
+		s.logger.Error("queued blocks", "error", err)
+		s.writeError(w, http.StatusInternalServerError, fmt.Errorf("query failed"))
+		return
+	}
+
+	now := time.Now()
+	out := struct {
+		Blocks []queuedBlockJSON `json:"blocks"`
+	}{Blocks: make([]queuedBlockJSON, len(blocks))}
+	for i, b := range blocks {
+		missing := make([]string, len(b.Missing))
+		for j, h := range b.Missing {
+			missing[j] = hashToHex(h)
+		}
+		out.Blocks[i] = queuedBlockJSON{
+			Hash:            hashToHex(b.Hash),
+			Height:          b.Height,
+			QueuedAt:        b.QueuedAt.Unix(),
+			WaitingSeconds:  int64(now.Sub(b.QueuedAt).Seconds()),
+			MissingSubtrees: missing,
+		}
+	}
+	s.writeJSON(w, http.StatusOK, out)
+}
+
+func describeRequest(req query.Request) string {
+	if req.Expr != nil {
+		return req.Expr.String()
+	}
+	return query.Term{Key: req.Key, Value: req.Value}.String()
+}
+
+func newPageJSON(page *query.Page) pageJSON {
+	out := pageJSON{Results: make([]resultJSON, len(page.Results))}
+	for i, r := range page.Results {
+		out.Results[i] = newResultJSON(r)
+	}
+	if page.Next != nil {
+		out.NextCursor = page.Next.String()
+	}
+	return out
+}
+
+func newResultJSON(r query.Result) resultJSON {
+	vouts, vins := r.Vouts, r.Vins
+	if vouts == nil {
+		vouts = []uint32{}
+	}
+	if vins == nil {
+		vins = []uint32{}
+	}
+	return resultJSON{
+		TxID:            hashToHex(r.TxID),
+		BlockHash:       hashToHex(r.BlockHash),
+		BlockHeight:     r.BlockHeight,
+		SubtreeHash:     hashToHex(r.SubtreeHash),
+		SubtreeIndex:    r.SubtreeIndex,
+		SubtreePosition: r.SubtreePosition,
+		Vouts:           vouts,
+		Vins:            vins,
+		Unconfirmed:     r.Unconfirmed,
+	}
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warn("write response", "error", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, errorJSON{Error: err.Error()})
+}
+
+func parseHeight(s string) (uint32, error) {
+	if s == "" {
+		return 0, nil
+	}
+	h, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(h), nil
+}
+
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 || limit > maxLimit {
+		return 0, fmt.Errorf("must be between 1 and %d", maxLimit)
+	}
+	return limit, nil
+}
+
+// hashToHex renders a hash in Bitcoin display order (byte-reversed).
+func hashToHex(h []byte) string {
+	reversed := make([]byte, len(h))
+	for i, b := range h {
+		reversed[len(h)-1-i] = b
+	}
+	return hex.EncodeToString(reversed)
+}
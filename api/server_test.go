@@ -0,0 +1,263 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	kvmem "github.com/shruggr/inspiration/kvstore/memory"
+	"github.com/shruggr/inspiration/metadata"
+	metasqlite "github.com/shruggr/inspiration/metadata/sqlite"
+	"github.com/shruggr/inspiration/query"
+	"github.com/shruggr/inspiration/treebuilder"
+	"github.com/shruggr/inspiration/treereader"
+)
+
+const addr1 = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+
+// newTestServer indexes one subtree per block at heights 100, 101, ...
+// each containing a single transaction paying addr1 on vout 0.
+func newTestServer(t *testing.T, blocks int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(NewServer(newTestEngine(t, blocks), nil, slog.Default()))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestEngine builds the index served by newTestServer.
+func newTestEngine(t *testing.T, blocks int) *query.Engine {
+	t.Helper()
+	ctx := context.Background()
+
+	kv := kvmem.New()
+	meta, err := metasqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("create metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+
+	builder := treebuilder.NewBuilder(kv)
+	for i := 0; i < blocks; i++ {
+		root, err := builder.BuildSubtreeIndex(ctx, []treebuilder.TaggedTransaction{{
+			TxID: [32]byte{byte(i + 1)},
+			Tags: []treebuilder.Tag{{Key: "address", Value: addr1, Vouts: []uint32{0}}},
+		}})
+		if err != nil {
+			t.Fatalf("BuildSubtreeIndex: %v", err)
+		}
+		subtreeHash := bytes.Repeat([]byte{byte(i + 1)}, 32)
+		if err := meta.InsertSubtree(ctx, subtreeHash, root.Bytes(), 1); err != nil {
+			t.Fatalf("InsertSubtree: %v", err)
+		}
+		blockHash := bytes.Repeat([]byte{byte(0x80 + i)}, 32)
+		if err := meta.InsertBlock(ctx, uint32(100+i), blockHash, make([]byte, 80), 1, [][]byte{subtreeHash}); err != nil {
+			t.Fatalf("InsertBlock: %v", err)
+		}
+		if err := meta.PromoteBlock(ctx, blockHash); err != nil {
+			t.Fatalf("PromoteBlock: %v", err)
+		}
+	}
+
+	return query.NewEngine(meta, treereader.NewReader(kv))
+}
+
+func getPage(t *testing.T, target string) (int, pageJSON) {
+	t.Helper()
+	resp, err := http.Get(target)
+	if err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	defer resp.Body.Close()
+
+	var page pageJSON
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return resp.StatusCode, page
+}
+
+func TestTagLookup(t *testing.T) {
+	srv := newTestServer(t, 3)
+
+	status, page := getPage(t, srv.URL+"/v1/tags/address/"+addr1+"?fromHeight=101")
+	if status != http.StatusOK {
+		t.Fatalf("status: got %d, want 200", status)
+	}
+	if len(page.Results) != 2 {
+		t.Fatalf("results: got %d, want 2", len(page.Results))
+	}
+
+	r := page.Results[0]
+	if r.BlockHeight != 101 {
+		t.Errorf("blockHeight: got %d, want 101", r.BlockHeight)
+	}
+	// txid {0x02, 0x00, ...} in display order ends with "02"
+	if r.TxID[len(r.TxID)-2:] != "02" {
+		t.Errorf("txid: got %s", r.TxID)
+	}
+	if len(r.Vouts) != 1 || r.Vouts[0] != 0 {
+		t.Errorf("vouts: got %v, want [0]", r.Vouts)
+	}
+	if page.NextCursor != "" {
+		t.Errorf("expected no next cursor, got %q", page.NextCursor)
+	}
+}
+
+func TestTagLookupPagination(t *testing.T) {
+	srv := newTestServer(t, 3)
+
+	status, page := getPage(t, srv.URL+"/v1/tags/address/"+addr1+"?limit=2")
+	if status != http.StatusOK {
+		t.Fatalf("status: got %d, want 200", status)
+	}
+	if len(page.Results) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page: got %d results, cursor %q", len(page.Results), page.NextCursor)
+	}
+
+	status, page = getPage(t, srv.URL+"/v1/tags/address/"+addr1+"?limit=2&cursor="+page.NextCursor)
+	if status != http.StatusOK {
+		t.Fatalf("status: got %d, want 200", status)
+	}
+	if len(page.Results) != 1 || page.Results[0].BlockHeight != 102 {
+		t.Fatalf("second page: got %d results", len(page.Results))
+	}
+	if page.NextCursor != "" {
+		t.Errorf("expected no next cursor on last page, got %q", page.NextCursor)
+	}
+}
+
+func TestTagLookupMempoolScope(t *testing.T) {
+	srv := newTestServer(t, 2)
+
+	// Every subtree is mined, so the mempool has nothing and "all" matches blocks
+	if status, page := getPage(t, srv.URL+"/v1/tags/address/"+addr1+"?scope=mempool"); status != http.StatusOK || len(page.Results) != 0 {
+		t.Errorf("mempool: status %d, %d results", status, len(page.Results))
+	}
+	status, page := getPage(t, srv.URL+"/v1/tags/address/"+addr1+"?scope=all")
+	if status != http.StatusOK || len(page.Results) != 2 || page.Results[0].Unconfirmed {
+		t.Errorf("all: status %d, results %+v", status, page.Results)
+	}
+}
+
+func TestTagLookupNoMatches(t *testing.T) {
+	srv := newTestServer(t, 1)
+
+	status, page := getPage(t, srv.URL+"/v1/tags/address/1Unknown")
+	if status != http.StatusOK {
+		t.Fatalf("status: got %d, want 200", status)
+	}
+	if page.Results == nil || len(page.Results) != 0 {
+		t.Errorf("expected empty results array, got %v", page.Results)
+	}
+}
+
+func TestTagLookupBadParams(t *testing.T) {
+	srv := newTestServer(t, 1)
+
+	for _, q := range []string{"?fromHeight=abc", "?limit=0", "?limit=5000", "?cursor=bogus", "?scope=pending"} {
+		status, _ := getPage(t, srv.URL+"/v1/tags/address/"+addr1+q)
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: status got %d, want 400", q, status)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	srv := newTestServer(t, 2)
+
+	q := url.QueryEscape("address=" + addr1 + " AND NOT address=1Unknown")
+	status, page := getPage(t, srv.URL+"/v1/query?fromHeight=101&q="+q)
+	if status != http.StatusOK {
+		t.Fatalf("status: got %d, want 200", status)
+	}
+	if len(page.Results) != 1 || page.Results[0].BlockHeight != 101 {
+		t.Fatalf("results: got %d", len(page.Results))
+	}
+
+	for _, bad := range []string{"", "NOT+address%3DX", "address%3DX+AND"} {
+		status, _ := getPage(t, srv.URL+"/v1/query?q="+bad)
+		if status != http.StatusBadRequest {
+			t.Errorf("q=%s: status got %d, want 400", bad, status)
+		}
+	}
+}
+
+func TestTagScan(t *testing.T) {
+	srv := newTestServer(t, 2)
+
+	resp, err := http.Get(srv.URL + "/v1/tags/address?prefix=1A")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status: got %d, want 200", resp.StatusCode)
+	}
+	var page scanPageJSON
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(page.Values) != 1 || page.Values[0].Value != addr1 {
+		t.Fatalf("values: got %+v", page.Values)
+	}
+	if len(page.Values[0].Results) != 2 || page.Values[0].Results[1].BlockHeight != 101 {
+		t.Errorf("results: got %+v", page.Values[0].Results)
+	}
+
+	for _, q := range []string{"?prefix=1&start=1", "?limit=0", "?toHeight=x", "?after=1A"} {
+		status, _ := getPage(t, srv.URL+"/v1/tags/address"+q)
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: status got %d, want 400", q, status)
+		}
+	}
+}
+
+func TestQueuedBlocks(t *testing.T) {
+	ctx := context.Background()
+	meta, err := metasqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("create metadata store: %v", err)
+	}
+	defer meta.Close()
+
+	present := bytes.Repeat([]byte{0x01}, 32)
+	missing := bytes.Repeat([]byte{0x02}, 32)
+	meta.InsertSubtree(ctx, present, []byte("root"), 1)
+	err = meta.QueueBlock(ctx, metadata.QueuedBlock{
+		Height:        100,
+		Hash:          bytes.Repeat([]byte{0x80}, 32),
+		Header:        make([]byte, 80),
+		SubtreeHashes: [][]byte{present, missing},
+	})
+	if err != nil {
+		t.Fatalf("QueueBlock: %v", err)
+	}
+
+	srv := httptest.NewServer(NewServer(query.NewEngine(meta, treereader.NewReader(kvmem.New())), nil, slog.Default()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/blocks/queued")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Blocks []queuedBlockJSON `json:"blocks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(out.Blocks) != 1 || out.Blocks[0].Height != 100 || out.Blocks[0].QueuedAt == 0 {
+		t.Fatalf("blocks: got %+v", out.Blocks)
+	}
+	if got := out.Blocks[0].MissingSubtrees; len(got) != 1 || got[0] != hashToHex(missing) {
+		t.Errorf("missing subtrees: got %v", got)
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shruggr/inspiration/query"
+)
+
+// keepaliveInterval is how often an idle event stream sends a comment so
+// proxies do not time it out.
+const keepaliveInterval = 15 * time.Second
+
+type eventJSON struct {
+	Type   string     `json:"type"`
+	Cursor string     `json:"cursor"`
+	Result resultJSON `json:"result"`
+}
+
+// handleSubscribe streams matches for a filter as server-sent events. The
+// filter is a q= expression, or tag=key=value parameters matched as
+// alternatives. Each event's id is its resume cursor, so a reconnecting
+// EventSource resumes through Last-Event-ID; cursor= does the same for
+// other clients.
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	expr, err := subscriptionFilter(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c := r.Header.Get("Last-Event-ID")
+	if c == "" {
+		c = r.URL.Query().Get("cursor")
+	}
+	var after *query.Cursor
+	if c != "" {
+		cursor, err := query.ParseCursor(c)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		after = &cursor
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	sub, err := s.hub.Subscribe(r.Context(), expr, after)
+	if err != nil {
+		s.logger.Error("subscribe", "filter", expr.String(), "error", err)
+		s.writeError(w, http.StatusInternalServerError, fmt.Errorf("subscribe failed"))
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				if err := sub.Err(); err != nil {
+					data, _ := json.Marshal(errorJSON{Error: err.Error()})
+					fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+					flusher.Flush()
+				}
+				return
+			}
+			data, err := json.Marshal(eventJSON{
+				Type:   ev.Type,
+				Cursor: ev.Cursor.String(),
+				Result: newResultJSON(ev.Result),
+			})
+			if err != nil {
+				s.logger.Warn("encode event", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.Cursor, ev.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// subscriptionFilter builds the filter from q= or from tag=key=value
+// parameters, which are ORed.
+func subscriptionFilter(r *http.Request) (query.Expr, error) {
+	params := r.URL.Query()
+	q, tags := params.Get("q"), params["tag"]
+	if q != "" && len(tags) > 0 {
+		return nil, fmt.Errorf("q cannot be combined with tag")
+	}
+	if q != "" {
+		expr, err := query.ParseExpr(q)
+		if err != nil {
+			return nil, fmt.Errorf("q: %w", err)
+		}
+		return expr, nil
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("q or tag is required")
+	}
+
+	var or query.Or
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("tag %q must be key=value", tag)
+		}
+		or = append(or, query.Term{Key: key, Value: value})
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
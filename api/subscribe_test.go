@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shruggr/inspiration/subscribe"
+)
+
+func TestSubscribe(t *testing.T) {
+	engine := newTestEngine(t, 3)
+	hub := subscribe.NewHub(engine, subscribe.DefaultConfig(), slog.Default())
+	srv := httptest.NewServer(NewServer(engine, hub, slog.Default()))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/v1/subscribe?tag=address="+addr1, nil)
+	req.Header.Set("Last-Event-ID", "100:0:0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type: %q", ct)
+	}
+
+	// Matches after the cursor are replayed as confirmed events
+	scanner := bufio.NewScanner(resp.Body)
+	for _, height := range []uint32{101, 102} {
+		var id, event string
+		var ev eventJSON
+		for scanner.Scan() && scanner.Text() != "" {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				id = value
+			case "event":
+				event = value
+			case "data":
+				if err := json.Unmarshal([]byte(value), &ev); err != nil {
+					t.Fatalf("decode event: %v", err)
+				}
+			}
+		}
+		if event != subscribe.EventConfirmed || ev.Result.BlockHeight != height || id != ev.Cursor {
+			t.Fatalf("event at %d: id %q, event %q, %+v", height, id, event, ev)
+		}
+	}
+}
+
+func TestSubscribeBadParams(t *testing.T) {
+	engine := newTestEngine(t, 1)
+	hub := subscribe.NewHub(engine, subscribe.DefaultConfig(), slog.Default())
+	srv := httptest.NewServer(NewServer(engine, hub, slog.Default()))
+	defer srv.Close()
+
+	for _, q := range []string{"", "?tag=address", "?q=address=a&tag=address=b", "?q=NOT+address=a", "?tag=address=a&cursor=bogus"} {
+		status, _ := getPage(t, srv.URL+"/v1/subscribe"+q)
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: status got %d, want 400", q, status)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Package backfill indexes a range of historical blocks fetched from
+// Teranode's HTTP API, alongside or instead of live Kafka consumption.
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/shruggr/inspiration/metadata"
+	"github.com/shruggr/inspiration/teranode"
+)
+
+// Source serves historical blocks; *teranode.Client implements it.
+type Source interface {
+	FetchBlockInfos(ctx context.Context, fromHeight, toHeight uint32) ([]teranode.BlockInfo, error)
+	FetchBlock(ctx context.Context, blockHashHex string) (*teranode.Block, error)
+	SubtreeURL(subtreeHashHex string) string
+}
+
+// Indexer indexes subtrees and blocks; *processor.Processor implements it.
+type Indexer interface {
+	ProcessSubtree(ctx context.Context, subtreeHash string, fetchURL string) error
+	ProcessBlock(ctx context.Context, height uint32, header []byte, coinbaseTx []byte, subtreeHashes [][]byte, txCount uint64) error
+}
+
+// Config selects the blocks to backfill.
+type Config struct {
+	FromHeight uint32
+	ToHeight   uint32
+	// BatchSize is the number of block hashes resolved per request.
+	BatchSize uint32
+}
+
+// DefaultConfig resolves block hashes 100 at a time; the height range must
+// still be set.
+func DefaultConfig() Config {
+	return Config{BatchSize: 100}
+}
+
+// Backfiller indexes every block from FromHeight to ToHeight in order,
+// recording the last completed height in the metadata store so an
+// interrupted run resumes where it stopped.
+type Backfiller struct {
+	source   Source
+	indexer  Indexer
+	metadata metadata.Store
+	config   Config
+	logger   *slog.Logger
+}
+
+func NewBackfiller(source Source, indexer Indexer, metadata metadata.Store, config Config, logger *slog.Logger) *Backfiller {
+	if config.BatchSize == 0 {
+		config.BatchSize = DefaultConfig().BatchSize
+	}
+	return &Backfiller{
+		source:   source,
+		indexer:  indexer,
+		metadata: metadata,
+		config:   config,
+		logger:   logger,
+	}
+}
+
+// CheckpointName is the metadata checkpoint a backfill of the range records
+// its progress under. Runs over different ranges resume independently.
+func CheckpointName(fromHeight, toHeight uint32) string {
+	return fmt.Sprintf("backfill/%d-%d", fromHeight, toHeight)
+}
+
+// Run backfills the configured range, starting after the last checkpointed
+// height, and returns once ToHeight is indexed or ctx is cancelled.
+func (b *Backfiller) Run(ctx context.Context) error {
+	from, to := b.config.FromHeight, b.config.ToHeight
+	if to < from {
+		return fmt.Errorf("backfill range %d-%d is empty", from, to)
+	}
+	checkpoint := CheckpointName(from, to)
+
+	done, ok, err := b.metadata.GetCheckpoint(ctx, checkpoint)
+	if err != nil {
+		return fmt.Errorf("get checkpoint: %w", err)
+	}
+	next := from
+	if ok {
+		if done >= to {
+			b.logger.Info("backfill already complete", "from", from, "to", to)
+			return nil
+		}
+		next = done + 1
+		b.logger.Info("resuming backfill", "from", next, "to", to)
+	} else {
+		b.logger.Info("starting backfill", "from", from, "to", to)
+	}
+
+	for next <= to {
+		last := min(next+b.config.BatchSize-1, to)
+		infos, err := b.source.FetchBlockInfos(ctx, next, last)
+		if err != nil {
+			return fmt.Errorf("resolve heights %d-%d: %w", next, last, err)
+		}
+		if len(infos) != int(last-next+1) || infos[0].Height != next {
+			return fmt.Errorf("resolve heights %d-%d: got %d blocks; the chain tip may have moved", next, last, len(infos))
+		}
+
+		for _, info := range infos {
+			if err := b.backfillBlock(ctx, info); err != nil {
+				return err
+			}
+			if err := b.metadata.SetCheckpoint(ctx, checkpoint, info.Height); err != nil {
+				return fmt.Errorf("set checkpoint: %w", err)
+			}
+		}
+		b.logger.Info("backfilled blocks", "through", last, "to", to)
+		next = last + 1
+	}
+	return nil
+}
+
+// backfillBlock indexes the block's subtrees that are not already indexed,
+// then the block itself.
+func (b *Backfiller) backfillBlock(ctx context.Context, info teranode.BlockInfo) error {
+	block, err := b.source.FetchBlock(ctx, info.Hash)
+	if err != nil {
+		return err
+	}
+	if block.Height != info.Height {
+		return fmt.Errorf("block %s: height %d, expected %d", info.Hash, block.Height, info.Height)
+	}
+
+	for _, st := range block.Subtrees {
+		exists, err := b.metadata.SubtreeExists(ctx, st)
+		if err != nil {
+			return fmt.Errorf("check subtree: %w", err)
+		}
+		if exists {
+			continue
+		}
+		hashHex := teranode.TxIDToHex(st)
+		if err := b.indexer.ProcessSubtree(ctx, hashHex, b.source.SubtreeURL(hashHex)); err != nil {
+			return fmt.Errorf("block %d: %w", info.Height, err)
+		}
+	}
+
+	if err := b.indexer.ProcessBlock(ctx, block.Height, block.Header, block.CoinbaseTx, block.Subtrees, block.TxCount); err != nil {
+		return fmt.Errorf("block %d: %w", info.Height, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	metasqlite "github.com/shruggr/inspiration/metadata/sqlite"
+	"github.com/shruggr/inspiration/teranode"
+)
+
+// fakeChain serves blocks with one subtree each, numbered by height.
+type fakeChain struct {
+	tip       uint32
+	failAt    uint32 // height whose block cannot be fetched; 0 for none
+	meta      *metasqlite.SQLiteStore
+	subtrees  []string
+	processed []uint32
+}
+
+func subtreeHash(height uint32) []byte {
+	h := make([]byte, 32)
+	h[0], h[1] = byte(height), byte(height>>8)
+	return h
+}
+
+func (f *fakeChain) FetchBlockInfos(_ context.Context, from, to uint32) ([]teranode.BlockInfo, error) {
+	var infos []teranode.BlockInfo
+	for h := from; h <= to && h <= f.tip; h++ {
+		infos = append(infos, teranode.BlockInfo{Height: h, Hash: fmt.Sprint(h)})
+	}
+	return infos, nil
+}
+
+func (f *fakeChain) FetchBlock(_ context.Context, hash string) (*teranode.Block, error) {
+	var height uint32
+	fmt.Sscan(hash, &height)
+	if height == f.failAt {
+		return nil, teranode.ErrBlockNotFound
+	}
+	return &teranode.Block{
+		Header:   []byte(hash),
+		Height:   height,
+		TxCount:  1,
+		Subtrees: [][]byte{subtreeHash(height)},
+	}, nil
+}
+
+func (f *fakeChain) SubtreeURL(hash string) string { return "http://teranode/" + hash }
+
+func (f *fakeChain) ProcessSubtree(ctx context.Context, hash, url string) error {
+	f.subtrees = append(f.subtrees, hash)
+	return nil
+}
+
+func (f *fakeChain) ProcessBlock(ctx context.Context, height uint32, header, coinbaseTx []byte, subtreeHashes [][]byte, txCount uint64) error {
+	for _, st := range subtreeHashes {
+		if err := f.meta.InsertSubtree(ctx, st, []byte{1}, 1); err != nil {
+			return err
+		}
+	}
+	f.processed = append(f.processed, height)
+	return nil
+}
+
+func newTestChain(t *testing.T, tip uint32) *fakeChain {
+	t.Helper()
+	meta, err := metasqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("create metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	return &fakeChain{tip: tip, meta: meta}
+}
+
+func TestBackfillResumes(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(t, 200)
+	chain.failAt = 105
+	config := Config{FromHeight: 100, ToHeight: 110, BatchSize: 4}
+
+	err := NewBackfiller(chain, chain, chain.meta, config, slog.Default()).Run(ctx)
+	if !errors.Is(err, teranode.ErrBlockNotFound) {
+		t.Fatalf("expected the failed fetch to stop the run, got %v", err)
+	}
+	if len(chain.processed) != 5 || chain.processed[4] != 104 {
+		t.Fatalf("processed before failure: %v", chain.processed)
+	}
+	done, ok, _ := chain.meta.GetCheckpoint(ctx, CheckpointName(100, 110))
+	if !ok || done != 104 {
+		t.Fatalf("checkpoint: got %d ok=%v, want 104", done, ok)
+	}
+
+	chain.failAt = 0
+	chain.processed = nil
+	if err := NewBackfiller(chain, chain, chain.meta, config, slog.Default()).Run(ctx); err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+	want := []uint32{105, 106, 107, 108, 109, 110}
+	if fmt.Sprint(chain.processed) != fmt.Sprint(want) {
+		t.Errorf("resumed run processed %v, want %v", chain.processed, want)
+	}
+
+	// A completed range is not redone
+	chain.processed = nil
+	if err := NewBackfiller(chain, chain, chain.meta, config, slog.Default()).Run(ctx); err != nil || len(chain.processed) != 0 {
+		t.Errorf("rerun of complete range: err %v, processed %v", err, chain.processed)
+	}
+}
+
+func TestBackfillSkipsIndexedSubtrees(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(t, 200)
+
+	// Live consumption already indexed the subtree of block 101
+	chain.meta.InsertSubtree(ctx, subtreeHash(101), []byte{1}, 1)
+
+	config := Config{FromHeight: 100, ToHeight: 102}
+	if err := NewBackfiller(chain, chain, chain.meta, config, slog.Default()).Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(chain.subtrees) != 2 {
+		t.Errorf("processed subtrees %v, want those of 100 and 102 only", chain.subtrees)
+	}
+	if len(chain.processed) != 3 {
+		t.Errorf("processed blocks %v, want all three", chain.processed)
+	}
+}
+
+func TestBackfillBeyondTip(t *testing.T) {
+	chain := newTestChain(t, 101)
+	config := Config{FromHeight: 100, ToHeight: 103}
+	if err := NewBackfiller(chain, chain, chain.meta, config, slog.Default()).Run(context.Background()); err == nil {
+		t.Fatal("expected an error for heights above the tip")
+	}
+	if len(chain.processed) != 0 {
+		t.Errorf("processed %v from a short batch", chain.processed)
+	}
+}
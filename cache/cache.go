@@ -8,6 +8,7 @@ type IndexTerm struct {
 	Key   string
 	Value string
 	Vouts []uint32
+	Vins  []uint32
 }
 
 // IndexTermCache provides fast access to previously parsed transaction index terms
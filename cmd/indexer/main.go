@@ -2,33 +2,100 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/shruggr/inspiration/api"
+	"github.com/shruggr/inspiration/backfill"
 	"github.com/shruggr/inspiration/cache/memory"
+	"github.com/shruggr/inspiration/gc"
+	"github.com/shruggr/inspiration/grpcapi"
+	"github.com/shruggr/inspiration/grpcapi/pb"
 	"github.com/shruggr/inspiration/kafka"
 	"github.com/shruggr/inspiration/kvstore/badger"
 	metasqlite "github.com/shruggr/inspiration/metadata/sqlite"
 	"github.com/shruggr/inspiration/processor"
+	"github.com/shruggr/inspiration/promoter"
+	"github.com/shruggr/inspiration/query"
 	"github.com/shruggr/inspiration/store"
+	"github.com/shruggr/inspiration/subscribe"
 	"github.com/shruggr/inspiration/teranode"
 	"github.com/shruggr/inspiration/treebuilder"
+	"github.com/shruggr/inspiration/treereader"
 	"github.com/shruggr/inspiration/txindexer"
+	"google.golang.org/grpc"
 )
 
 func main() {
 	kafkaBrokers := flag.String("kafka-brokers", "localhost:9092", "Comma-separated Kafka broker addresses")
 	kafkaGroupID := flag.String("kafka-group", "junglebus-indexer", "Kafka consumer group ID")
-	teranodeURL := flag.String("teranode-url", "http://localhost:8080", "Teranode HTTP API base URL")
+	teranodeURL := flag.String("teranode-url", "http://localhost:8080", "Comma-separated Teranode HTTP API base URLs, failed over in order")
+	teranodeRetries := flag.Int("teranode-retries", teranode.DefaultConfig().MaxRetries, "Retries for failed Teranode requests, with exponential backoff")
 	dataDir := flag.String("data-dir", "./data", "Base data directory")
 	cacheSize := flag.Int("cache-size", 100000, "LRU cache size for parsed transactions")
 	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn, error")
-	flag.Parse()
+	httpAddr := flag.String("http-addr", ":8081", "Query API listen address (empty to disable)")
+	grpcAddr := flag.String("grpc-addr", ":8082", "gRPC IndexQuery listen address (empty to disable)")
+	confirmations := flag.Uint("confirmations", uint(promoter.DefaultConfig().ConfirmationDepth), "Blocks required on top of a block before it is promoted to persistent storage")
+	promoteInterval := flag.Duration("promote-interval", promoter.DefaultConfig().Interval, "How often to check for blocks ready to promote")
+	gcRetention := flag.Duration("gc-retention", gc.DefaultConfig().Retention, "How long unmined or orphaned subtrees are kept before their index is garbage collected")
+	gcInterval := flag.Duration("gc-interval", gc.DefaultConfig().Interval, "How often to garbage collect the working store")
+	powLimit := flag.Uint("pow-limit", uint(processor.DefaultConfig().PowLimit), "Compact target of the easiest proof of work accepted in block headers (0 to accept any)")
+	txConcurrency := flag.Int("tx-concurrency", processor.DefaultConfig().Concurrency, "Transactions of a subtree fetched and indexed in parallel")
+	maxInFlight := flag.Int("max-inflight", processor.DefaultConfig().MaxInFlight, "Maximum concurrent subtree-level and, separately, single transaction fetches from Teranode (0 for no cap)")
+	txTimeout := flag.Duration("tx-timeout", processor.DefaultConfig().TxTimeout, "Timeout for fetching and indexing a single transaction (0 to disable)")
+	txBatchSize := flag.Int("tx-batch-size", processor.DefaultConfig().BatchSize, "Transactions per batch fetch when a subtree's data cannot be streamed (0 to fetch each transaction individually)")
+	prewarmRate := flag.Int("prewarm-rate", processor.DefaultConfig().PrewarmRate, "Maximum transactions fetched per second ahead of their subtree from -consume-txmeta (0 for no cap)")
+	skipMissingTxs := flag.Bool("skip-missing-txs", false, "Index subtrees without transactions Teranode reports as not found instead of failing them")
+	maxAttempts := flag.Int("max-attempts", kafka.DefaultConfig().MaxAttempts, "Attempts at handling a Kafka message before it is dead-lettered")
+	retryBackoff := flag.Duration("retry-backoff", kafka.DefaultConfig().RetryBackoff, "Delay before retrying a failed Kafka message, doubling per attempt")
+	dlqTopic := flag.String("dlq-topic", "", "Kafka topic for dead-lettered messages (empty to keep them under <data-dir>/dlq)")
+	consumeBlocks := flag.Bool("consume-blocks", false, "Consume Teranode's blocks topic to warn of reorgs before blocks are final")
+	consumeTxMeta := flag.Bool("consume-txmeta", false, "Consume Teranode's txmeta topic to index transactions before their subtrees arrive")
+	consumeRejectedTx := flag.Bool("consume-rejected-tx", false, "Consume Teranode's rejected-tx topic to evict cached terms for rejected transactions")
+	subscribeBuffer := flag.Int("subscribe-buffer", subscribe.DefaultConfig().Buffer, "Pending notifications held per subscriber before it is dropped as too slow")
+	indexers := flag.String("indexers", "p2pkh", "Comma-separated indexers to run: p2pkh, spend, scripthash, opreturn, inscription, bsv21, bitcom")
+	opReturnKeys := flag.String("opreturn-keys", "", "Comma-separated tag keys for the pushes after an OP_RETURN output's protocol prefix; leave a key empty to skip its push")
+	opReturnMaxValue := flag.Int("opreturn-max-value", txindexer.DefaultOpReturnConfig().MaxValueLen, "Longest OP_RETURN value indexed as is; longer values are indexed by their SHA-256 (0 to never hash)")
+	scriptTemplates := flag.Bool("scripthash-templates", txindexer.DefaultScriptHashConfig().Templates, "Also tag outputs with the hash of their locking script's template, with pushes masked")
+	rulesFile := flag.String("rules", "", "YAML or JSON file of declarative indexing rules, run alongside -indexers")
+	mapKeys := flag.String("map-keys", strings.Join(txindexer.DefaultBitcomConfig().MapKeys, ","), "Comma-separated MAP SET keys the bitcom indexer tags as map.<key>")
+	inscriptionInputWait := flag.Duration("inscription-input-wait", txindexer.DefaultInscriptionConfig().InputWait, "How long a transfer waits for an inscribed input's parent to be indexed before leaving its origin unknown")
+	bsv21InputWait := flag.Duration("bsv21-input-wait", txindexer.DefaultBSV21Config().InputWait, "How long a BSV-21 transfer waits for a token input's parent to be indexed before leaving its validity unknown")
+	fromHeight := flag.Uint("from-height", 0, "First block height to backfill (backfill command)")
+	toHeight := flag.Uint("to-height", 0, "Last block height to backfill (backfill command)")
+	backfillLive := flag.Bool("live", true, "Consume Kafka while backfilling; otherwise exit once the range is indexed (backfill command)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [replay-dlq|backfill] [flags]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "replay-dlq handles dead-lettered Kafka messages again and exits; run it while the indexer is stopped.")
+		fmt.Fprintln(flag.CommandLine.Output(), "backfill indexes blocks -from-height to -to-height from Teranode, resuming an interrupted run of the same range.")
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+	}
+
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	switch {
+	case command != "run" && command != "replay-dlq" && command != "backfill":
+		flag.Usage()
+		os.Exit(2)
+	case command == "backfill" && *toHeight < *fromHeight:
+		fmt.Fprintln(flag.CommandLine.Output(), "-to-height must not be below -from-height")
+		os.Exit(2)
+	}
 
 	var level slog.Level
 	switch *logLevel {
@@ -74,16 +141,130 @@ func main() {
 		log.Fatalf("cache: %v", err)
 	}
 
-	idx := txindexer.NewMultiIndexer(txindexer.NewP2PKHIndexer())
+	idx := txindexer.NewMultiIndexer()
+	for _, name := range strings.Split(*indexers, ",") {
+		switch strings.TrimSpace(name) {
+		case "p2pkh":
+			idx.AddIndexer(txindexer.NewP2PKHIndexer())
+		case "spend":
+			idx.AddIndexer(txindexer.NewSpendAddressIndexer())
+		case "scripthash":
+			config := txindexer.DefaultScriptHashConfig()
+			config.Templates = *scriptTemplates
+			idx.AddIndexer(txindexer.NewScriptHashIndexer(config))
+		case "opreturn":
+			config := txindexer.DefaultOpReturnConfig()
+			if *opReturnKeys != "" {
+				config.Keys = strings.Split(*opReturnKeys, ",")
+			}
+			config.MaxValueLen = *opReturnMaxValue
+			idx.AddIndexer(txindexer.NewOpReturnIndexer(config))
+		case "inscription":
+			config := txindexer.DefaultInscriptionConfig()
+			config.InputWait = *inscriptionInputWait
+			idx.AddIndexer(txindexer.NewInscriptionIndexer(spendStore, config))
+		case "bsv21":
+			config := txindexer.DefaultBSV21Config()
+			config.InputWait = *bsv21InputWait
+			idx.AddIndexer(txindexer.NewBSV21Indexer(spendStore, config))
+		case "bitcom":
+			config := txindexer.DefaultBitcomConfig()
+			config.MapKeys = strings.Split(*mapKeys, ",")
+			idx.AddIndexer(txindexer.NewBitcomIndexer(config))
+		default:
+			log.Fatalf("unknown indexer %q", name)
+		}
+	}
+	if *rulesFile != "" {
+		rulesConfig, err := txindexer.LoadRulesConfig(*rulesFile)
+		if err != nil {
+			log.Fatalf("rules: %v", err)
+		}
+		rules, err := txindexer.NewRuleIndexer(rulesConfig)
+		if err != nil {
+			log.Fatalf("rules: %v", err)
+		}
+		idx.AddIndexer(rules)
+	}
 
-	builder := treebuilder.NewBuilder(dualStore)
+	builder := treebuilder.NewBuilderWithConfig(dualStore, treebuilder.Config{DigestKeys: idx.DigestKeys()})
 
-	client := teranode.NewClient(*teranodeURL)
+	teranodeConfig := teranode.DefaultConfig()
+	teranodeConfig.BaseURLs = strings.Split(*teranodeURL, ",")
+	teranodeConfig.MaxRetries = *teranodeRetries
+	client := teranode.NewClientWithConfig(teranodeConfig)
 
-	proc := processor.NewProcessor(dualStore, spendStore, txCache, idx, client, builder, metaStore, logger)
+	proc := processor.NewProcessor(dualStore, spendStore, txCache, idx, client, builder, metaStore, processor.Config{
+		PowLimit:       uint32(*powLimit),
+		Concurrency:    *txConcurrency,
+		MaxInFlight:    *maxInFlight,
+		TxTimeout:      *txTimeout,
+		BatchSize:      *txBatchSize,
+		SkipMissingTxs: *skipMissingTxs,
+		PrewarmRate:    *prewarmRate,
+	}, logger)
+
+	// Blocks waiting on subtrees or their parent are queued in the metadata
+	// store and retried as those arrive, so the message can be committed.
+	handleBlock := func(ctx context.Context, height uint32, header, coinbaseTx []byte, subtreeHashes [][]byte, txCount uint64) error {
+		err := proc.ProcessBlock(ctx, height, header, coinbaseTx, subtreeHashes, txCount)
+		if errors.Is(err, processor.ErrSubtreeNotReady) {
+			logger.Info("block queued until its subtrees are indexed", "height", height)
+			return nil
+		}
+		if errors.Is(err, processor.ErrParentNotReady) {
+			logger.Info("block queued until its parent is processed", "height", height)
+			return nil
+		}
+		if errors.Is(err, processor.ErrInvalidBlock) {
+			return fmt.Errorf("%w: %w", kafka.ErrPermanent, err)
+		}
+		return err
+	}
 
 	brokers := strings.Split(*kafkaBrokers, ",")
-	consumer := kafka.NewConsumer(brokers, *kafkaGroupID, proc.ProcessSubtree, proc.ProcessBlock, logger)
+	var dlq kafka.DeadLetterQueue
+	if *dlqTopic != "" {
+		dlq = kafka.NewTopicQueue(brokers, *dlqTopic, *kafkaGroupID+"-dlq-replay")
+	} else {
+		dlq, err = kafka.NewFileQueue(*dataDir + "/dlq")
+		if err != nil {
+			log.Fatalf("dead-letter queue: %v", err)
+		}
+	}
+	defer dlq.Close()
+
+	consumer := kafka.NewConsumer(brokers, *kafkaGroupID, proc.ProcessSubtree, handleBlock, kafka.Config{
+		MaxAttempts:  *maxAttempts,
+		RetryBackoff: *retryBackoff,
+		DeadLetters:  dlq,
+	}, logger)
+	if *consumeBlocks {
+		consumer.OnBlockNotice(func(ctx context.Context, blockHash, _ string) error {
+			return proc.AnnounceBlock(ctx, blockHash)
+		})
+	}
+	if *consumeTxMeta {
+		// A delete only means Teranode dropped the entry from its txmeta
+		// cache; the transaction may still be mined, so its terms are kept.
+		consumer.OnTxMeta(func(ctx context.Context, txid [32]byte, deleted bool) error {
+			if deleted {
+				return nil
+			}
+			return proc.PrewarmTx(ctx, txid)
+		})
+	}
+	if *consumeRejectedTx {
+		consumer.OnRejectedTx(func(_ context.Context, txHash, reason string) error {
+			hash, err := chainhash.NewHashFromHex(txHash)
+			if err != nil {
+				logger.Warn("rejected tx with malformed hash", "hash", txHash)
+				return nil
+			}
+			logger.Debug("evicting rejected tx", "txid", txHash, "reason", reason)
+			return proc.EvictTx(*hash)
+		})
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -96,10 +277,99 @@ func main() {
 		cancel()
 	}()
 
+	if command == "replay-dlq" {
+		replayed, failed, err := consumer.ReplayDeadLetters(ctx)
+		logger.Info("replayed dead letters", "replayed", replayed, "failed", failed)
+		if err != nil {
+			log.Fatalf("replay dead letters: %v", err)
+		}
+		return
+	}
+
+	engine := query.NewEngine(metaStore, treereader.NewReader(dualStore))
+	hub := subscribe.NewHub(engine, subscribe.Config{Buffer: *subscribeBuffer}, logger)
+	proc.OnSubtreeIndexed(hub.SubtreeIndexed)
+	proc.OnBlockConnected(hub.BlockConnected)
+	proc.OnReorg(hub.Reorg)
+
+	promo := promoter.NewPromoter(dualStore, metaStore, promoter.Config{
+		ConfirmationDepth: uint32(*confirmations),
+		Interval:          *promoteInterval,
+	}, logger)
+	go promo.Run(ctx)
+
+	if err := proc.RetryQueuedBlocks(ctx); err != nil {
+		logger.Warn("retry queued blocks", "error", err)
+	}
+
+	gcConfig := gc.DefaultConfig()
+	gcConfig.Retention = *gcRetention
+	gcConfig.Interval = *gcInterval
+	gcConfig.BuildLock = proc.BuildLock()
+	go gc.NewCollector(dualStore, metaStore, gcConfig, logger).Run(ctx)
+
+	if *httpAddr != "" {
+		httpServer := &http.Server{Addr: *httpAddr, Handler: api.NewServer(engine, hub, logger)}
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("http server", "error", err)
+				cancel()
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			httpServer.Close()
+		}()
+	}
+
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("grpc listen: %v", err)
+		}
+		grpcServer := grpc.NewServer()
+		pb.RegisterIndexQueryServer(grpcServer, grpcapi.NewServer(engine, logger))
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				logger.Error("grpc server", "error", err)
+				cancel()
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			grpcServer.Stop()
+		}()
+	}
+
+	if command == "backfill" {
+		bfConfig := backfill.DefaultConfig()
+		bfConfig.FromHeight = uint32(*fromHeight)
+		bfConfig.ToHeight = uint32(*toHeight)
+		bf := backfill.NewBackfiller(client, proc, metaStore, bfConfig, logger)
+		if !*backfillLive {
+			if err := bf.Run(ctx); err != nil && ctx.Err() == nil {
+				log.Fatalf("backfill: %v", err)
+			}
+			return
+		}
+		go func() {
+			if err := bf.Run(ctx); err != nil {
+				if ctx.Err() == nil {
+					logger.Error("backfill stopped; rerun the same range to resume", "error", err)
+				}
+				return
+			}
+			logger.Info("backfill complete", "from", *fromHeight, "to", *toHeight)
+		}()
+	}
+
 	logger.Info("starting indexer",
 		"kafka", *kafkaBrokers,
 		"teranode", *teranodeURL,
 		"data-dir", *dataDir,
+		"http", *httpAddr,
+		"grpc", *grpcAddr,
+		"confirmations", *confirmations,
 	)
 
 	if err := consumer.Run(ctx); err != nil && ctx.Err() == nil {
@@ -0,0 +1,205 @@
+// Package gc reclaims working-space index nodes of subtrees that will never
+// be promoted: subtrees that were never mined and those only included by
+// orphaned blocks.
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/shruggr/inspiration/metadata"
+	"github.com/shruggr/inspiration/multihash"
+	"github.com/shruggr/inspiration/store"
+	"github.com/shruggr/inspiration/treereader"
+)
+
+// Config controls which subtrees are collected and how often.
+type Config struct {
+	Retention    time.Duration // minimum age of an unmined or orphaned subtree before it is collected
+	Interval     time.Duration // how often to run a collection pass
+	DiscardRatio float64       // passed to the working store's value log GC
+	// BuildLock, if set, is held for each pass. Tree builders hold it off
+	// until their subtree row is written, so a tree being built is never
+	// swept for sharing nodes with a dead one; see processor.Processor.BuildLock.
+	BuildLock sync.Locker
+}
+
+// DefaultConfig keeps dead subtrees for a day and collects hourly.
+func DefaultConfig() Config {
+	return Config{
+		Retention:    24 * time.Hour,
+		Interval:     time.Hour,
+		DiscardRatio: 0.5,
+	}
+}
+
+// Stats summarises one collection pass.
+type Stats struct {
+	Subtrees       int   // subtrees removed from metadata
+	Nodes          int   // index nodes deleted from working space
+	ReclaimedBytes int64 // total size of the deleted nodes
+}
+
+// valueLogGC is implemented by stores that can compact after deletes,
+// such as badger.Store.
+type valueLogGC interface {
+	RunGC(discardRatio float64) error
+}
+
+// Collector deletes the index trees of dead subtrees from working space.
+//
+// Trees are content addressed, so a node of a dead subtree may also belong to
+// a live one. Each pass first marks every node reachable from a live
+// unpromoted subtree and only deletes unmarked nodes. Trees are read through
+// the DualStore since nodes shared with promoted blocks are only in
+// persistent space, which is never modified.
+type Collector struct {
+	store    *store.DualStore
+	metadata metadata.Store
+	reader   treereader.Reader
+	config   Config
+	logger   *slog.Logger
+	now      func() time.Time
+}
+
+func NewCollector(store *store.DualStore, metadata metadata.Store, config Config, logger *slog.Logger) *Collector {
+	return &Collector{
+		store:    store,
+		metadata: metadata,
+		reader:   treereader.NewReader(store),
+		config:   config,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Run performs a collection pass every Interval until ctx is cancelled.
+func (c *Collector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		stats, err := c.Collect(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.logger.Error("garbage collection", "error", err)
+			continue
+		}
+		if stats.Subtrees > 0 {
+			c.logger.Info("garbage collected subtrees",
+				"subtrees", stats.Subtrees,
+				"nodes", stats.Nodes,
+				"reclaimed_bytes", stats.ReclaimedBytes,
+			)
+		}
+	}
+}
+
+// Collect runs a single mark and sweep pass.
+func (c *Collector) Collect(ctx context.Context) (Stats, error) {
+	var stats Stats
+
+	if c.config.BuildLock != nil {
+		c.config.BuildLock.Lock()
+		defer c.config.BuildLock.Unlock()
+	}
+
+	subtrees, err := c.metadata.GetUnpromotedSubtrees(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("get unpromoted subtrees: %w", err)
+	}
+
+	cutoff := c.now().Add(-c.config.Retention)
+	var dead, live []metadata.Subtree
+	for _, st := range subtrees {
+		if !st.InBlock && st.ReceivedAt.Before(cutoff) {
+			dead = append(dead, st)
+		} else {
+			live = append(live, st)
+		}
+	}
+	if len(dead) == 0 {
+		return stats, nil
+	}
+
+	marked := make(map[string]struct{})
+	for _, st := range live {
+		err := c.reader.Walk(ctx, st.IndexRoot, func(key multihash.IndexHash) error {
+			marked[string(key)] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("mark subtree %x: %w", st.Hash, err)
+		}
+	}
+
+	for _, st := range dead {
+		if err := c.sweep(ctx, st, marked, &stats); err != nil {
+			return stats, fmt.Errorf("sweep subtree %x: %w", st.Hash, err)
+		}
+		if err := c.metadata.DeleteSubtree(ctx, st.Hash); err != nil {
+			return stats, fmt.Errorf("delete subtree %x: %w", st.Hash, err)
+		}
+		stats.Subtrees++
+	}
+
+	if gc, ok := c.store.Working().(valueLogGC); ok && stats.Nodes > 0 {
+		if err := gc.RunGC(c.config.DiscardRatio); err != nil {
+			return stats, fmt.Errorf("value log gc: %w", err)
+		}
+	}
+	return stats, nil
+}
+
+// sweep deletes the unmarked nodes of one dead subtree. Deleted nodes are
+// marked as well so that trees sharing them are not counted twice.
+//
+// A tree left incomplete by an interrupted pass is swept as far as it can
+// still be walked; the subtree row is deleted regardless.
+func (c *Collector) sweep(ctx context.Context, st metadata.Subtree, marked map[string]struct{}, stats *Stats) error {
+	var keys [][]byte
+	err := c.reader.Walk(ctx, st.IndexRoot, func(key multihash.IndexHash) error {
+		if _, ok := marked[string(key)]; !ok {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, treereader.ErrNotFound) {
+		return err
+	}
+
+	// Delete children before the root so an interrupted sweep leaves the
+	// remainder reachable for the next pass.
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := keys[i]
+		if _, ok := marked[string(key)]; ok {
+			continue
+		}
+		val, err := c.store.Working().Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			continue
+		}
+		if err := c.store.Delete(ctx, key); err != nil {
+			return err
+		}
+		marked[string(key)] = struct{}{}
+		stats.Nodes++
+		stats.ReclaimedBytes += int64(len(key) + len(val))
+	}
+	return nil
+}
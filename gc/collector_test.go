@@ -0,0 +1,216 @@
+package gc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	kvmem "github.com/shruggr/inspiration/kvstore/memory"
+	metasqlite "github.com/shruggr/inspiration/metadata/sqlite"
+	"github.com/shruggr/inspiration/multihash"
+	"github.com/shruggr/inspiration/store"
+	"github.com/shruggr/inspiration/treebuilder"
+	"github.com/shruggr/inspiration/treereader"
+)
+
+const (
+	addr1 = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	addr2 = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+)
+
+type testEnv struct {
+	collector *Collector
+	meta      *metasqlite.SQLiteStore
+	working   *kvmem.Store
+	dual      *store.DualStore
+	builder   treebuilder.Builder
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	working := kvmem.New()
+	dual := store.NewDualStore(working, kvmem.New())
+	meta, err := metasqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("create metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+
+	c := NewCollector(dual, meta, Config{Retention: time.Hour}, slog.Default())
+	// Every subtree inserted by the test is past the retention window.
+	c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	return &testEnv{collector: c, meta: meta, working: working, dual: dual, builder: treebuilder.NewBuilder(dual)}
+}
+
+func (env *testEnv) addSubtree(t *testing.T, id byte, txs ...treebuilder.TaggedTransaction) multihash.IndexHash {
+	t.Helper()
+	root, err := env.builder.BuildSubtreeIndex(context.Background(), txs)
+	if err != nil {
+		t.Fatalf("BuildSubtreeIndex: %v", err)
+	}
+	if err := env.meta.InsertSubtree(context.Background(), bytes.Repeat([]byte{id}, 32), root.Bytes(), uint32(len(txs))); err != nil {
+		t.Fatalf("InsertSubtree: %v", err)
+	}
+	return root
+}
+
+func (env *testEnv) addBlock(t *testing.T, height uint32, subtreeIDs ...byte) []byte {
+	t.Helper()
+	var hashes [][]byte
+	for _, id := range subtreeIDs {
+		hashes = append(hashes, bytes.Repeat([]byte{id}, 32))
+	}
+	blockHash := bytes.Repeat([]byte{byte(height)}, 32)
+	if err := env.meta.InsertBlock(context.Background(), height, blockHash, make([]byte, 80), 0, hashes); err != nil {
+		t.Fatalf("InsertBlock: %v", err)
+	}
+	return blockHash
+}
+
+// present counts how many nodes of the given trees are still in working space.
+func (env *testEnv) present(t *testing.T, roots ...multihash.IndexHash) int {
+	t.Helper()
+	ctx := context.Background()
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		err := treereader.NewReader(env.dual).Walk(ctx, root, func(key multihash.IndexHash) error {
+			ok, err := env.working.Has(ctx, key)
+			if err != nil {
+				return err
+			}
+			seen[string(key)] = ok
+			return nil
+		})
+		if err != nil && !errors.Is(err, treereader.ErrNotFound) {
+			t.Fatalf("Walk: %v", err)
+		}
+	}
+	n := 0
+	for _, ok := range seen {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+func payTo(txid byte, pos uint64, addr string) treebuilder.TaggedTransaction {
+	return treebuilder.TaggedTransaction{
+		TxID:            [32]byte{txid},
+		SubtreePosition: pos,
+		Tags:            []treebuilder.Tag{{Key: "address", Value: addr, Vouts: []uint32{0}}},
+	}
+}
+
+func TestCollectKeepsSharedNodes(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	// Subtree 1 is mined; subtree 2 never is but shares its addr1 leaf list.
+	liveRoot := env.addSubtree(t, 1, payTo(1, 0, addr1))
+	deadRoot := env.addSubtree(t, 2, payTo(1, 0, addr1), payTo(2, 1, addr2))
+	env.addBlock(t, 100, 1)
+
+	before := env.present(t, liveRoot, deadRoot)
+	stats, err := env.collector.Collect(ctx)
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	// The dead root, its address value node and the addr2 leaf list go.
+	if stats.Subtrees != 1 || stats.Nodes != 3 {
+		t.Fatalf("stats: got %+v, want 1 subtree and 3 nodes", stats)
+	}
+	if stats.ReclaimedBytes <= 0 {
+		t.Errorf("expected reclaimed bytes, got %d", stats.ReclaimedBytes)
+	}
+	if got := env.present(t, liveRoot, deadRoot); got != before-3 {
+		t.Errorf("working store: got %d nodes, want %d", got, before-3)
+	}
+
+	reader := treereader.NewReader(env.dual)
+	entries, err := reader.Lookup(ctx, liveRoot, "address", addr1)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("live subtree lookup: got %d entries, %v", len(entries), err)
+	}
+	if _, err := reader.Keys(ctx, deadRoot); err == nil {
+		t.Error("expected dead subtree root to be gone")
+	}
+	if ok, _ := env.meta.SubtreeExists(ctx, bytes.Repeat([]byte{2}, 32)); ok {
+		t.Error("expected dead subtree row to be deleted")
+	}
+}
+
+func TestCollectOrphanedBlock(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	root := env.addSubtree(t, 1, payTo(1, 0, addr1))
+	orphan := env.addBlock(t, 100, 1)
+
+	if stats, err := env.collector.Collect(ctx); err != nil || stats.Subtrees != 0 {
+		t.Fatalf("subtree in pending block collected: %+v, %v", stats, err)
+	}
+
+	if err := env.meta.OrphanBlock(ctx, orphan); err != nil {
+		t.Fatalf("OrphanBlock: %v", err)
+	}
+	stats, err := env.collector.Collect(ctx)
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if n := env.present(t, root); stats.Subtrees != 1 || n != 0 {
+		t.Errorf("stats %+v, %d nodes left in working store", stats, n)
+	}
+}
+
+func TestCollectRespectsRetention(t *testing.T) {
+	env := newTestEnv(t)
+	env.collector.now = time.Now
+
+	root := env.addSubtree(t, 1, payTo(1, 0, addr1))
+
+	stats, err := env.collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if stats.Subtrees != 0 || env.present(t, root) != 3 {
+		t.Errorf("recent subtree collected: %+v", stats)
+	}
+}
+
+func TestCollectWaitsForBuilds(t *testing.T) {
+	env := newTestEnv(t)
+	var buildMu sync.RWMutex
+	env.collector.config.BuildLock = &buildMu
+
+	// A redelivered subtree rebuilds the dead one's tree, whose nodes must
+	// survive until its row is recorded again
+	env.addSubtree(t, 1, payTo(1, 0, addr1))
+	buildMu.RLock()
+	done := make(chan Stats)
+	go func() {
+		stats, err := env.collector.Collect(context.Background())
+		if err != nil {
+			t.Errorf("Collect: %v", err)
+		}
+		done <- stats
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("collected while a build was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	env.collector.now = time.Now
+	root := env.addSubtree(t, 1, payTo(1, 0, addr1))
+	buildMu.RUnlock()
+
+	if stats := <-done; stats.Subtrees != 0 || env.present(t, root) != 3 {
+		t.Errorf("rebuilt subtree collected: %+v", stats)
+	}
+}
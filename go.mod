@@ -10,7 +10,9 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.34
 	github.com/multiformats/go-multihash v0.2.3
 	github.com/segmentio/kafka-go v0.4.50
+	google.golang.org/grpc v1.78.0
 	google.golang.org/protobuf v1.36.11
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -35,5 +37,7 @@ require (
 	golang.org/x/crypto v0.49.0 // indirect
 	golang.org/x/net v0.52.0 // indirect
 	golang.org/x/sys v0.42.0 // indirect
+	golang.org/x/text v0.35.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260128011058-8636f8732409 // indirect
 	lukechampine.com/blake3 v1.4.1 // indirect
 )
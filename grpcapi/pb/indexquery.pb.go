@@ -0,0 +1,561 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: indexquery.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LookupTagRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	FromHeight    uint32                 `protobuf:"varint,3,opt,name=from_height,json=fromHeight,proto3" json:"from_height,omitempty"`
+	ToHeight      uint32                 `protobuf:"varint,4,opt,name=to_height,json=toHeight,proto3" json:"to_height,omitempty"` // 0 means no upper bound
+	Cursor        string                 `protobuf:"bytes,5,opt,name=cursor,proto3" json:"cursor,omitempty"`                      // resume strictly after this cursor
+	Scope         string                 `protobuf:"bytes,6,opt,name=scope,proto3" json:"scope,omitempty"`                        // "blocks" (default), "mempool" or "all"; the mempool is only read without to_height
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupTagRequest) Reset() {
+	*x = LookupTagRequest{}
+	mi := &file_indexquery_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupTagRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupTagRequest) ProtoMessage() {}
+
+func (x *LookupTagRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_indexquery_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupTagRequest.ProtoReflect.Descriptor instead.
+func (*LookupTagRequest) Descriptor() ([]byte, []int) {
+	return file_indexquery_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LookupTagRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *LookupTagRequest) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *LookupTagRequest) GetFromHeight() uint32 {
+	if x != nil {
+		return x.FromHeight
+	}
+	return 0
+}
+
+func (x *LookupTagRequest) GetToHeight() uint32 {
+	if x != nil {
+		return x.ToHeight
+	}
+	return 0
+}
+
+func (x *LookupTagRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *LookupTagRequest) GetScope() string {
+	if x != nil {
+		return x.Scope
+	}
+	return ""
+}
+
+type QueryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Expr          string                 `protobuf:"bytes,1,opt,name=expr,proto3" json:"expr,omitempty"`
+	FromHeight    uint32                 `protobuf:"varint,2,opt,name=from_height,json=fromHeight,proto3" json:"from_height,omitempty"`
+	ToHeight      uint32                 `protobuf:"varint,3,opt,name=to_height,json=toHeight,proto3" json:"to_height,omitempty"` // 0 means no upper bound
+	Cursor        string                 `protobuf:"bytes,4,opt,name=cursor,proto3" json:"cursor,omitempty"`                      // resume strictly after this cursor
+	Scope         string                 `protobuf:"bytes,5,opt,name=scope,proto3" json:"scope,omitempty"`                        // as in LookupTagRequest
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRequest) Reset() {
+	*x = QueryRequest{}
+	mi := &file_indexquery_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRequest) ProtoMessage() {}
+
+func (x *QueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_indexquery_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRequest.ProtoReflect.Descriptor instead.
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return file_indexquery_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *QueryRequest) GetExpr() string {
+	if x != nil {
+		return x.Expr
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetFromHeight() uint32 {
+	if x != nil {
+		return x.FromHeight
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetToHeight() uint32 {
+	if x != nil {
+		return x.ToHeight
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetScope() string {
+	if x != nil {
+		return x.Scope
+	}
+	return ""
+}
+
+type ScanTagRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Prefix        string                 `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"` // mutually exclusive with start/end
+	Start         string                 `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`   // inclusive
+	End           string                 `protobuf:"bytes,4,opt,name=end,proto3" json:"end,omitempty"`       // exclusive; empty means no upper bound
+	FromHeight    uint32                 `protobuf:"varint,5,opt,name=from_height,json=fromHeight,proto3" json:"from_height,omitempty"`
+	ToHeight      uint32                 `protobuf:"varint,6,opt,name=to_height,json=toHeight,proto3" json:"to_height,omitempty"` // 0 means no upper bound
+	After         string                 `protobuf:"bytes,7,opt,name=after,proto3" json:"after,omitempty"`                        // resume after this TagValue.cursor
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanTagRequest) Reset() {
+	*x = ScanTagRequest{}
+	mi := &file_indexquery_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanTagRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanTagRequest) ProtoMessage() {}
+
+func (x *ScanTagRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_indexquery_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanTagRequest.ProtoReflect.Descriptor instead.
+func (*ScanTagRequest) Descriptor() ([]byte, []int) {
+	return file_indexquery_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ScanTagRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ScanTagRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *ScanTagRequest) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *ScanTagRequest) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+func (x *ScanTagRequest) GetFromHeight() uint32 {
+	if x != nil {
+		return x.FromHeight
+	}
+	return 0
+}
+
+func (x *ScanTagRequest) GetToHeight() uint32 {
+	if x != nil {
+		return x.ToHeight
+	}
+	return 0
+}
+
+func (x *ScanTagRequest) GetAfter() string {
+	if x != nil {
+		return x.After
+	}
+	return ""
+}
+
+type TagValue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Entries       []*LeafEntry           `protobuf:"bytes,2,rep,name=entries,proto3" json:"entries,omitempty"`
+	Cursor        string                 `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"` // pass back as ScanTagRequest.after to resume after this value
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TagValue) Reset() {
+	*x = TagValue{}
+	mi := &file_indexquery_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TagValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TagValue) ProtoMessage() {}
+
+func (x *TagValue) ProtoReflect() protoreflect.Message {
+	mi := &file_indexquery_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TagValue.ProtoReflect.Descriptor instead.
+func (*TagValue) Descriptor() ([]byte, []int) {
+	return file_indexquery_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TagValue) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *TagValue) GetEntries() []*LeafEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *TagValue) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type LeafEntry struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Txid            []byte                 `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"` // internal byte order
+	SubtreeHash     []byte                 `protobuf:"bytes,2,opt,name=subtree_hash,json=subtreeHash,proto3" json:"subtree_hash,omitempty"`
+	SubtreePosition uint64                 `protobuf:"varint,3,opt,name=subtree_position,json=subtreePosition,proto3" json:"subtree_position,omitempty"`
+	Vouts           []uint32               `protobuf:"varint,4,rep,packed,name=vouts,proto3" json:"vouts,omitempty"`
+	BlockHeight     uint32                 `protobuf:"varint,5,opt,name=block_height,json=blockHeight,proto3" json:"block_height,omitempty"`
+	BlockHash       []byte                 `protobuf:"bytes,6,opt,name=block_hash,json=blockHash,proto3" json:"block_hash,omitempty"`
+	SubtreeIndex    uint32                 `protobuf:"varint,7,opt,name=subtree_index,json=subtreeIndex,proto3" json:"subtree_index,omitempty"`
+	Cursor          string                 `protobuf:"bytes,8,opt,name=cursor,proto3" json:"cursor,omitempty"`             // pass back as LookupTagRequest.cursor to resume after this entry
+	Vins            []uint32               `protobuf:"varint,9,rep,packed,name=vins,proto3" json:"vins,omitempty"`         // inputs, for tags derived from what the tx spends
+	Unconfirmed     bool                   `protobuf:"varint,10,opt,name=unconfirmed,proto3" json:"unconfirmed,omitempty"` // from the mempool, with no block
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *LeafEntry) Reset() {
+	*x = LeafEntry{}
+	mi := &file_indexquery_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeafEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeafEntry) ProtoMessage() {}
+
+func (x *LeafEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_indexquery_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeafEntry.ProtoReflect.Descriptor instead.
+func (*LeafEntry) Descriptor() ([]byte, []int) {
+	return file_indexquery_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *LeafEntry) GetTxid() []byte {
+	if x != nil {
+		return x.Txid
+	}
+	return nil
+}
+
+func (x *LeafEntry) GetSubtreeHash() []byte {
+	if x != nil {
+		return x.SubtreeHash
+	}
+	return nil
+}
+
+func (x *LeafEntry) GetSubtreePosition() uint64 {
+	if x != nil {
+		return x.SubtreePosition
+	}
+	return 0
+}
+
+func (x *LeafEntry) GetVouts() []uint32 {
+	if x != nil {
+		return x.Vouts
+	}
+	return nil
+}
+
+func (x *LeafEntry) GetBlockHeight() uint32 {
+	if x != nil {
+		return x.BlockHeight
+	}
+	return 0
+}
+
+func (x *LeafEntry) GetBlockHash() []byte {
+	if x != nil {
+		return x.BlockHash
+	}
+	return nil
+}
+
+func (x *LeafEntry) GetSubtreeIndex() uint32 {
+	if x != nil {
+		return x.SubtreeIndex
+	}
+	return 0
+}
+
+func (x *LeafEntry) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *LeafEntry) GetVins() []uint32 {
+	if x != nil {
+		return x.Vins
+	}
+	return nil
+}
+
+func (x *LeafEntry) GetUnconfirmed() bool {
+	if x != nil {
+		return x.Unconfirmed
+	}
+	return false
+}
+
+var File_indexquery_proto protoreflect.FileDescriptor
+
+const file_indexquery_proto_rawDesc = "" +
+	"\n" +
+	"\x10indexquery.proto\x12\rindexquery.v1\"\xa6\x01\n" +
+	"\x10LookupTagRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x12\x1f\n" +
+	"\vfrom_height\x18\x03 \x01(\rR\n" +
+	"fromHeight\x12\x1b\n" +
+	"\tto_height\x18\x04 \x01(\rR\btoHeight\x12\x16\n" +
+	"\x06cursor\x18\x05 \x01(\tR\x06cursor\x12\x14\n" +
+	"\x05scope\x18\x06 \x01(\tR\x05scope\"\x8e\x01\n" +
+	"\fQueryRequest\x12\x12\n" +
+	"\x04expr\x18\x01 \x01(\tR\x04expr\x12\x1f\n" +
+	"\vfrom_height\x18\x02 \x01(\rR\n" +
+	"fromHeight\x12\x1b\n" +
+	"\tto_height\x18\x03 \x01(\rR\btoHeight\x12\x16\n" +
+	"\x06cursor\x18\x04 \x01(\tR\x06cursor\x12\x14\n" +
+	"\x05scope\x18\x05 \x01(\tR\x05scope\"\xb6\x01\n" +
+	"\x0eScanTagRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x16\n" +
+	"\x06prefix\x18\x02 \x01(\tR\x06prefix\x12\x14\n" +
+	"\x05start\x18\x03 \x01(\tR\x05start\x12\x10\n" +
+	"\x03end\x18\x04 \x01(\tR\x03end\x12\x1f\n" +
+	"\vfrom_height\x18\x05 \x01(\rR\n" +
+	"fromHeight\x12\x1b\n" +
+	"\tto_height\x18\x06 \x01(\rR\btoHeight\x12\x14\n" +
+	"\x05after\x18\a \x01(\tR\x05after\"l\n" +
+	"\bTagValue\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x122\n" +
+	"\aentries\x18\x02 \x03(\v2\x18.indexquery.v1.LeafEntryR\aentries\x12\x16\n" +
+	"\x06cursor\x18\x03 \x01(\tR\x06cursor\"\xb8\x02\n" +
+	"\tLeafEntry\x12\x12\n" +
+	"\x04txid\x18\x01 \x01(\fR\x04txid\x12!\n" +
+	"\fsubtree_hash\x18\x02 \x01(\fR\vsubtreeHash\x12)\n" +
+	"\x10subtree_position\x18\x03 \x01(\x04R\x0fsubtreePosition\x12\x14\n" +
+	"\x05vouts\x18\x04 \x03(\rR\x05vouts\x12!\n" +
+	"\fblock_height\x18\x05 \x01(\rR\vblockHeight\x12\x1d\n" +
+	"\n" +
+	"block_hash\x18\x06 \x01(\fR\tblockHash\x12#\n" +
+	"\rsubtree_index\x18\a \x01(\rR\fsubtreeIndex\x12\x16\n" +
+	"\x06cursor\x18\b \x01(\tR\x06cursor\x12\x12\n" +
+	"\x04vins\x18\t \x03(\rR\x04vins\x12 \n" +
+	"\vunconfirmed\x18\n" +
+	" \x01(\bR\vunconfirmed2\xdd\x01\n" +
+	"\n" +
+	"IndexQuery\x12H\n" +
+	"\tLookupTag\x12\x1f.indexquery.v1.LookupTagRequest\x1a\x18.indexquery.v1.LeafEntry0\x01\x12@\n" +
+	"\x05Query\x12\x1b.indexquery.v1.QueryRequest\x1a\x18.indexquery.v1.LeafEntry0\x01\x12C\n" +
+	"\aScanTag\x12\x1d.indexquery.v1.ScanTagRequest\x1a\x17.indexquery.v1.TagValue0\x01B.Z,github.com/shruggr/inspiration/grpcapi/pb;pbb\x06proto3"
+
+var (
+	file_indexquery_proto_rawDescOnce sync.Once
+	file_indexquery_proto_rawDescData []byte
+)
+
+func file_indexquery_proto_rawDescGZIP() []byte {
+	file_indexquery_proto_rawDescOnce.Do(func() {
+		file_indexquery_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_indexquery_proto_rawDesc), len(file_indexquery_proto_rawDesc)))
+	})
+	return file_indexquery_proto_rawDescData
+}
+
+var file_indexquery_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_indexquery_proto_goTypes = []any{
+	(*LookupTagRequest)(nil), // 0: indexquery.v1.LookupTagRequest
+	(*QueryRequest)(nil),     // 1: indexquery.v1.QueryRequest
+	(*ScanTagRequest)(nil),   // 2: indexquery.v1.ScanTagRequest
+	(*TagValue)(nil),         // 3: indexquery.v1.TagValue
+	(*LeafEntry)(nil),        // 4: indexquery.v1.LeafEntry
+}
+var file_indexquery_proto_depIdxs = []int32{
+	4, // 0: indexquery.v1.TagValue.entries:type_name -> indexquery.v1.LeafEntry
+	0, // 1: indexquery.v1.IndexQuery.LookupTag:input_type -> indexquery.v1.LookupTagRequest
+	1, // 2: indexquery.v1.IndexQuery.Query:input_type -> indexquery.v1.QueryRequest
+	2, // 3: indexquery.v1.IndexQuery.ScanTag:input_type -> indexquery.v1.ScanTagRequest
+	4, // 4: indexquery.v1.IndexQuery.LookupTag:output_type -> indexquery.v1.LeafEntry
+	4, // 5: indexquery.v1.IndexQuery.Query:output_type -> indexquery.v1.LeafEntry
+	3, // 6: indexquery.v1.IndexQuery.ScanTag:output_type -> indexquery.v1.TagValue
+	4, // [4:7] is the sub-list for method output_type
+	1, // [1:4] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_indexquery_proto_init() }
+func file_indexquery_proto_init() {
+	if File_indexquery_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_indexquery_proto_rawDesc), len(file_indexquery_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_indexquery_proto_goTypes,
+		DependencyIndexes: file_indexquery_proto_depIdxs,
+		MessageInfos:      file_indexquery_proto_msgTypes,
+	}.Build()
+	File_indexquery_proto = out.File
+	file_indexquery_proto_goTypes = nil
+	file_indexquery_proto_depIdxs = nil
+}
@@ -0,0 +1,226 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: indexquery.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	IndexQuery_LookupTag_FullMethodName = "/indexquery.v1.IndexQuery/LookupTag"
+	IndexQuery_Query_FullMethodName     = "/indexquery.v1.IndexQuery/Query"
+	IndexQuery_ScanTag_FullMethodName   = "/indexquery.v1.IndexQuery/ScanTag"
+)
+
+// IndexQueryClient is the client API for IndexQuery service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// IndexQuery answers tag queries against the subtree indexes of confirmed
+// blocks and, for lookups and queries that ask for it, of the mempool.
+type IndexQueryClient interface {
+	// LookupTag streams every transaction tagged key=value in chain order
+	// (block height, subtree index, subtree position).
+	LookupTag(ctx context.Context, in *LookupTagRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LeafEntry], error)
+	// Query streams every transaction matching a boolean tag expression such as
+	// "address=X AND type=bsv21 AND NOT protocol=MAP", in chain order.
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LeafEntry], error)
+	// ScanTag streams the values of a tag key matching a prefix or range,
+	// subtree by subtree in chain order: one message per matching value of each
+	// subtree, in value order, with its entries.
+	ScanTag(ctx context.Context, in *ScanTagRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TagValue], error)
+}
+
+type indexQueryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIndexQueryClient(cc grpc.ClientConnInterface) IndexQueryClient {
+	return &indexQueryClient{cc}
+}
+
+func (c *indexQueryClient) LookupTag(ctx context.Context, in *LookupTagRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LeafEntry], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &IndexQuery_ServiceDesc.Streams[0], IndexQuery_LookupTag_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[LookupTagRequest, LeafEntry]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IndexQuery_LookupTagClient = grpc.ServerStreamingClient[LeafEntry]
+
+func (c *indexQueryClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LeafEntry], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &IndexQuery_ServiceDesc.Streams[1], IndexQuery_Query_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[QueryRequest, LeafEntry]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IndexQuery_QueryClient = grpc.ServerStreamingClient[LeafEntry]
+
+func (c *indexQueryClient) ScanTag(ctx context.Context, in *ScanTagRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TagValue], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &IndexQuery_ServiceDesc.Streams[2], IndexQuery_ScanTag_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ScanTagRequest, TagValue]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IndexQuery_ScanTagClient = grpc.ServerStreamingClient[TagValue]
+
+// IndexQueryServer is the server API for IndexQuery service.
+// All implementations must embed UnimplementedIndexQueryServer
+// for forward compatibility.
+//
+// IndexQuery answers tag queries against the subtree indexes of confirmed
+// blocks and, for lookups and queries that ask for it, of the mempool.
+type IndexQueryServer interface {
+	// LookupTag streams every transaction tagged key=value in chain order
+	// (block height, subtree index, subtree position).
+	LookupTag(*LookupTagRequest, grpc.ServerStreamingServer[LeafEntry]) error
+	// Query streams every transaction matching a boolean tag expression such as
+	// "address=X AND type=bsv21 AND NOT protocol=MAP", in chain order.
+	Query(*QueryRequest, grpc.ServerStreamingServer[LeafEntry]) error
+	// ScanTag streams the values of a tag key matching a prefix or range,
+	// subtree by subtree in chain order: one message per matching value of each
+	// subtree, in value order, with its entries.
+	ScanTag(*ScanTagRequest, grpc.ServerStreamingServer[TagValue]) error
+	mustEmbedUnimplementedIndexQueryServer()
+}
+
+// UnimplementedIndexQueryServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIndexQueryServer struct{}
+
+func (UnimplementedIndexQueryServer) LookupTag(*LookupTagRequest, grpc.ServerStreamingServer[LeafEntry]) error {
+	return status.Error(codes.Unimplemented, "method LookupTag not implemented")
+}
+func (UnimplementedIndexQueryServer) Query(*QueryRequest, grpc.ServerStreamingServer[LeafEntry]) error {
+	return status.Error(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedIndexQueryServer) ScanTag(*ScanTagRequest, grpc.ServerStreamingServer[TagValue]) error {
+	return status.Error(codes.Unimplemented, "method ScanTag not implemented")
+}
+func (UnimplementedIndexQueryServer) mustEmbedUnimplementedIndexQueryServer() {}
+func (UnimplementedIndexQueryServer) testEmbeddedByValue()                    {}
+
+// UnsafeIndexQueryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IndexQueryServer will
+// result in compilation errors.
+type UnsafeIndexQueryServer interface {
+	mustEmbedUnimplementedIndexQueryServer()
+}
+
+func RegisterIndexQueryServer(s grpc.ServiceRegistrar, srv IndexQueryServer) {
+	// If the following call panics, it indicates UnimplementedIndexQueryServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&IndexQuery_ServiceDesc, srv)
+}
+
+func _IndexQuery_LookupTag_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LookupTagRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IndexQueryServer).LookupTag(m, &grpc.GenericServerStream[LookupTagRequest, LeafEntry]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IndexQuery_LookupTagServer = grpc.ServerStreamingServer[LeafEntry]
+
+func _IndexQuery_Query_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IndexQueryServer).Query(m, &grpc.GenericServerStream[QueryRequest, LeafEntry]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IndexQuery_QueryServer = grpc.ServerStreamingServer[LeafEntry]
+
+func _IndexQuery_ScanTag_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanTagRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IndexQueryServer).ScanTag(m, &grpc.GenericServerStream[ScanTagRequest, TagValue]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IndexQuery_ScanTagServer = grpc.ServerStreamingServer[TagValue]
+
+// IndexQuery_ServiceDesc is the grpc.ServiceDesc for IndexQuery service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IndexQuery_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "indexquery.v1.IndexQuery",
+	HandlerType: (*IndexQueryServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "LookupTag",
+			Handler:       _IndexQuery_LookupTag_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Query",
+			Handler:       _IndexQuery_Query_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ScanTag",
+			Handler:       _IndexQuery_ScanTag_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "indexquery.proto",
+}
@@ -0,0 +1,150 @@
+// Package grpcapi exposes the query engine as the IndexQuery gRPC service.
+package grpcapi
+
+//go:generate protoc -I ../proto --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative indexquery.proto
+
+import (
+	"log/slog"
+
+	"github.com/shruggr/inspiration/grpcapi/pb"
+	"github.com/shruggr/inspiration/query"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements pb.IndexQueryServer on top of a query.Engine.
+type Server struct {
+	pb.UnimplementedIndexQueryServer
+	engine *query.Engine
+	logger *slog.Logger
+}
+
+// NewServer creates an IndexQuery service backed by engine.
+func NewServer(engine *query.Engine, logger *slog.Logger) *Server {
+	return &Server{engine: engine, logger: logger}
+}
+
+// LookupTag streams results as the engine walks subtrees, so large result
+// sets are never buffered in memory.
+func (s *Server) LookupTag(req *pb.LookupTagRequest, stream pb.IndexQuery_LookupTagServer) error {
+	if req.GetKey() == "" {
+		return status.Error(codes.InvalidArgument, "key is required")
+	}
+
+	scope, err := query.ParseScope(req.GetScope())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	q := query.Request{
+		Key:        req.GetKey(),
+		Value:      req.GetValue(),
+		FromHeight: req.GetFromHeight(),
+		ToHeight:   req.GetToHeight(),
+		Scope:      scope,
+	}
+	return s.stream(q, req.GetCursor(), stream)
+}
+
+// Query streams results for a boolean tag expression.
+func (s *Server) Query(req *pb.QueryRequest, stream pb.IndexQuery_QueryServer) error {
+	expr, err := query.ParseExpr(req.GetExpr())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	scope, err := query.ParseScope(req.GetScope())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	q := query.Request{
+		Expr:       expr,
+		FromHeight: req.GetFromHeight(),
+		ToHeight:   req.GetToHeight(),
+		Scope:      scope,
+	}
+	return s.stream(q, req.GetCursor(), stream)
+}
+
+// ScanTag streams each matching value of each subtree as it is found.
+func (s *Server) ScanTag(req *pb.ScanTagRequest, stream pb.IndexQuery_ScanTagServer) error {
+	if req.GetKey() == "" {
+		return status.Error(codes.InvalidArgument, "key is required")
+	}
+	if req.GetPrefix() != "" && (req.GetStart() != "" || req.GetEnd() != "") {
+		return status.Error(codes.InvalidArgument, "prefix cannot be combined with start or end")
+	}
+
+	q := query.ScanRequest{
+		Key:        req.GetKey(),
+		Prefix:     req.GetPrefix(),
+		Start:      req.GetStart(),
+		End:        req.GetEnd(),
+		FromHeight: req.GetFromHeight(),
+		ToHeight:   req.GetToHeight(),
+	}
+	if req.GetAfter() != "" {
+		after, err := query.ParseScanCursor(req.GetAfter())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		q.After = &after
+	}
+	ctx := stream.Context()
+	err := s.engine.ScanEach(ctx, q, func(v query.ValueResults) error {
+		entries := make([]*pb.LeafEntry, len(v.Results))
+		for i, r := range v.Results {
+			entries[i] = newLeafEntry(r)
+		}
+		return stream.Send(&pb.TagValue{Value: v.Value, Entries: entries, Cursor: v.Cursor().String()})
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		s.logger.Error("grpc scan", "key", q.Key, "prefix", q.Prefix, "start", q.Start, "end", q.End, "error", err)
+		return status.Error(codes.Internal, "query failed")
+	}
+	return nil
+}
+
+// stream runs q from the optional resume cursor, sending each result as it is found.
+func (s *Server) stream(q query.Request, cursor string, stream grpc.ServerStreamingServer[pb.LeafEntry]) error {
+	if cursor != "" {
+		after, err := query.ParseCursor(cursor)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		q.After = &after
+	}
+
+	ctx := stream.Context()
+	err := s.engine.Each(ctx, q, func(r query.Result) error {
+		return stream.Send(newLeafEntry(r))
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		s.logger.Error("grpc lookup", "key", q.Key, "value", q.Value, "expr", q.Expr, "error", err)
+		return status.Error(codes.Internal, "query failed")
+	}
+	return nil
+}
+
+func newLeafEntry(r query.Result) *pb.LeafEntry {
+	return &pb.LeafEntry{
+		Txid:            r.TxID,
+		SubtreeHash:     r.SubtreeHash,
+		SubtreePosition: r.SubtreePosition,
+		Vouts:           r.Vouts,
+		Vins:            r.Vins,
+		BlockHeight:     r.BlockHeight,
+		BlockHash:       r.BlockHash,
+		SubtreeIndex:    r.SubtreeIndex,
+		Cursor:          r.Cursor().String(),
+		Unconfirmed:     r.Unconfirmed,
+	}
+}
@@ -0,0 +1,307 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/shruggr/inspiration/grpcapi/pb"
+	kvmem "github.com/shruggr/inspiration/kvstore/memory"
+	metasqlite "github.com/shruggr/inspiration/metadata/sqlite"
+	"github.com/shruggr/inspiration/query"
+	"github.com/shruggr/inspiration/treebuilder"
+	"github.com/shruggr/inspiration/treereader"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const addr1 = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+
+// newTestClient serves the IndexQuery service over bufconn. Each of the given
+// blocks (heights 100, 101, ...) holds one subtree whose transactions all pay addr1.
+func newTestClient(t *testing.T, txsPerBlock ...int) pb.IndexQueryClient {
+	t.Helper()
+	return newMempoolTestClient(t, 0, txsPerBlock...)
+}
+
+// newMempoolTestClient is newTestClient with a further subtree of mempoolTxs
+// transactions paying addr1 that is in no block.
+func newMempoolTestClient(t *testing.T, mempoolTxs int, txsPerBlock ...int) pb.IndexQueryClient {
+	t.Helper()
+	ctx := context.Background()
+
+	kv := kvmem.New()
+	meta, err := metasqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("create metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+
+	builder := treebuilder.NewBuilder(kv)
+	insertSubtree := func(id byte, n int) []byte {
+		txs := make([]treebuilder.TaggedTransaction, n)
+		for j := range txs {
+			txs[j] = treebuilder.TaggedTransaction{
+				TxID:            [32]byte{id, byte(j)},
+				SubtreePosition: uint64(j),
+				Tags:            []treebuilder.Tag{{Key: "address", Value: addr1, Vouts: []uint32{uint32(j)}}},
+			}
+		}
+		root, err := builder.BuildSubtreeIndex(ctx, txs)
+		if err != nil {
+			t.Fatalf("BuildSubtreeIndex: %v", err)
+		}
+		subtreeHash := bytes.Repeat([]byte{id + 1}, 32)
+		if err := meta.InsertSubtree(ctx, subtreeHash, root.Bytes(), uint32(n)); err != nil {
+			t.Fatalf("InsertSubtree: %v", err)
+		}
+		return subtreeHash
+	}
+	for i, n := range txsPerBlock {
+		subtreeHash := insertSubtree(byte(i), n)
+		blockHash := bytes.Repeat([]byte{byte(0x80 + i)}, 32)
+		if err := meta.InsertBlock(ctx, uint32(100+i), blockHash, make([]byte, 80), uint64(n), [][]byte{subtreeHash}); err != nil {
+			t.Fatalf("InsertBlock: %v", err)
+		}
+		if err := meta.PromoteBlock(ctx, blockHash); err != nil {
+			t.Fatalf("PromoteBlock: %v", err)
+		}
+	}
+	if mempoolTxs > 0 {
+		insertSubtree(0x7f, mempoolTxs)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterIndexQueryServer(srv, NewServer(query.NewEngine(meta, treereader.NewReader(kv)), slog.Default()))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewIndexQueryClient(conn)
+}
+
+func collect(t *testing.T, stream pb.IndexQuery_LookupTagClient) ([]*pb.LeafEntry, error) {
+	t.Helper()
+	var entries []*pb.LeafEntry
+	for {
+		entry, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func TestLookupTagStream(t *testing.T) {
+	client := newTestClient(t, 2, 3)
+
+	stream, err := client.LookupTag(context.Background(), &pb.LookupTagRequest{Key: "address", Value: addr1})
+	if err != nil {
+		t.Fatalf("LookupTag: %v", err)
+	}
+	entries, err := collect(t, stream)
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("entries: got %d, want 5", len(entries))
+	}
+
+	last := entries[4]
+	if last.GetBlockHeight() != 101 || last.GetSubtreePosition() != 2 {
+		t.Errorf("last entry: height=%d pos=%d", last.GetBlockHeight(), last.GetSubtreePosition())
+	}
+	if !bytes.Equal(last.GetSubtreeHash(), bytes.Repeat([]byte{2}, 32)) {
+		t.Errorf("last entry subtree hash: got %x", last.GetSubtreeHash())
+	}
+	if len(last.GetVouts()) != 1 || last.GetVouts()[0] != 2 {
+		t.Errorf("last entry vouts: got %v, want [2]", last.GetVouts())
+	}
+}
+
+func TestLookupTagResumeFromCursor(t *testing.T) {
+	client := newTestClient(t, 2, 3)
+	ctx := context.Background()
+
+	stream, err := client.LookupTag(ctx, &pb.LookupTagRequest{Key: "address", Value: addr1})
+	if err != nil {
+		t.Fatalf("LookupTag: %v", err)
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+
+	stream, err = client.LookupTag(ctx, &pb.LookupTagRequest{Key: "address", Value: addr1, Cursor: first.GetCursor()})
+	if err != nil {
+		t.Fatalf("LookupTag with cursor: %v", err)
+	}
+	rest, err := collect(t, stream)
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if len(rest) != 4 {
+		t.Fatalf("entries after cursor: got %d, want 4", len(rest))
+	}
+}
+
+func TestLookupTagInvalidArgument(t *testing.T) {
+	client := newTestClient(t, 1)
+	ctx := context.Background()
+
+	for _, req := range []*pb.LookupTagRequest{
+		{Value: addr1},
+		{Key: "address", Value: addr1, Cursor: "bogus"},
+	} {
+		stream, err := client.LookupTag(ctx, req)
+		if err != nil {
+			t.Fatalf("LookupTag: %v", err)
+		}
+		_, err = collect(t, stream)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("request %v: got %v, want InvalidArgument", req, err)
+		}
+	}
+}
+
+func TestLookupTagMempoolScope(t *testing.T) {
+	client := newMempoolTestClient(t, 2, 3)
+	ctx := context.Background()
+
+	lookup := func(scope string) []*pb.LeafEntry {
+		t.Helper()
+		stream, err := client.LookupTag(ctx, &pb.LookupTagRequest{Key: "address", Value: addr1, Scope: scope})
+		if err != nil {
+			t.Fatalf("LookupTag: %v", err)
+		}
+		entries, err := collect(t, stream)
+		if err != nil {
+			t.Fatalf("scope %q: %v", scope, err)
+		}
+		return entries
+	}
+	if entries := lookup(""); len(entries) != 3 || entries[2].GetUnconfirmed() {
+		t.Errorf("blocks: %v", entries)
+	}
+	if entries := lookup("mempool"); len(entries) != 2 || !entries[0].GetUnconfirmed() || entries[0].GetBlockHeight() != 0 {
+		t.Errorf("mempool: %v", entries)
+	}
+	entries := lookup("all")
+	if len(entries) != 5 || entries[2].GetUnconfirmed() || !entries[3].GetUnconfirmed() {
+		t.Fatalf("all: %v", entries)
+	}
+
+	// Mempool cursors resume within the mempool
+	stream, err := client.Query(ctx, &pb.QueryRequest{Expr: "address=" + addr1, Scope: "all", Cursor: entries[3].GetCursor()})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	rest, err := collect(t, stream)
+	if err != nil || len(rest) != 1 || !rest[0].GetUnconfirmed() || rest[0].GetSubtreePosition() != 1 {
+		t.Errorf("query after mempool cursor: %v, %v", rest, err)
+	}
+
+	stream, err = client.Query(ctx, &pb.QueryRequest{Expr: "address=" + addr1, Scope: "pending"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if _, err := collect(t, stream); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad scope: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestQueryStream(t *testing.T) {
+	client := newTestClient(t, 2, 3)
+	ctx := context.Background()
+
+	stream, err := client.Query(ctx, &pb.QueryRequest{Expr: "address=" + addr1 + " AND NOT address=1Unknown", FromHeight: 101})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	entries, err := collect(t, stream)
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("entries: got %d, want 3", len(entries))
+	}
+
+	stream, err = client.Query(ctx, &pb.QueryRequest{Expr: "NOT address=" + addr1})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if _, err := collect(t, stream); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bare NOT: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestScanTagStream(t *testing.T) {
+	client := newTestClient(t, 2, 1)
+
+	scan := func(req *pb.ScanTagRequest) []*pb.TagValue {
+		t.Helper()
+		stream, err := client.ScanTag(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ScanTag: %v", err)
+		}
+		var values []*pb.TagValue
+		for {
+			v, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return values
+			}
+			if err != nil {
+				t.Fatalf("Recv: %v", err)
+			}
+			values = append(values, v)
+		}
+	}
+
+	// One message per subtree the value appears in
+	values := scan(&pb.ScanTagRequest{Key: "address", Prefix: "1A"})
+	if len(values) != 2 || values[0].GetValue() != addr1 || values[1].GetValue() != addr1 {
+		t.Fatalf("values: got %v", values)
+	}
+	if entries := values[0].GetEntries(); len(entries) != 2 || entries[1].GetBlockHeight() != 100 {
+		t.Fatalf("first subtree entries: got %v", entries)
+	}
+
+	rest := scan(&pb.ScanTagRequest{Key: "address", Prefix: "1A", After: values[0].GetCursor()})
+	if len(rest) != 1 || len(rest[0].GetEntries()) != 1 || rest[0].GetEntries()[0].GetBlockHeight() != 101 {
+		t.Fatalf("values after cursor: got %v", rest)
+	}
+
+	stream, err := client.ScanTag(context.Background(), &pb.ScanTagRequest{Key: "address", After: "bad"})
+	if err != nil {
+		t.Fatalf("ScanTag: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad cursor: got %v, want InvalidArgument", err)
+	}
+
+	stream, err = client.ScanTag(context.Background(), &pb.ScanTagRequest{Key: "address", Prefix: "1", Start: "1"})
+	if err != nil {
+		t.Fatalf("ScanTag: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("prefix with start: got %v, want InvalidArgument", err)
+	}
+}
@@ -3,6 +3,7 @@ package indexnode
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"sort"
 
@@ -431,6 +432,15 @@ func (n *IndexNode) FindRange(searchKey []byte) ([]byte, bool) {
 	return nil, false
 }
 
+// EntryData returns the data section bytes for the entry at the given index
+// Returns nil if the node has no data section or the index is out of range
+func (n *IndexNode) EntryData(index int) []byte {
+	if !n.HasData || index < 0 || index >= len(n.Entries) {
+		return nil
+	}
+	return n.getDataAt(n.Entries[index].Offset)
+}
+
 // GetByIndex returns the value at the given index (for array-style access)
 func (n *IndexNode) GetByIndex(index int) ([]byte, bool) {
 	if index < 0 || index >= len(n.Entries) {
@@ -450,14 +460,43 @@ func NewFixedKeyNode(keySize uint16) *IndexNode {
 	return NewIndexNode(keySize, 32, false, false, false)
 }
 
+// DigestKeySize is the key width of value nodes for tags whose values are
+// digests, such as script hashes.
+const DigestKeySize = 32
+
+// ParseDigest decodes a tag value that is a DigestKeySize-byte digest in
+// lowercase hex. Value nodes of keys declared as digests are fixed-key nodes
+// keyed by the digest bytes, which sort in the same order as the hex.
+func ParseDigest(value string) ([]byte, bool) {
+	if len(value) != 2*DigestKeySize {
+		return nil, false
+	}
+	digest, err := hex.DecodeString(value)
+	if err != nil || hex.EncodeToString(digest) != value {
+		return nil, false
+	}
+	return digest, true
+}
+
 // NewArrayNode creates a node for ordered values with no keys (index-based access).
 func NewArrayNode(valueSize uint8) *IndexNode {
 	return NewIndexNode(0, valueSize, false, false, false)
 }
 
+// KeyValue pairs an entry's sort key with its value
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
 // ScanPrefix finds all entries whose sort key starts with the given prefix.
 // For SortByData nodes, searches the data section. For key-sorted nodes, searches keys.
 func (n *IndexNode) ScanPrefix(prefix []byte) [][]byte {
+	return values(n.ScanPrefixKeys(prefix))
+}
+
+// ScanPrefixKeys is ScanPrefix returning each match's sort key alongside its value.
+func (n *IndexNode) ScanPrefixKeys(prefix []byte) []KeyValue {
 	if len(n.Entries) == 0 || len(prefix) == 0 {
 		return nil
 	}
@@ -472,20 +511,26 @@ func (n *IndexNode) ScanPrefix(prefix []byte) [][]byte {
 		return bytes.Compare(getSortKey(i), prefix) >= 0
 	})
 
-	var results [][]byte
+	var results []KeyValue
 	for idx < len(n.Entries) {
 		key := getSortKey(idx)
-		if len(key) < len(prefix) || !bytes.Equal(key[:len(prefix)], prefix) {
+		if !bytes.HasPrefix(key, prefix) {
 			break
 		}
-		results = append(results, n.Entries[idx].Value)
+		results = append(results, KeyValue{Key: key, Value: n.Entries[idx].Value})
 		idx++
 	}
 	return results
 }
 
 // ScanRange returns all values for entries with sort key >= start and < end.
+// A nil end scans through the last entry.
 func (n *IndexNode) ScanRange(start, end []byte) [][]byte {
+	return values(n.ScanRangeKeys(start, end))
+}
+
+// ScanRangeKeys is ScanRange returning each match's sort key alongside its value.
+func (n *IndexNode) ScanRangeKeys(start, end []byte) []KeyValue {
 	if len(n.Entries) == 0 {
 		return nil
 	}
@@ -500,18 +545,29 @@ func (n *IndexNode) ScanRange(start, end []byte) [][]byte {
 		return bytes.Compare(getSortKey(i), start) >= 0
 	})
 
-	var results [][]byte
+	var results []KeyValue
 	for idx < len(n.Entries) {
 		key := getSortKey(idx)
-		if bytes.Compare(key, end) >= 0 {
+		if end != nil && bytes.Compare(key, end) >= 0 {
 			break
 		}
-		results = append(results, n.Entries[idx].Value)
+		results = append(results, KeyValue{Key: key, Value: n.Entries[idx].Value})
 		idx++
 	}
 	return results
 }
 
+func values(kvs []KeyValue) [][]byte {
+	if kvs == nil {
+		return nil
+	}
+	out := make([][]byte, len(kvs))
+	for i, kv := range kvs {
+		out[i] = kv.Value
+	}
+	return out
+}
+
 // sortKeyFunc returns a function that retrieves the sort key for entry at index i,
 // based on the node's configuration.
 func (n *IndexNode) sortKeyFunc() func(i int) []byte {
@@ -117,6 +117,58 @@ func TestTagNode_ScanRange(t *testing.T) {
 	}
 }
 
+func TestTagNode_ScanKeys(t *testing.T) {
+	keys := []string{"apple", "banana", "cherry", "apricot"}
+	values := make([][]byte, len(keys))
+	for i := range values {
+		values[i] = randHash()
+	}
+
+	node := buildTagNode(keys, values)
+
+	results := node.ScanPrefixKeys([]byte("ap"))
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results for prefix 'ap', got %d", len(results))
+	}
+	if string(results[0].Key) != "apple" || string(results[1].Key) != "apricot" {
+		t.Fatalf("expected [apple apricot], got [%s %s]", results[0].Key, results[1].Key)
+	}
+	if !bytes.Equal(results[1].Value, values[3]) {
+		t.Fatal("value mismatch for 'apricot'")
+	}
+
+	// Nil end scans to the last entry
+	results = node.ScanRangeKeys([]byte("b"), nil)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results from 'b' onwards, got %d", len(results))
+	}
+	if string(results[0].Key) != "banana" || string(results[1].Key) != "cherry" {
+		t.Fatalf("expected [banana cherry], got [%s %s]", results[0].Key, results[1].Key)
+	}
+}
+
+func TestTagNode_EntryData(t *testing.T) {
+	keys := []string{"cherry", "apple", "banana"}
+	values := make([][]byte, len(keys))
+	for i := range values {
+		values[i] = randHash()
+	}
+
+	node := buildTagNode(keys, values)
+
+	// Entries are sorted by data after buildTagNode
+	want := []string{"apple", "banana", "cherry"}
+	for i, w := range want {
+		if got := string(node.EntryData(i)); got != w {
+			t.Fatalf("entry %d: expected %q, got %q", i, w, got)
+		}
+	}
+
+	if node.EntryData(len(keys)) != nil {
+		t.Fatal("expected nil for out of range index")
+	}
+}
+
 func TestTagNode_MarshalRoundTrip(t *testing.T) {
 	keys := []string{"foo", "bar", "baz"}
 	values := make([][]byte, len(keys))
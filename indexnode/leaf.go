@@ -6,23 +6,39 @@ import (
 )
 
 type LeafEntry struct {
-	TxID            []byte   // 32 bytes
+	TxID            []byte // 32 bytes
 	SubtreePosition uint64
 	Vouts           []uint32
+	Vins            []uint32 // inputs, for tags derived from what a tx spends
 }
 
-func (e *LeafEntry) Marshal() []byte {
-	buf := make([]byte, 32+binary.MaxVarintLen64*(2+len(e.Vouts)))
+// leafVinsFlag is set in the count of a leaf entry list whose entries carry
+// input indices. Lists without inputs leave it clear and keep the original
+// layout, so existing leaves still decode and hash the same.
+const leafVinsFlag = 1 << 31
+
+// Marshal encodes the entry as txid | position | vout count | vouts, followed
+// by vin count | vins if withVins is set.
+func (e *LeafEntry) Marshal(withVins bool) []byte {
+	buf := make([]byte, 32+binary.MaxVarintLen64*(3+len(e.Vouts)+len(e.Vins)))
 	offset := copy(buf, e.TxID[:32])
 	offset += binary.PutUvarint(buf[offset:], e.SubtreePosition)
-	offset += binary.PutUvarint(buf[offset:], uint64(len(e.Vouts)))
-	for _, v := range e.Vouts {
-		offset += binary.PutUvarint(buf[offset:], uint64(v))
+	offset += putIndexes(buf[offset:], e.Vouts)
+	if withVins {
+		offset += putIndexes(buf[offset:], e.Vins)
 	}
 	return buf[:offset]
 }
 
-func UnmarshalLeafEntry(data []byte) (LeafEntry, int, error) {
+func putIndexes(buf []byte, indexes []uint32) int {
+	offset := binary.PutUvarint(buf, uint64(len(indexes)))
+	for _, v := range indexes {
+		offset += binary.PutUvarint(buf[offset:], uint64(v))
+	}
+	return offset
+}
+
+func UnmarshalLeafEntry(data []byte, withVins bool) (LeafEntry, int, error) {
 	if len(data) < 33 {
 		return LeafEntry{}, 0, fmt.Errorf("data too short: %d bytes", len(data))
 	}
@@ -39,31 +55,55 @@ func UnmarshalLeafEntry(data []byte) (LeafEntry, int, error) {
 	entry.SubtreePosition = pos
 	offset += n
 
-	count, n := binary.Uvarint(data[offset:])
+	entry.Vouts, n = readIndexes(data[offset:])
 	if n <= 0 {
-		return LeafEntry{}, 0, fmt.Errorf("invalid vout_count varint")
+		return LeafEntry{}, 0, fmt.Errorf("invalid vouts")
 	}
 	offset += n
 
-	entry.Vouts = make([]uint32, count)
-	for i := uint64(0); i < count; i++ {
-		v, n := binary.Uvarint(data[offset:])
+	if withVins {
+		entry.Vins, n = readIndexes(data[offset:])
 		if n <= 0 {
-			return LeafEntry{}, 0, fmt.Errorf("invalid vout varint at index %d", i)
+			return LeafEntry{}, 0, fmt.Errorf("invalid vins")
 		}
-		entry.Vouts[i] = uint32(v)
 		offset += n
 	}
 
 	return entry, offset, nil
 }
 
+// readIndexes reads a count-prefixed varint list, returning n <= 0 if it is
+// malformed.
+func readIndexes(data []byte) ([]uint32, int) {
+	count, offset := binary.Uvarint(data)
+	if offset <= 0 || count > uint64(len(data)) {
+		return nil, 0
+	}
+	indexes := make([]uint32, count)
+	for i := range indexes {
+		v, n := binary.Uvarint(data[offset:])
+		if n <= 0 {
+			return nil, 0
+		}
+		indexes[i] = uint32(v)
+		offset += n
+	}
+	return indexes, offset
+}
+
 func MarshalLeafEntryList(entries []LeafEntry) []byte {
-	countBuf := make([]byte, 4)
-	binary.BigEndian.PutUint32(countBuf, uint32(len(entries)))
-	buf := countBuf
+	count := uint32(len(entries))
+	withVins := false
+	for i := range entries {
+		if len(entries[i].Vins) > 0 {
+			withVins = true
+			count |= leafVinsFlag
+			break
+		}
+	}
+	buf := binary.BigEndian.AppendUint32(nil, count)
 	for i := range entries {
-		buf = append(buf, entries[i].Marshal()...)
+		buf = append(buf, entries[i].Marshal(withVins)...)
 	}
 	return buf
 }
@@ -73,10 +113,12 @@ func UnmarshalLeafEntryList(data []byte) ([]LeafEntry, error) {
 		return nil, fmt.Errorf("data too short for count: %d bytes", len(data))
 	}
 	count := binary.BigEndian.Uint32(data[:4])
+	withVins := count&leafVinsFlag != 0
+	count &^= leafVinsFlag
 	offset := 4
 	entries := make([]LeafEntry, count)
 	for i := uint32(0); i < count; i++ {
-		entry, n, err := UnmarshalLeafEntry(data[offset:])
+		entry, n, err := UnmarshalLeafEntry(data[offset:], withVins)
 		if err != nil {
 			return nil, fmt.Errorf("entry %d: %w", i, err)
 		}
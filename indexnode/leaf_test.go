@@ -14,9 +14,9 @@ func TestLeafEntryMarshalUnmarshal(t *testing.T) {
 		Vouts:           []uint32{0, 3, 7},
 	}
 
-	data := entry.Marshal()
+	data := entry.Marshal(false)
 
-	decoded, bytesRead, err := UnmarshalLeafEntry(data)
+	decoded, bytesRead, err := UnmarshalLeafEntry(data, false)
 	if err != nil {
 		t.Fatalf("unmarshal error: %v", err)
 	}
@@ -67,9 +67,34 @@ func TestLeafEntryCompactSize(t *testing.T) {
 		SubtreePosition: 0,
 		Vouts:           []uint32{0},
 	}
-	data := entry.Marshal()
+	data := entry.Marshal(false)
 	// txid(32) + position varint(1) + count varint(1) + vout varint(1) = 35 bytes
 	if len(data) != 35 {
 		t.Errorf("compact: got %d bytes, want 35", len(data))
 	}
 }
+
+func TestLeafEntryListVins(t *testing.T) {
+	entries := []LeafEntry{
+		{TxID: make([]byte, 32), SubtreePosition: 1, Vouts: []uint32{0}},
+		{TxID: make([]byte, 32), SubtreePosition: 2, Vins: []uint32{0, 3}},
+	}
+	data := MarshalLeafEntryList(entries)
+
+	decoded, err := UnmarshalLeafEntryList(data)
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if len(decoded) != 2 || len(decoded[0].Vins) != 0 || len(decoded[1].Vouts) != 0 {
+		t.Fatalf("decoded: %+v", decoded)
+	}
+	if len(decoded[1].Vins) != 2 || decoded[1].Vins[0] != 0 || decoded[1].Vins[1] != 3 {
+		t.Errorf("vins mismatch: got %v", decoded[1].Vins)
+	}
+
+	// Lists without inputs keep the original layout
+	outputsOnly := MarshalLeafEntryList(entries[:1])
+	if want := append([]byte{0, 0, 0, 1}, entries[0].Marshal(false)...); !bytes.Equal(outputsOnly, want) {
+		t.Errorf("outputs-only layout: got %x, want %x", outputsOnly, want)
+	}
+}
@@ -2,18 +2,69 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"time"
 
 	kafkamessage "github.com/bsv-blockchain/teranode/util/kafka/kafka_message"
 	"github.com/segmentio/kafka-go"
 	"google.golang.org/protobuf/proto"
 )
 
+// Teranode topics consumed by the indexer. Blocks, txmeta and rejected-tx
+// are only consumed if a handler is registered for them.
+const (
+	SubtreesTopic    = "subtrees"
+	BlocksFinalTopic = "blocks-final"
+	BlocksTopic      = "blocks"
+	TxMetaTopic      = "txmeta"
+	RejectedTxTopic  = "rejectedtx"
+)
+
+// ErrPermanent marks handler errors that retrying cannot fix, such as an
+// invalid block, so the message is dead-lettered without retrying.
+var ErrPermanent = errors.New("permanent failure")
+
+// errMalformed marks messages that can never be handled, so they are
+// dead-lettered without retrying.
+var errMalformed = fmt.Errorf("%w: malformed message", ErrPermanent)
+
 // SubtreeHandler is called for each subtree message consumed from Kafka.
 type SubtreeHandler func(ctx context.Context, subtreeHash string, fetchURL string) error
 
 // BlockHandler is called for each block-final message consumed from Kafka.
-type BlockHandler func(ctx context.Context, height uint32, headerBytes []byte, subtreeHashes [][]byte, txCount uint64) error
+type BlockHandler func(ctx context.Context, height uint32, headerBytes []byte, coinbaseTx []byte, subtreeHashes [][]byte, txCount uint64) error
+
+// BlockNoticeHandler is called for each block announced on the blocks topic,
+// ahead of its blocks-final message.
+type BlockNoticeHandler func(ctx context.Context, blockHash string, url string) error
+
+// TxMetaHandler is called for each entry of a txmeta message: a transaction
+// Teranode has validated, or removed from its txmeta cache if deleted.
+type TxMetaHandler func(ctx context.Context, txid [32]byte, deleted bool) error
+
+// RejectedTxHandler is called for each transaction Teranode rejects.
+type RejectedTxHandler func(ctx context.Context, txHash string, reason string) error
+
+type Config struct {
+	// MaxAttempts is how many times a message is handled before it is
+	// dead-lettered. Values below 1 are treated as 1.
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry, doubling on each
+	// further attempt.
+	RetryBackoff time.Duration
+	// DeadLetters receives messages that fail every attempt or cannot be
+	// decoded. If nil they are logged and skipped.
+	DeadLetters DeadLetterQueue
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:  5,
+		RetryBackoff: time.Second,
+	}
+}
 
 // Consumer reads from Teranode's "subtrees" and "blocks-final" Kafka topics.
 type Consumer struct {
@@ -21,36 +72,79 @@ type Consumer struct {
 	groupID        string
 	subtreeHandler SubtreeHandler
 	blockHandler   BlockHandler
+	config         Config
 	logger         *slog.Logger
+
+	blockNoticeHandler BlockNoticeHandler
+	txMetaHandler      TxMetaHandler
+	rejectedTxHandler  RejectedTxHandler
 }
 
 // NewConsumer creates a new Kafka consumer for Teranode topics.
-func NewConsumer(brokers []string, groupID string, subtreeHandler SubtreeHandler, blockHandler BlockHandler, logger *slog.Logger) *Consumer {
+func NewConsumer(brokers []string, groupID string, subtreeHandler SubtreeHandler, blockHandler BlockHandler, config Config, logger *slog.Logger) *Consumer {
 	return &Consumer{
 		brokers:        brokers,
 		groupID:        groupID,
 		subtreeHandler: subtreeHandler,
 		blockHandler:   blockHandler,
+		config:         config,
 		logger:         logger,
 	}
 }
 
-// Run starts consuming from both topics. It blocks until ctx is cancelled.
+// OnBlockNotice consumes the blocks topic, passing announcements to h.
+// Handlers must be registered before Run.
+func (c *Consumer) OnBlockNotice(h BlockNoticeHandler) { c.blockNoticeHandler = h }
+
+// OnTxMeta consumes the txmeta topic, passing each entry to h.
+func (c *Consumer) OnTxMeta(h TxMetaHandler) { c.txMetaHandler = h }
+
+// OnRejectedTx consumes the rejected-tx topic, passing each rejection to h.
+func (c *Consumer) OnRejectedTx(h RejectedTxHandler) { c.rejectedTxHandler = h }
+
+// Run starts consuming from the subtrees and blocks-final topics, and any
+// optional topics with a handler. It blocks until ctx is cancelled.
 func (c *Consumer) Run(ctx context.Context) error {
-	errc := make(chan error, 2)
+	topics := []string{SubtreesTopic, BlocksFinalTopic}
+	if c.blockNoticeHandler != nil {
+		topics = append(topics, BlocksTopic)
+	}
+	if c.txMetaHandler != nil {
+		topics = append(topics, TxMetaTopic)
+	}
+	if c.rejectedTxHandler != nil {
+		topics = append(topics, RejectedTxTopic)
+	}
 
-	go func() { errc <- c.consumeSubtrees(ctx) }()
-	go func() { errc <- c.consumeBlocks(ctx) }()
+	errc := make(chan error, len(topics))
+	for _, topic := range topics {
+		go func() { errc <- c.consume(ctx, topic) }()
+	}
 
-	// Return the first error (context cancellation propagates to both).
+	// Return the first error (context cancellation propagates to all).
 	return <-errc
 }
 
-func (c *Consumer) consumeSubtrees(ctx context.Context) error {
+// ReplayDeadLetters hands each message in the dead-letter queue to the
+// handlers once, removing those that now succeed.
+func (c *Consumer) ReplayDeadLetters(ctx context.Context) (replayed, failed int, err error) {
+	if c.config.DeadLetters == nil {
+		return 0, 0, errors.New("no dead-letter queue configured")
+	}
+	return c.config.DeadLetters.Replay(ctx, func(ctx context.Context, dl DeadLetter) error {
+		err := c.handle(ctx, dl.Topic, dl.Value)
+		if err != nil {
+			c.logger.Warn("replay dead letter", "topic", dl.Topic, "offset", dl.Offset, "error", err)
+		}
+		return err
+	})
+}
+
+func (c *Consumer) consume(ctx context.Context, topic string) error {
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  c.brokers,
 		GroupID:  c.groupID,
-		Topic:    "subtrees",
+		Topic:    topic,
 		MinBytes: 1,
 		MaxBytes: 10e6,
 	})
@@ -62,18 +156,8 @@ func (c *Consumer) consumeSubtrees(ctx context.Context) error {
 			return err
 		}
 
-		var pb kafkamessage.KafkaSubtreeTopicMessage
-		if err := proto.Unmarshal(msg.Value, &pb); err != nil {
-			c.logger.Error("unmarshal subtree message", "error", err, "offset", msg.Offset)
-			if err := r.CommitMessages(ctx, msg); err != nil {
-				return err
-			}
-			continue
-		}
-
-		if err := c.subtreeHandler(ctx, pb.GetHash(), pb.GetURL()); err != nil {
-			c.logger.Error("handle subtree", "error", err, "hash", pb.GetHash())
-			continue
+		if err := c.process(ctx, msg); err != nil {
+			return err
 		}
 
 		if err := r.CommitMessages(ctx, msg); err != nil {
@@ -82,38 +166,113 @@ func (c *Consumer) consumeSubtrees(ctx context.Context) error {
 	}
 }
 
-func (c *Consumer) consumeBlocks(ctx context.Context) error {
-	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  c.brokers,
-		GroupID:  c.groupID,
-		Topic:    "blocks-final",
-		MinBytes: 1,
-		MaxBytes: 10e6,
-	})
-	defer r.Close()
+// process handles msg, retrying with backoff and dead-lettering it once
+// MaxAttempts is exhausted. An error means the message was neither handled
+// nor dead-lettered and must not be committed.
+func (c *Consumer) process(ctx context.Context, msg kafka.Message) error {
+	maxAttempts := max(c.config.MaxAttempts, 1)
+	backoff := c.config.RetryBackoff
 
-	for {
-		msg, err := r.FetchMessage(ctx)
-		if err != nil {
-			return err
+	var err error
+	attempts := 0
+	for attempts < maxAttempts {
+		attempts++
+		if err = c.handle(ctx, msg.Topic, msg.Value); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
+		if errors.Is(err, ErrPermanent) {
+			break
+		}
+		c.logger.Warn("handle message", "topic", msg.Topic, "offset", msg.Offset, "attempt", attempts, "error", err)
+		if attempts < maxAttempts {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+
+	c.logger.Error("dead-lettering message", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "attempts", attempts, "error", err)
+	if c.config.DeadLetters == nil {
+		return nil
+	}
+	dl := DeadLetter{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Error:     err.Error(),
+		Attempts:  attempts,
+		FailedAt:  time.Now(),
+	}
+	if err := c.config.DeadLetters.Put(ctx, dl); err != nil {
+		return fmt.Errorf("dead-letter %s offset %d: %w", msg.Topic, msg.Offset, err)
+	}
+	return nil
+}
 
+// handle decodes a message from topic and passes it to its handler.
+func (c *Consumer) handle(ctx context.Context, topic string, value []byte) error {
+	switch topic {
+	case SubtreesTopic:
+		var pb kafkamessage.KafkaSubtreeTopicMessage
+		if err := proto.Unmarshal(value, &pb); err != nil {
+			return fmt.Errorf("%w: unmarshal subtree message: %v", errMalformed, err)
+		}
+		if err := c.subtreeHandler(ctx, pb.GetHash(), pb.GetURL()); err != nil {
+			return fmt.Errorf("handle subtree %s: %w", pb.GetHash(), err)
+		}
+	case BlocksFinalTopic:
 		var pb kafkamessage.KafkaBlocksFinalTopicMessage
-		if err := proto.Unmarshal(msg.Value, &pb); err != nil {
-			c.logger.Error("unmarshal blocks-final message", "error", err, "offset", msg.Offset)
-			if err := r.CommitMessages(ctx, msg); err != nil {
-				return err
+		if err := proto.Unmarshal(value, &pb); err != nil {
+			return fmt.Errorf("%w: unmarshal blocks-final message: %v", errMalformed, err)
+		}
+		if err := c.blockHandler(ctx, pb.GetHeight(), pb.GetHeader(), pb.GetCoinbaseTx(), pb.GetSubtreeHashes(), pb.GetTransactionCount()); err != nil {
+			return fmt.Errorf("handle block %d: %w", pb.GetHeight(), err)
+		}
+	case BlocksTopic:
+		if c.blockNoticeHandler == nil {
+			return nil
+		}
+		var pb kafkamessage.KafkaBlockTopicMessage
+		if err := proto.Unmarshal(value, &pb); err != nil {
+			return fmt.Errorf("%w: unmarshal blocks message: %v", errMalformed, err)
+		}
+		if err := c.blockNoticeHandler(ctx, pb.GetHash(), pb.GetURL()); err != nil {
+			return fmt.Errorf("handle block notice %s: %w", pb.GetHash(), err)
+		}
+	case TxMetaTopic:
+		if c.txMetaHandler == nil {
+			return nil
+		}
+		entries, err := parseTxMetaBatch(value)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errMalformed, err)
+		}
+		for _, e := range entries {
+			if err := c.txMetaHandler(ctx, e.txid, e.deleted); err != nil {
+				return fmt.Errorf("handle txmeta %x: %w", e.txid[:8], err)
 			}
-			continue
 		}
-
-		if err := c.blockHandler(ctx, pb.GetHeight(), pb.GetHeader(), pb.GetSubtreeHashes(), pb.GetTransactionCount()); err != nil {
-			c.logger.Error("handle block", "error", err, "height", pb.GetHeight())
-			continue
+	case RejectedTxTopic:
+		if c.rejectedTxHandler == nil {
+			return nil
 		}
-
-		if err := r.CommitMessages(ctx, msg); err != nil {
-			return err
+		var pb kafkamessage.KafkaRejectedTxTopicMessage
+		if err := proto.Unmarshal(value, &pb); err != nil {
+			return fmt.Errorf("%w: unmarshal rejected tx message: %v", errMalformed, err)
+		}
+		if err := c.rejectedTxHandler(ctx, pb.GetTxHash(), pb.GetReason()); err != nil {
+			return fmt.Errorf("handle rejected tx %s: %w", pb.GetTxHash(), err)
 		}
+	default:
+		return fmt.Errorf("%w: unknown topic %q", errMalformed, topic)
 	}
+	return nil
 }
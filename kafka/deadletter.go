@@ -0,0 +1,300 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DeadLetter is a message that could not be handled, with the last error.
+type DeadLetter struct {
+	Topic     string    `json:"topic"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       []byte    `json:"key,omitempty"`
+	Value     []byte    `json:"value"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	FailedAt  time.Time `json:"failedAt"`
+}
+
+// ReplayFunc handles a dead letter during replay.
+type ReplayFunc func(ctx context.Context, dl DeadLetter) error
+
+// DeadLetterQueue holds messages that failed every attempt so they can be
+// replayed later.
+type DeadLetterQueue interface {
+	Put(ctx context.Context, dl DeadLetter) error
+	// Replay calls fn for each queued dead letter. Those fn handles are
+	// removed; the rest stay queued with the new error and attempt count.
+	Replay(ctx context.Context, fn ReplayFunc) (replayed, failed int, err error)
+	Close() error
+}
+
+// FileQueue keeps dead letters as one JSON file each in a local directory.
+type FileQueue struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileQueue creates a dead-letter queue in dir, creating it if needed.
+func NewFileQueue(dir string) (*FileQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create dead-letter dir: %w", err)
+	}
+	return &FileQueue{dir: dir}, nil
+}
+
+func (q *FileQueue) Put(_ context.Context, dl DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.write(dl)
+}
+
+// write stores dl under a name derived from its position in the source
+// topic, replacing an earlier copy. The file is renamed into place so
+// readers never see it partially written.
+func (q *FileQueue) write(dl DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("marshal dead letter: %w", err)
+	}
+	name := filepath.Join(q.dir, fileName(dl))
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	return nil
+}
+
+// Replay handles dead letters in the order they failed.
+func (q *FileQueue) Replay(ctx context.Context, fn ReplayFunc) (replayed, failed int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letters, err := q.load()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, l := range letters {
+		if err := ctx.Err(); err != nil {
+			return replayed, failed, err
+		}
+		if herr := fn(ctx, l.DeadLetter); herr != nil {
+			failed++
+			l.Attempts++
+			l.Error = herr.Error()
+			l.FailedAt = time.Now()
+			if err := q.write(l.DeadLetter); err != nil {
+				return replayed, failed, err
+			}
+			continue
+		}
+		replayed++
+		if err := os.Remove(l.path); err != nil {
+			return replayed, failed, fmt.Errorf("remove dead letter: %w", err)
+		}
+	}
+	return replayed, failed, nil
+}
+
+// List returns the queued dead letters in the order they failed.
+func (q *FileQueue) List() ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letters, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DeadLetter, len(letters))
+	for i, l := range letters {
+		out[i] = l.DeadLetter
+	}
+	return out, nil
+}
+
+func (q *FileQueue) Close() error { return nil }
+
+type storedLetter struct {
+	DeadLetter
+	path string
+}
+
+func (q *FileQueue) load() ([]storedLetter, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dead-letter dir: %w", err)
+	}
+	var letters []storedLetter
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(q.dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read dead letter: %w", err)
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(data, &dl); err != nil {
+			return nil, fmt.Errorf("decode dead letter %s: %w", e.Name(), err)
+		}
+		letters = append(letters, storedLetter{DeadLetter: dl, path: path})
+	}
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters, nil
+}
+
+func fileName(dl DeadLetter) string {
+	return fmt.Sprintf("%s-%d-%d.json", dl.Topic, dl.Partition, dl.Offset)
+}
+
+// Header keys carrying a dead letter's metadata on a dead-letter topic.
+const (
+	headerTopic     = "dlq-topic"
+	headerPartition = "dlq-partition"
+	headerOffset    = "dlq-offset"
+	headerError     = "dlq-error"
+	headerAttempts  = "dlq-attempts"
+	headerFailedAt  = "dlq-failed-at"
+)
+
+// TopicQueue publishes dead letters to a Kafka topic, with the original
+// topic, position and error in message headers.
+type TopicQueue struct {
+	brokers []string
+	topic   string
+	groupID string
+	writer  *kafka.Writer
+
+	// Idle is how long Replay waits for another message before concluding
+	// the topic is drained.
+	Idle time.Duration
+}
+
+// NewTopicQueue creates a dead-letter queue on topic. Replay consumes it as
+// groupID, so progress is kept between replays.
+func NewTopicQueue(brokers []string, topic, groupID string) *TopicQueue {
+	return &TopicQueue{
+		brokers: brokers,
+		topic:   topic,
+		groupID: groupID,
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Topic:                  topic,
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		},
+		Idle: 5 * time.Second,
+	}
+}
+
+func (q *TopicQueue) Put(ctx context.Context, dl DeadLetter) error {
+	if err := q.writer.WriteMessages(ctx, encodeDeadLetter(dl)); err != nil {
+		return fmt.Errorf("publish dead letter: %w", err)
+	}
+	return nil
+}
+
+// Replay consumes the topic until it has been idle for q.Idle or reaches a
+// message published after the replay started. Dead letters that fail again
+// are republished to the end of the topic.
+func (q *TopicQueue) Replay(ctx context.Context, fn ReplayFunc) (replayed, failed int, err error) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  q.brokers,
+		GroupID:  q.groupID,
+		Topic:    q.topic,
+		MinBytes: 1,
+		MaxBytes: 10e6,
+	})
+	defer r.Close()
+
+	start := time.Now()
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, q.Idle)
+		msg, err := r.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				return replayed, failed, nil
+			}
+			return replayed, failed, err
+		}
+		if msg.Time.After(start) {
+			return replayed, failed, nil
+		}
+
+		dl := decodeDeadLetter(msg)
+		if herr := fn(ctx, dl); herr != nil {
+			failed++
+			dl.Attempts++
+			dl.Error = herr.Error()
+			dl.FailedAt = time.Now()
+			if err := q.Put(ctx, dl); err != nil {
+				return replayed, failed, err
+			}
+		} else {
+			replayed++
+		}
+		if err := r.CommitMessages(ctx, msg); err != nil {
+			return replayed, failed, err
+		}
+	}
+}
+
+func (q *TopicQueue) Close() error {
+	return q.writer.Close()
+}
+
+func encodeDeadLetter(dl DeadLetter) kafka.Message {
+	return kafka.Message{
+		Key:   dl.Key,
+		Value: dl.Value,
+		Headers: []kafka.Header{
+			{Key: headerTopic, Value: []byte(dl.Topic)},
+			{Key: headerPartition, Value: []byte(strconv.Itoa(dl.Partition))},
+			{Key: headerOffset, Value: []byte(strconv.FormatInt(dl.Offset, 10))},
+			{Key: headerError, Value: []byte(dl.Error)},
+			{Key: headerAttempts, Value: []byte(strconv.Itoa(dl.Attempts))},
+			{Key: headerFailedAt, Value: []byte(dl.FailedAt.UTC().Format(time.RFC3339Nano))},
+		},
+	}
+}
+
+func decodeDeadLetter(msg kafka.Message) DeadLetter {
+	dl := DeadLetter{Key: msg.Key, Value: msg.Value}
+	for _, h := range msg.Headers {
+		v := string(h.Value)
+		switch h.Key {
+		case headerTopic:
+			dl.Topic = v
+		case headerPartition:
+			dl.Partition, _ = strconv.Atoi(v)
+		case headerOffset:
+			dl.Offset, _ = strconv.ParseInt(v, 10, 64)
+		case headerError:
+			dl.Error = v
+		case headerAttempts:
+			dl.Attempts, _ = strconv.Atoi(v)
+		case headerFailedAt:
+			dl.FailedAt, _ = time.Parse(time.RFC3339Nano, v)
+		}
+	}
+	return dl
+}
@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	kafkamessage "github.com/bsv-blockchain/teranode/util/kafka/kafka_message"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+)
+
+func subtreeMessage(t *testing.T, hash string, offset int64) kafka.Message {
+	t.Helper()
+	value, err := proto.Marshal(&kafkamessage.KafkaSubtreeTopicMessage{Hash: hash, URL: "http://teranode/" + hash})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return kafka.Message{Topic: SubtreesTopic, Partition: 2, Offset: offset, Value: value}
+}
+
+func newTestConsumer(t *testing.T, handler SubtreeHandler) (*Consumer, *FileQueue) {
+	t.Helper()
+	q, err := NewFileQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileQueue: %v", err)
+	}
+	c := NewConsumer(nil, "test", handler, nil, Config{MaxAttempts: 3, DeadLetters: q}, slog.Default())
+	return c, q
+}
+
+func TestProcessRetriesThenDeadLetters(t *testing.T) {
+	calls := 0
+	c, q := newTestConsumer(t, func(ctx context.Context, hash, url string) error {
+		calls++
+		return errors.New("teranode down")
+	})
+
+	if err := c.process(context.Background(), subtreeMessage(t, "aa", 7)); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("handler calls: got %d, want 3", calls)
+	}
+
+	letters, err := q.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("dead letters: got %d, want 1", len(letters))
+	}
+	dl := letters[0]
+	if dl.Topic != SubtreesTopic || dl.Partition != 2 || dl.Offset != 7 || dl.Attempts != 3 {
+		t.Errorf("dead letter: %+v", dl)
+	}
+	if dl.Error != "handle subtree aa: teranode down" {
+		t.Errorf("error: got %q", dl.Error)
+	}
+}
+
+func TestProcessRecoversOnRetry(t *testing.T) {
+	calls := 0
+	c, q := newTestConsumer(t, func(ctx context.Context, hash, url string) error {
+		calls++
+		if calls < 2 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+
+	if err := c.process(context.Background(), subtreeMessage(t, "aa", 1)); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if letters, _ := q.List(); len(letters) != 0 {
+		t.Errorf("dead letters: got %d, want 0", len(letters))
+	}
+}
+
+func TestProcessMalformedSkipsRetries(t *testing.T) {
+	calls := 0
+	c, q := newTestConsumer(t, func(ctx context.Context, hash, url string) error {
+		calls++
+		return nil
+	})
+
+	msg := kafka.Message{Topic: SubtreesTopic, Offset: 3, Value: []byte{0xff, 0xff}}
+	if err := c.process(context.Background(), msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	letters, _ := q.List()
+	if calls != 0 || len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Errorf("calls %d, dead letters %+v", calls, letters)
+	}
+}
+
+func TestProcessPermanentSkipsRetries(t *testing.T) {
+	calls := 0
+	c, q := newTestConsumer(t, func(ctx context.Context, hash, url string) error {
+		calls++
+		return fmt.Errorf("%w: invalid block", ErrPermanent)
+	})
+
+	if err := c.process(context.Background(), subtreeMessage(t, "aa", 4)); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	letters, _ := q.List()
+	if calls != 1 || len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Errorf("calls %d, dead letters %+v", calls, letters)
+	}
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	fail := map[string]bool{"aa": true, "bb": true}
+	c, q := newTestConsumer(t, func(ctx context.Context, hash, url string) error {
+		if fail[hash] {
+			return errors.New("still failing")
+		}
+		return nil
+	})
+	ctx := context.Background()
+	for i, hash := range []string{"aa", "bb"} {
+		if err := c.process(ctx, subtreeMessage(t, hash, int64(i))); err != nil {
+			t.Fatalf("process: %v", err)
+		}
+	}
+
+	// Only bb is fixed, so aa stays queued with another attempt recorded
+	delete(fail, "bb")
+	replayed, failed, err := c.ReplayDeadLetters(ctx)
+	if err != nil {
+		t.Fatalf("ReplayDeadLetters: %v", err)
+	}
+	if replayed != 1 || failed != 1 {
+		t.Errorf("replayed %d, failed %d", replayed, failed)
+	}
+
+	letters, _ := q.List()
+	if len(letters) != 1 || letters[0].Offset != 0 || letters[0].Attempts != 4 {
+		t.Fatalf("remaining dead letters: %+v", letters)
+	}
+
+	delete(fail, "aa")
+	if replayed, failed, _ := c.ReplayDeadLetters(ctx); replayed != 1 || failed != 0 {
+		t.Errorf("second replay: replayed %d, failed %d", replayed, failed)
+	}
+	if letters, _ := q.List(); len(letters) != 0 {
+		t.Errorf("dead letters after replay: %d", len(letters))
+	}
+}
+
+func TestDeadLetterHeadersRoundtrip(t *testing.T) {
+	msg := subtreeMessage(t, "aa", 9)
+	dl := DeadLetter{Topic: msg.Topic, Partition: 2, Offset: 9, Key: []byte("k"), Value: msg.Value, Error: "boom", Attempts: 5}
+
+	got := decodeDeadLetter(encodeDeadLetter(dl))
+	if got.Topic != dl.Topic || got.Partition != 2 || got.Offset != 9 || got.Error != "boom" || got.Attempts != 5 ||
+		string(got.Key) != "k" || string(got.Value) != string(dl.Value) {
+		t.Errorf("roundtrip: got %+v", got)
+	}
+}
@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Actions of a txmeta batch entry.
+const (
+	txMetaAdd    = 0
+	txMetaDelete = 1
+)
+
+type txMetaEntry struct {
+	txid    [32]byte
+	deleted bool
+}
+
+// parseTxMetaBatch decodes the batch format Teranode's validator publishes
+// to the txmeta topic. The metadata itself (fee, size, parents) is skipped.
+//
+// Format: 4b entry count | per entry: 32b tx hash | 1b action | 4b content length | content
+func parseTxMetaBatch(data []byte) ([]txMetaEntry, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("txmeta batch too short: %d bytes", len(data))
+	}
+	count := binary.LittleEndian.Uint32(data[:4])
+	offset := 4
+
+	entries := make([]txMetaEntry, 0, min(int(count), len(data)/37))
+	for i := uint32(0); i < count; i++ {
+		if len(data) < offset+37 {
+			return nil, fmt.Errorf("txmeta batch truncated at entry %d", i)
+		}
+		var e txMetaEntry
+		copy(e.txid[:], data[offset:offset+32])
+		switch data[offset+32] {
+		case txMetaAdd:
+		case txMetaDelete:
+			e.deleted = true
+		default:
+			return nil, fmt.Errorf("txmeta entry %d: unknown action %d", i, data[offset+32])
+		}
+		size := int(binary.LittleEndian.Uint32(data[offset+33 : offset+37]))
+		offset += 37
+		if len(data)-offset < size {
+			return nil, fmt.Errorf("txmeta batch truncated at entry %d", i)
+		}
+		offset += size
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"testing"
+
+	kafkamessage "github.com/bsv-blockchain/teranode/util/kafka/kafka_message"
+	"google.golang.org/protobuf/proto"
+)
+
+func txMetaBatch(deleted ...bool) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(deleted)))
+	for i, del := range deleted {
+		buf = append(buf, bytes.Repeat([]byte{byte(i + 1)}, 32)...)
+		if del {
+			buf = append(buf, txMetaDelete)
+			buf = binary.LittleEndian.AppendUint32(buf, 0)
+		} else {
+			content := make([]byte, 25)
+			buf = append(buf, txMetaAdd)
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(content)))
+			buf = append(buf, content...)
+		}
+	}
+	return buf
+}
+
+func TestParseTxMetaBatch(t *testing.T) {
+	entries, err := parseTxMetaBatch(txMetaBatch(false, true, false))
+	if err != nil {
+		t.Fatalf("parseTxMetaBatch: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("entries: got %d, want 3", len(entries))
+	}
+	for i, e := range entries {
+		if e.txid[0] != byte(i+1) || e.deleted != (i == 1) {
+			t.Errorf("entry %d: %x deleted=%v", i, e.txid[:2], e.deleted)
+		}
+	}
+
+	batch := txMetaBatch(false, false)
+	if _, err := parseTxMetaBatch(batch[:len(batch)-1]); err == nil {
+		t.Error("expected error for truncated batch")
+	}
+}
+
+func TestHandleOptionalTopics(t *testing.T) {
+	c := NewConsumer(nil, "test", nil, nil, DefaultConfig(), slog.Default())
+	ctx := context.Background()
+
+	// Without handlers, optional topics are ignored
+	if err := c.handle(ctx, TxMetaTopic, []byte{0xff}); err != nil {
+		t.Errorf("unregistered txmeta: %v", err)
+	}
+
+	var announced, rejected string
+	var txmeta []bool
+	c.OnBlockNotice(func(ctx context.Context, hash, url string) error { announced = hash; return nil })
+	c.OnTxMeta(func(ctx context.Context, txid [32]byte, deleted bool) error {
+		txmeta = append(txmeta, deleted)
+		return nil
+	})
+	c.OnRejectedTx(func(ctx context.Context, hash, reason string) error { rejected = hash + ":" + reason; return nil })
+
+	block, _ := proto.Marshal(&kafkamessage.KafkaBlockTopicMessage{Hash: "b1", URL: "http://teranode/block/b1"})
+	if err := c.handle(ctx, BlocksTopic, block); err != nil || announced != "b1" {
+		t.Errorf("blocks: %q, %v", announced, err)
+	}
+	if err := c.handle(ctx, TxMetaTopic, txMetaBatch(false, true)); err != nil || len(txmeta) != 2 || !txmeta[1] {
+		t.Errorf("txmeta: %v, %v", txmeta, err)
+	}
+	rej, _ := proto.Marshal(&kafkamessage.KafkaRejectedTxTopicMessage{TxHash: "t1", Reason: "double spend"})
+	if err := c.handle(ctx, RejectedTxTopic, rej); err != nil || rejected != "t1:double spend" {
+		t.Errorf("rejected: %q, %v", rejected, err)
+	}
+}
@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shruggr/inspiration/metadata"
+)
+
+func (s *SQLiteStore) QueueBlock(ctx context.Context, block metadata.QueuedBlock) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT OR IGNORE INTO queued_blocks (block_hash, height, header, coinbase_tx, tx_count) VALUES (?, ?, ?, ?, ?)`,
+		block.Hash, block.Height, block.Header, block.CoinbaseTx, block.TxCount,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue block: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	for i, sh := range block.SubtreeHashes {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO queued_block_subtrees (block_hash, subtree_index, subtree_hash) VALUES (?, ?, ?)`,
+			block.Hash, i, sh,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert queued_block_subtree %d: %w", i, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetQueuedBlocks(ctx context.Context) ([]metadata.QueuedBlock, error) {
+	return s.queryQueuedBlocks(ctx, `
+		SELECT block_hash, height, header, coinbase_tx, tx_count, queued_at
+		FROM queued_blocks
+		ORDER BY height, block_hash`)
+}
+
+func (s *SQLiteStore) GetQueuedBlocksBySubtree(ctx context.Context, subtreeHash []byte) ([]metadata.QueuedBlock, error) {
+	return s.queryQueuedBlocks(ctx, `
+		SELECT block_hash, height, header, coinbase_tx, tx_count, queued_at
+		FROM queued_blocks
+		WHERE block_hash IN (SELECT block_hash FROM queued_block_subtrees WHERE subtree_hash = ?)
+		ORDER BY height, block_hash`, subtreeHash)
+}
+
+// queryQueuedBlocks loads the queued blocks selected by query, then fills in
+// their subtrees and which of those are still missing.
+func (s *SQLiteStore) queryQueuedBlocks(ctx context.Context, query string, args ...any) ([]metadata.QueuedBlock, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []metadata.QueuedBlock
+	for rows.Next() {
+		var b metadata.QueuedBlock
+		var queuedAt int64
+		if err := rows.Scan(&b.Hash, &b.Height, &b.Header, &b.CoinbaseTx, &b.TxCount, &queuedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		b.QueuedAt = time.Unix(queuedAt, 0)
+		blocks = append(blocks, b)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range blocks {
+		if err := s.loadQueuedSubtrees(ctx, &blocks[i]); err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+func (s *SQLiteStore) loadQueuedSubtrees(ctx context.Context, b *metadata.QueuedBlock) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT q.subtree_hash, s.subtree_hash IS NOT NULL
+		FROM queued_block_subtrees q
+		LEFT JOIN subtrees s ON s.subtree_hash = q.subtree_hash
+		WHERE q.block_hash = ?
+		ORDER BY q.subtree_index`, b.Hash)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h []byte
+		var indexed bool
+		if err := rows.Scan(&h, &indexed); err != nil {
+			return err
+		}
+		b.SubtreeHashes = append(b.SubtreeHashes, h)
+		if !indexed {
+			b.Missing = append(b.Missing, h)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteStore) DequeueBlock(ctx context.Context, blockHash []byte) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM queued_blocks WHERE block_hash = ?`,
+		blockHash,
+	)
+	return err
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/shruggr/inspiration/metadata"
 )
 
 type SQLiteStore struct {
@@ -64,6 +66,35 @@ func (s *SQLiteStore) initSchema() error {
 		block_hash      BLOB,
 		promoted        INTEGER DEFAULT 0
 	);
+
+	CREATE TABLE IF NOT EXISTS coinbase_paths (
+		subtree_hash    BLOB PRIMARY KEY,
+		path            BLOB NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS queued_blocks (
+		block_hash      BLOB PRIMARY KEY,
+		height          INTEGER NOT NULL,
+		header          BLOB NOT NULL,
+		coinbase_tx     BLOB,
+		tx_count        INTEGER NOT NULL,
+		queued_at       INTEGER DEFAULT (strftime('%s', 'now'))
+	);
+
+	CREATE TABLE IF NOT EXISTS queued_block_subtrees (
+		block_hash      BLOB NOT NULL,
+		subtree_index   INTEGER NOT NULL,
+		subtree_hash    BLOB NOT NULL,
+		PRIMARY KEY (block_hash, subtree_index),
+		FOREIGN KEY (block_hash) REFERENCES queued_blocks(block_hash) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_queued_block_subtrees_hash ON queued_block_subtrees(subtree_hash);
+
+	CREATE TABLE IF NOT EXISTS checkpoints (
+		name            TEXT PRIMARY KEY,
+		height          INTEGER NOT NULL,
+		updated_at      INTEGER DEFAULT (strftime('%s', 'now'))
+	);
 	`
 	_, err := s.db.Exec(schema)
 	return err
@@ -77,7 +108,49 @@ func (s *SQLiteStore) InsertSubtree(ctx context.Context, hash, indexRoot []byte,
 	return err
 }
 
+func (s *SQLiteStore) InsertCoinbasePath(ctx context.Context, subtreeHash []byte, path [][]byte) error {
+	flat := make([]byte, 0, 32*len(path))
+	for _, h := range path {
+		if len(h) != 32 {
+			return fmt.Errorf("coinbase path hash must be 32 bytes, got %d", len(h))
+		}
+		flat = append(flat, h...)
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO coinbase_paths (subtree_hash, path) VALUES (?, ?)`,
+		subtreeHash, flat,
+	)
+	return err
+}
+
+func (s *SQLiteStore) GetCoinbasePath(ctx context.Context, subtreeHash []byte) ([][]byte, bool, error) {
+	var flat []byte
+	err := s.db.QueryRowContext(ctx,
+		`SELECT path FROM coinbase_paths WHERE subtree_hash = ?`,
+		subtreeHash,
+	).Scan(&flat)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	path := make([][]byte, 0, len(flat)/32)
+	for i := 0; i+32 <= len(flat); i += 32 {
+		path = append(path, flat[i:i+32])
+	}
+	return path, true, nil
+}
+
 func (s *SQLiteStore) InsertBlock(ctx context.Context, height uint32, blockHash, header []byte, txCount uint64, subtreeHashes [][]byte) error {
+	return s.insertBlock(ctx, metadata.StatusPending, height, blockHash, header, txCount, subtreeHashes)
+}
+
+func (s *SQLiteStore) InsertSideBlock(ctx context.Context, height uint32, blockHash, header []byte, txCount uint64, subtreeHashes [][]byte) error {
+	return s.insertBlock(ctx, metadata.StatusOrphaned, height, blockHash, header, txCount, subtreeHashes)
+}
+
+func (s *SQLiteStore) insertBlock(ctx context.Context, status string, height uint32, blockHash, header []byte, txCount uint64, subtreeHashes [][]byte) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -85,8 +158,8 @@ func (s *SQLiteStore) InsertBlock(ctx context.Context, height uint32, blockHash,
 	defer tx.Rollback()
 
 	_, err = tx.ExecContext(ctx,
-		`INSERT INTO blocks (height, block_hash, header, tx_count, subtree_count) VALUES (?, ?, ?, ?, ?)`,
-		height, blockHash, header, txCount, len(subtreeHashes),
+		`INSERT INTO blocks (height, block_hash, header, tx_count, subtree_count, status) VALUES (?, ?, ?, ?, ?, ?)`,
+		height, blockHash, header, txCount, len(subtreeHashes), status,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert block: %w", err)
@@ -126,6 +199,75 @@ func (s *SQLiteStore) GetBlockSubtrees(ctx context.Context, blockHash []byte) ([
 	return hashes, rows.Err()
 }
 
+func (s *SQLiteStore) GetBlock(ctx context.Context, blockHash []byte) (*metadata.Block, error) {
+	var b metadata.Block
+	err := s.db.QueryRowContext(ctx,
+		`SELECT height, block_hash, header, tx_count, status FROM blocks WHERE block_hash = ?`,
+		blockHash,
+	).Scan(&b.Height, &b.Hash, &b.Header, &b.TxCount, &b.Status)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (s *SQLiteStore) GetTip(ctx context.Context) (*metadata.Block, error) {
+	return s.getTip(ctx, `status = 'confirmed'`)
+}
+
+func (s *SQLiteStore) GetBlocksByHeightRange(ctx context.Context, fromHeight, toHeight uint32) ([]metadata.Block, error) {
+	return s.getBlocks(ctx, `status = 'confirmed'`, fromHeight, toHeight)
+}
+
+func (s *SQLiteStore) GetChainTip(ctx context.Context) (*metadata.Block, error) {
+	return s.getTip(ctx, `status != 'orphaned'`)
+}
+
+func (s *SQLiteStore) GetChainBlocks(ctx context.Context, fromHeight, toHeight uint32) ([]metadata.Block, error) {
+	return s.getBlocks(ctx, `status != 'orphaned'`, fromHeight, toHeight)
+}
+
+// getTip returns the highest block matching cond, breaking ties by hash.
+func (s *SQLiteStore) getTip(ctx context.Context, cond string) (*metadata.Block, error) {
+	var b metadata.Block
+	err := s.db.QueryRowContext(ctx,
+		`SELECT height, block_hash, header, tx_count, status FROM blocks
+		WHERE `+cond+` ORDER BY height DESC, block_hash LIMIT 1`,
+	).Scan(&b.Height, &b.Hash, &b.Header, &b.TxCount, &b.Status)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (s *SQLiteStore) getBlocks(ctx context.Context, cond string, fromHeight, toHeight uint32) ([]metadata.Block, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT height, block_hash, header, tx_count, status FROM blocks
+		WHERE height >= ? AND height <= ? AND `+cond+` ORDER BY height, block_hash`,
+		fromHeight, toHeight,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []metadata.Block
+	for rows.Next() {
+		var b metadata.Block
+		if err := rows.Scan(&b.Height, &b.Hash, &b.Header, &b.TxCount, &b.Status); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
 func (s *SQLiteStore) GetSubtreeIndexRoot(ctx context.Context, subtreeHash []byte) ([]byte, error) {
 	var indexRoot []byte
 	err := s.db.QueryRowContext(ctx,
@@ -187,6 +329,15 @@ func (s *SQLiteStore) OrphanBlock(ctx context.Context, blockHash []byte) error {
 	return err
 }
 
+func (s *SQLiteStore) ReinstateBlock(ctx context.Context, blockHash []byte) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE blocks SET status = CASE WHEN promoted_at IS NULL THEN 'pending' ELSE 'confirmed' END
+		WHERE block_hash = ? AND status = 'orphaned'`,
+		blockHash,
+	)
+	return err
+}
+
 func (s *SQLiteStore) GetUnpromotedBlocks(ctx context.Context, deeperThanHeight uint32) ([][]byte, error) {
 	rows, err := s.db.QueryContext(ctx,
 		`SELECT block_hash FROM blocks WHERE status = 'pending' AND height <= ? ORDER BY height`,
@@ -208,6 +359,78 @@ func (s *SQLiteStore) GetUnpromotedBlocks(ctx context.Context, deeperThanHeight
 	return hashes, rows.Err()
 }
 
+func (s *SQLiteStore) GetUnpromotedSubtrees(ctx context.Context) ([]metadata.Subtree, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT s.subtree_hash, s.index_root, s.received_at, EXISTS (
+			SELECT 1 FROM block_subtrees bs JOIN blocks b ON b.block_hash = bs.block_hash
+			WHERE bs.subtree_hash = s.subtree_hash AND b.status != 'orphaned'
+		) FROM subtrees s WHERE s.promoted = 0 ORDER BY s.received_at`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subtrees []metadata.Subtree
+	for rows.Next() {
+		var st metadata.Subtree
+		var receivedAt int64
+		if err := rows.Scan(&st.Hash, &st.IndexRoot, &receivedAt, &st.InBlock); err != nil {
+			return nil, err
+		}
+		st.ReceivedAt = time.Unix(receivedAt, 0)
+		subtrees = append(subtrees, st)
+	}
+	return subtrees, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteSubtree(ctx context.Context, subtreeHash []byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM subtrees WHERE subtree_hash = ?`, subtreeHash); err != nil {
+		return fmt.Errorf("failed to delete subtree: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM coinbase_paths WHERE subtree_hash = ?`, subtreeHash); err != nil {
+		return fmt.Errorf("failed to delete coinbase path: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetTipHeight(ctx context.Context) (uint32, error) {
+	var height uint32
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(height), 0) FROM blocks WHERE status != 'orphaned'`,
+	).Scan(&height)
+	return height, err
+}
+
+func (s *SQLiteStore) SetCheckpoint(ctx context.Context, name string, height uint32) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO checkpoints (name, height, updated_at) VALUES (?, ?, strftime('%s', 'now'))`,
+		name, height,
+	)
+	return err
+}
+
+func (s *SQLiteStore) GetCheckpoint(ctx context.Context, name string) (uint32, bool, error) {
+	var height uint32
+	err := s.db.QueryRowContext(ctx,
+		`SELECT height FROM checkpoints WHERE name = ?`,
+		name,
+	).Scan(&height)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return height, true, nil
+}
+
 func (s *SQLiteStore) Close() error {
 	if s.db != nil {
 		return s.db.Close()
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"testing"
+
+	"github.com/shruggr/inspiration/metadata"
 )
 
 func newTestStore(t *testing.T) *SQLiteStore {
@@ -172,6 +174,29 @@ func TestOrphanBlock(t *testing.T) {
 	}
 }
 
+func TestInsertSideBlock(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	if err := s.InsertSideBlock(ctx, 50, []byte{0xAA}, []byte{0xBB}, 5, [][]byte{{0x01}}); err != nil {
+		t.Fatalf("InsertSideBlock failed: %v", err)
+	}
+	b, err := s.GetBlock(ctx, []byte{0xAA})
+	if err != nil || b == nil || b.Status != "orphaned" {
+		t.Fatalf("GetBlock: %+v, %v", b, err)
+	}
+	if tip, _ := s.GetChainTip(ctx); tip != nil {
+		t.Errorf("side block is the tip: %+v", tip)
+	}
+
+	if err := s.ReinstateBlock(ctx, []byte{0xAA}); err != nil {
+		t.Fatalf("ReinstateBlock failed: %v", err)
+	}
+	if tip, _ := s.GetChainTip(ctx); tip == nil || tip.Status != "pending" {
+		t.Errorf("reinstated tip: %+v", tip)
+	}
+}
+
 func TestGetUnpromotedBlocks(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -203,3 +228,331 @@ func TestGetUnpromotedBlocks(t *testing.T) {
 		t.Errorf("second block hash mismatch: got %v", got[1])
 	}
 }
+
+func TestGetBlocksByHeightRange(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	for i := uint32(1); i <= 5; i++ {
+		if err := s.InsertBlock(ctx, i*10, []byte{byte(i)}, []byte{0xFF}, uint64(i), nil); err != nil {
+			t.Fatalf("InsertBlock failed: %v", err)
+		}
+	}
+
+	// A competitor at height 40 that sorts after block 4
+	if err := s.InsertBlock(ctx, 40, []byte{4, 0}, []byte{0xFF}, 6, nil); err != nil {
+		t.Fatalf("InsertBlock failed: %v", err)
+	}
+	for _, h := range []byte{2, 3} {
+		if err := s.PromoteBlock(ctx, []byte{h}); err != nil {
+			t.Fatalf("PromoteBlock failed: %v", err)
+		}
+	}
+	// Orphan the block at height 30
+	if err := s.OrphanBlock(ctx, []byte{3}); err != nil {
+		t.Fatalf("OrphanBlock failed: %v", err)
+	}
+
+	got, err := s.GetBlocksByHeightRange(ctx, 20, 40)
+	if err != nil {
+		t.Fatalf("GetBlocksByHeightRange failed: %v", err)
+	}
+
+	// Only height 20. Height 30 is orphaned and height 40 pending.
+	if len(got) != 1 {
+		t.Fatalf("expected 1 block, got %d", len(got))
+	}
+	if got[0].Height != 20 || !bytes.Equal(got[0].Hash, []byte{2}) || got[0].Status != "confirmed" {
+		t.Errorf("first block mismatch: %+v", got[0])
+	}
+
+	got, err = s.GetChainBlocks(ctx, 20, 40)
+	if err != nil {
+		t.Fatalf("GetChainBlocks failed: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(got))
+	}
+	if got[1].Height != 40 || !bytes.Equal(got[1].Hash, []byte{4}) {
+		t.Errorf("second block mismatch: height=%d hash=%v", got[1].Height, got[1].Hash)
+	}
+	if got[1].TxCount != 4 || got[1].Status != "pending" {
+		t.Errorf("second block fields: txCount=%d status=%q", got[1].TxCount, got[1].Status)
+	}
+	if !bytes.Equal(got[2].Hash, []byte{4, 0}) {
+		t.Errorf("third block hash mismatch: got %v", got[2].Hash)
+	}
+}
+
+func TestGetTipHeight(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	tip, err := s.GetTipHeight(ctx)
+	if err != nil {
+		t.Fatalf("GetTipHeight failed: %v", err)
+	}
+	if tip != 0 {
+		t.Errorf("expected tip 0 for empty store, got %d", tip)
+	}
+
+	for i := uint32(1); i <= 3; i++ {
+		if err := s.InsertBlock(ctx, i*10, []byte{byte(i)}, []byte{0xFF}, uint64(i), nil); err != nil {
+			t.Fatalf("InsertBlock failed: %v", err)
+		}
+	}
+	if err := s.OrphanBlock(ctx, []byte{3}); err != nil {
+		t.Fatalf("OrphanBlock failed: %v", err)
+	}
+
+	tip, err = s.GetTipHeight(ctx)
+	if err != nil {
+		t.Fatalf("GetTipHeight failed: %v", err)
+	}
+	if tip != 20 {
+		t.Errorf("expected tip 20, got %d", tip)
+	}
+}
+
+func TestGetUnpromotedSubtrees(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	for i := byte(1); i <= 4; i++ {
+		if err := s.InsertSubtree(ctx, []byte{i}, []byte{0xA0 + i}, 1); err != nil {
+			t.Fatalf("InsertSubtree failed: %v", err)
+		}
+	}
+	// Subtree 1 is in a pending block, 2 only in an orphaned block,
+	// 3 in a promoted block and 4 was never mined.
+	if err := s.InsertBlock(ctx, 10, []byte{0x10}, []byte{0xFF}, 1, [][]byte{{1}}); err != nil {
+		t.Fatalf("InsertBlock failed: %v", err)
+	}
+	if err := s.InsertBlock(ctx, 10, []byte{0x11}, []byte{0xFF}, 1, [][]byte{{2}}); err != nil {
+		t.Fatalf("InsertBlock failed: %v", err)
+	}
+	if err := s.OrphanBlock(ctx, []byte{0x11}); err != nil {
+		t.Fatalf("OrphanBlock failed: %v", err)
+	}
+	if err := s.InsertBlock(ctx, 9, []byte{0x09}, []byte{0xFF}, 1, [][]byte{{3}}); err != nil {
+		t.Fatalf("InsertBlock failed: %v", err)
+	}
+	if err := s.PromoteBlock(ctx, []byte{0x09}); err != nil {
+		t.Fatalf("PromoteBlock failed: %v", err)
+	}
+
+	got, err := s.GetUnpromotedSubtrees(ctx)
+	if err != nil {
+		t.Fatalf("GetUnpromotedSubtrees failed: %v", err)
+	}
+	inBlock := map[byte]bool{}
+	for _, st := range got {
+		inBlock[st.Hash[0]] = st.InBlock
+		if st.ReceivedAt.IsZero() {
+			t.Errorf("subtree %x: missing received_at", st.Hash)
+		}
+	}
+	want := map[byte]bool{1: true, 2: false, 4: false}
+	if len(inBlock) != len(want) {
+		t.Fatalf("expected %d unpromoted subtrees, got %d", len(want), len(inBlock))
+	}
+	for h, w := range want {
+		if inBlock[h] != w {
+			t.Errorf("subtree %d: InBlock=%v, want %v", h, inBlock[h], w)
+		}
+	}
+
+	if err := s.DeleteSubtree(ctx, []byte{4}); err != nil {
+		t.Fatalf("DeleteSubtree failed: %v", err)
+	}
+	if ok, _ := s.SubtreeExists(ctx, []byte{4}); ok {
+		t.Error("expected subtree 4 to be deleted")
+	}
+}
+
+func TestGetBlockAndTip(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	tip, err := s.GetChainTip(ctx)
+	if err != nil || tip != nil {
+		t.Fatalf("expected no tip for empty store, got %v, %v", tip, err)
+	}
+
+	for i := uint32(1); i <= 3; i++ {
+		if err := s.InsertBlock(ctx, i*10, []byte{byte(i)}, []byte{0xFF}, uint64(i), nil); err != nil {
+			t.Fatalf("InsertBlock failed: %v", err)
+		}
+	}
+	if err := s.OrphanBlock(ctx, []byte{3}); err != nil {
+		t.Fatalf("OrphanBlock failed: %v", err)
+	}
+
+	tip, err = s.GetChainTip(ctx)
+	if err != nil {
+		t.Fatalf("GetChainTip failed: %v", err)
+	}
+	if tip == nil || tip.Height != 20 || !bytes.Equal(tip.Hash, []byte{2}) {
+		t.Fatalf("unexpected tip: %+v", tip)
+	}
+
+	// Only confirmed blocks count for GetTip
+	if tip, err := s.GetTip(ctx); err != nil || tip != nil {
+		t.Fatalf("expected no confirmed tip, got %v, %v", tip, err)
+	}
+	if err := s.PromoteBlock(ctx, []byte{1}); err != nil {
+		t.Fatalf("PromoteBlock failed: %v", err)
+	}
+	if tip, err := s.GetTip(ctx); err != nil || tip == nil || tip.Height != 10 {
+		t.Fatalf("unexpected confirmed tip: %+v, %v", tip, err)
+	}
+
+	b, err := s.GetBlock(ctx, []byte{3})
+	if err != nil {
+		t.Fatalf("GetBlock failed: %v", err)
+	}
+	if b == nil || b.Height != 30 || b.Status != "orphaned" {
+		t.Fatalf("unexpected block: %+v", b)
+	}
+	if b, err := s.GetBlock(ctx, []byte{9}); err != nil || b != nil {
+		t.Errorf("expected nil for unknown block, got %v, %v", b, err)
+	}
+}
+
+func TestReinstateBlock(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	for i := byte(1); i <= 2; i++ {
+		if err := s.InsertBlock(ctx, 10, []byte{i}, []byte{0xFF}, 1, nil); err != nil {
+			t.Fatalf("InsertBlock failed: %v", err)
+		}
+	}
+	// Block 2 was promoted before being orphaned, block 1 was not.
+	if err := s.PromoteBlock(ctx, []byte{2}); err != nil {
+		t.Fatalf("PromoteBlock failed: %v", err)
+	}
+	for i := byte(1); i <= 2; i++ {
+		if err := s.OrphanBlock(ctx, []byte{i}); err != nil {
+			t.Fatalf("OrphanBlock failed: %v", err)
+		}
+		if err := s.ReinstateBlock(ctx, []byte{i}); err != nil {
+			t.Fatalf("ReinstateBlock failed: %v", err)
+		}
+	}
+
+	for hash, want := range map[byte]string{1: "pending", 2: "confirmed"} {
+		b, err := s.GetBlock(ctx, []byte{hash})
+		if err != nil {
+			t.Fatalf("GetBlock failed: %v", err)
+		}
+		if b.Status != want {
+			t.Errorf("block %d: status %q, want %q", hash, b.Status, want)
+		}
+	}
+}
+
+func TestCoinbasePath(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	if _, ok, err := s.GetCoinbasePath(ctx, []byte{1}); err != nil || ok {
+		t.Fatalf("expected no path, got ok=%v err=%v", ok, err)
+	}
+
+	path := [][]byte{bytes.Repeat([]byte{0xA1}, 32), bytes.Repeat([]byte{0xB2}, 32)}
+	if err := s.InsertCoinbasePath(ctx, []byte{1}, path); err != nil {
+		t.Fatalf("InsertCoinbasePath failed: %v", err)
+	}
+	if err := s.InsertCoinbasePath(ctx, []byte{2}, nil); err != nil {
+		t.Fatalf("InsertCoinbasePath with empty path failed: %v", err)
+	}
+
+	got, ok, err := s.GetCoinbasePath(ctx, []byte{1})
+	if err != nil || !ok {
+		t.Fatalf("GetCoinbasePath failed: ok=%v err=%v", ok, err)
+	}
+	if len(got) != 2 || !bytes.Equal(got[0], path[0]) || !bytes.Equal(got[1], path[1]) {
+		t.Errorf("path mismatch: got %x", got)
+	}
+
+	// A subtree holding only the coinbase has an empty path
+	got, ok, err = s.GetCoinbasePath(ctx, []byte{2})
+	if err != nil || !ok || len(got) != 0 {
+		t.Errorf("empty path: got %x, ok=%v, err=%v", got, ok, err)
+	}
+
+	if err := s.InsertCoinbasePath(ctx, []byte{3}, [][]byte{{1, 2}}); err == nil {
+		t.Error("expected error for short hash in path")
+	}
+}
+
+func TestQueuedBlocks(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	st1 := bytes.Repeat([]byte{0x01}, 32)
+	st2 := bytes.Repeat([]byte{0x02}, 32)
+	st3 := bytes.Repeat([]byte{0x03}, 32)
+	s.InsertSubtree(ctx, st1, []byte("root1"), 10)
+
+	blockA := metadata.QueuedBlock{Height: 101, Hash: []byte("block-a"), Header: make([]byte, 80), CoinbaseTx: []byte("cb-a"), TxCount: 20, SubtreeHashes: [][]byte{st1, st2}}
+	blockB := metadata.QueuedBlock{Height: 100, Hash: []byte("block-b"), Header: make([]byte, 80), TxCount: 5, SubtreeHashes: [][]byte{st3}}
+	for _, b := range []metadata.QueuedBlock{blockA, blockB, blockA} {
+		if err := s.QueueBlock(ctx, b); err != nil {
+			t.Fatalf("QueueBlock failed: %v", err)
+		}
+	}
+
+	blocks, err := s.GetQueuedBlocks(ctx)
+	if err != nil {
+		t.Fatalf("GetQueuedBlocks failed: %v", err)
+	}
+	if len(blocks) != 2 || blocks[0].Height != 100 || blocks[1].Height != 101 {
+		t.Fatalf("expected blocks at 100 and 101, got %+v", blocks)
+	}
+	a := blocks[1]
+	if !bytes.Equal(a.CoinbaseTx, []byte("cb-a")) || a.TxCount != 20 || a.QueuedAt.IsZero() {
+		t.Errorf("block fields not round-tripped: %+v", a)
+	}
+	if len(a.SubtreeHashes) != 2 || len(a.Missing) != 1 || !bytes.Equal(a.Missing[0], st2) {
+		t.Errorf("expected st2 missing of 2 subtrees, got %x missing %x", a.SubtreeHashes, a.Missing)
+	}
+
+	s.InsertSubtree(ctx, st2, []byte("root2"), 10)
+	blocks, err = s.GetQueuedBlocksBySubtree(ctx, st2)
+	if err != nil {
+		t.Fatalf("GetQueuedBlocksBySubtree failed: %v", err)
+	}
+	if len(blocks) != 1 || !bytes.Equal(blocks[0].Hash, blockA.Hash) || len(blocks[0].Missing) != 0 {
+		t.Fatalf("expected block-a with nothing missing, got %+v", blocks)
+	}
+
+	if err := s.DequeueBlock(ctx, blockA.Hash); err != nil {
+		t.Fatalf("DequeueBlock failed: %v", err)
+	}
+	if blocks, _ := s.GetQueuedBlocksBySubtree(ctx, st1); len(blocks) != 0 {
+		t.Errorf("expected no blocks after dequeue, got %d", len(blocks))
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	if _, ok, err := s.GetCheckpoint(ctx, "job"); err != nil || ok {
+		t.Fatalf("expected no checkpoint, got ok=%v err=%v", ok, err)
+	}
+	for _, h := range []uint32{100, 105} {
+		if err := s.SetCheckpoint(ctx, "job", h); err != nil {
+			t.Fatalf("SetCheckpoint failed: %v", err)
+		}
+	}
+	height, ok, err := s.GetCheckpoint(ctx, "job")
+	if err != nil || !ok || height != 105 {
+		t.Errorf("expected checkpoint 105, got %d ok=%v err=%v", height, ok, err)
+	}
+	if _, ok, _ := s.GetCheckpoint(ctx, "other"); ok {
+		t.Error("checkpoints are not kept per name")
+	}
+}
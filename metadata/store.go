@@ -1,15 +1,108 @@
 package metadata
 
-import "context"
+import (
+	"context"
+	"time"
+)
+
+// Block statuses.
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusOrphaned  = "orphaned"
+)
+
+// Block is a block row as recorded in the metadata store.
+type Block struct {
+	Height  uint32
+	Hash    []byte
+	Header  []byte
+	TxCount uint64
+	Status  string
+}
+
+// PrevHash returns the previous block hash from the block header.
+func (b *Block) PrevHash() []byte {
+	if len(b.Header) < 36 {
+		return nil
+	}
+	return b.Header[4:36]
+}
+
+// Subtree is an unpromoted subtree row as recorded in the metadata store.
+type Subtree struct {
+	Hash       []byte
+	IndexRoot  []byte
+	ReceivedAt time.Time
+	InBlock    bool // included by at least one pending or confirmed block
+}
+
+// QueuedBlock is a block waiting for some of its subtrees to be indexed, or
+// for its parent to be recorded.
+type QueuedBlock struct {
+	Height        uint32
+	Hash          []byte
+	Header        []byte
+	CoinbaseTx    []byte
+	TxCount       uint64
+	SubtreeHashes [][]byte
+	Missing       [][]byte // subtrees not yet indexed, in block order
+	QueuedAt      time.Time
+}
 
 type Store interface {
 	InsertSubtree(ctx context.Context, hash, indexRoot []byte, txCount uint32) error
 	InsertBlock(ctx context.Context, height uint32, blockHash, header []byte, txCount uint64, subtreeHashes [][]byte) error
+	// InsertSideBlock records a block that is not on the best chain, as
+	// orphaned; ReinstateBlock connects it if its branch later takes over.
+	InsertSideBlock(ctx context.Context, height uint32, blockHash, header []byte, txCount uint64, subtreeHashes [][]byte) error
+	// InsertCoinbasePath records the merkle path of the coinbase placeholder
+	// in a subtree that can start a block. Must be called before InsertSubtree.
+	InsertCoinbasePath(ctx context.Context, subtreeHash []byte, path [][]byte) error
+	// GetCoinbasePath returns the path recorded by InsertCoinbasePath and
+	// whether one was recorded.
+	GetCoinbasePath(ctx context.Context, subtreeHash []byte) ([][]byte, bool, error)
 	GetBlockSubtrees(ctx context.Context, blockHash []byte) ([][]byte, error)
+	// GetBlock returns the block with the given hash regardless of status, or nil if unknown.
+	GetBlock(ctx context.Context, blockHash []byte) (*Block, error)
+	// GetTip returns the highest confirmed block, or nil if there are none.
+	GetTip(ctx context.Context) (*Block, error)
+	// GetBlocksByHeightRange returns the confirmed blocks with
+	// fromHeight <= height <= toHeight, ordered by height and then hash.
+	GetBlocksByHeightRange(ctx context.Context, fromHeight, toHeight uint32) ([]Block, error)
+	// GetChainTip returns the highest block on the best chain, pending or
+	// confirmed, or nil if there are no blocks.
+	GetChainTip(ctx context.Context) (*Block, error)
+	// GetChainBlocks is GetBlocksByHeightRange over the best chain, pending
+	// or confirmed.
+	GetChainBlocks(ctx context.Context, fromHeight, toHeight uint32) ([]Block, error)
 	GetSubtreeIndexRoot(ctx context.Context, subtreeHash []byte) ([]byte, error)
 	SubtreeExists(ctx context.Context, subtreeHash []byte) (bool, error)
 	PromoteBlock(ctx context.Context, blockHash []byte) error
 	OrphanBlock(ctx context.Context, blockHash []byte) error
+	// ReinstateBlock returns an orphaned block to the best chain, restoring
+	// its confirmed status if it had already been promoted.
+	ReinstateBlock(ctx context.Context, blockHash []byte) error
 	GetUnpromotedBlocks(ctx context.Context, deeperThanHeight uint32) ([][]byte, error)
+	// GetUnpromotedSubtrees returns every subtree whose index has not been promoted.
+	GetUnpromotedSubtrees(ctx context.Context) ([]Subtree, error)
+	DeleteSubtree(ctx context.Context, subtreeHash []byte) error
+	// QueueBlock records a block that cannot be processed until its missing
+	// subtrees are indexed. Queueing an already queued block keeps its
+	// original QueuedAt.
+	QueueBlock(ctx context.Context, block QueuedBlock) error
+	// GetQueuedBlocks returns every queued block, lowest height first.
+	GetQueuedBlocks(ctx context.Context) ([]QueuedBlock, error)
+	// GetQueuedBlocksBySubtree returns the queued blocks that include the
+	// subtree, lowest height first.
+	GetQueuedBlocksBySubtree(ctx context.Context, subtreeHash []byte) ([]QueuedBlock, error)
+	DequeueBlock(ctx context.Context, blockHash []byte) error
+	// GetTipHeight returns the highest non-orphaned block height, or 0 if there are no blocks.
+	GetTipHeight(ctx context.Context) (uint32, error)
+	// SetCheckpoint records the height a named job has completed up to.
+	SetCheckpoint(ctx context.Context, name string, height uint32) error
+	// GetCheckpoint returns the height recorded for name and whether one
+	// was recorded.
+	GetCheckpoint(ctx context.Context, name string) (uint32, bool, error)
 	Close() error
 }
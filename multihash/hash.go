@@ -23,6 +23,16 @@ func NewIndexHash(data []byte) (IndexHash, error) {
 	return IndexHash(h), nil
 }
 
+// IndexHashFromDigest wraps a raw 32-byte BLAKE3 digest as a multihash
+// Index nodes store child pointers as bare digests to keep entries fixed-width
+func IndexHashFromDigest(digest []byte) (IndexHash, error) {
+	h, err := mh.Encode(digest, mh.BLAKE3)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode digest: %w", err)
+	}
+	return IndexHash(h), nil
+}
+
 // Verify checks that the hash matches the provided data
 func (h IndexHash) Verify(data []byte) error {
 	decoded, err := mh.Decode(mh.Multihash(h))
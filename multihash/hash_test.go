@@ -164,3 +164,25 @@ func TestMerkleHashHex(t *testing.T) {
 		t.Errorf("Expected hex length 68 (34 bytes * 2), got %d", len(hexStr))
 	}
 }
+
+func TestIndexHashFromDigest(t *testing.T) {
+	data := []byte("test digest wrapping")
+
+	hash, err := NewIndexHash(data)
+	if err != nil {
+		t.Fatalf("NewIndexHash failed: %v", err)
+	}
+
+	wrapped, err := IndexHashFromDigest(hash.Bytes()[2:])
+	if err != nil {
+		t.Fatalf("IndexHashFromDigest failed: %v", err)
+	}
+
+	if wrapped.Hex() != hash.Hex() {
+		t.Errorf("Expected %s, got %s", hash.Hex(), wrapped.Hex())
+	}
+
+	if err := wrapped.Verify(data); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/shruggr/inspiration/metadata"
+)
+
+// SubtreeIndexedHandler is called after a subtree's index is recorded in the
+// metadata store, before any block including it is known.
+type SubtreeIndexedHandler func(ctx context.Context, subtreeHash, indexRoot []byte)
+
+// BlockConnectedHandler is called for each block joining the best chain,
+// after any reorg handlers for the switch that connected it.
+type BlockConnectedHandler func(ctx context.Context, block metadata.Block)
+
+// OnSubtreeIndexed registers h to be called for every indexed subtree.
+// Handlers must be registered before subtrees are processed.
+func (p *Processor) OnSubtreeIndexed(h SubtreeIndexedHandler) {
+	p.subtreeHandlers = append(p.subtreeHandlers, h)
+}
+
+// OnBlockConnected registers h to be called for every block connected to the
+// best chain, including blocks revived by a reorg. Handlers must be
+// registered before blocks are processed.
+func (p *Processor) OnBlockConnected(h BlockConnectedHandler) {
+	p.blockHandlers = append(p.blockHandlers, h)
+}
+
+func (p *Processor) notifyBlocksConnected(ctx context.Context, blocks []metadata.Block) {
+	for _, b := range blocks {
+		for _, h := range p.blockHandlers {
+			h(ctx, b)
+		}
+	}
+}
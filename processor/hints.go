@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/block"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/shruggr/inspiration/cache"
+	"github.com/shruggr/inspiration/teranode"
+)
+
+// PrewarmTx fetches and indexes a transaction Teranode has validated, before
+// any subtree containing it arrives, so the subtree finds its terms cached.
+// Its spends are recorded as they would be when indexing the subtree.
+// Beyond Config.PrewarmRate the hint is ignored.
+func (p *Processor) PrewarmTx(ctx context.Context, txid cache.TxID) error {
+	if _, ok := p.cache.Get(txid); ok {
+		return nil
+	}
+	if !p.allowPrewarm() {
+		return nil
+	}
+	if _, err := p.indexTx(ctx, txid, nil); err != nil {
+		if errors.Is(err, teranode.ErrTxNotFound) {
+			p.logger.Debug("prewarm: transaction not found", "txid", teranode.TxIDToHex(txid[:]))
+			return nil
+		}
+		return fmt.Errorf("prewarm: %w", err)
+	}
+	return nil
+}
+
+// allowPrewarm takes a token from the prewarm bucket, which holds up to a
+// second's worth, reporting false if it is empty.
+func (p *Processor) allowPrewarm() bool {
+	rate := float64(p.config.PrewarmRate)
+	if rate <= 0 {
+		return true
+	}
+	p.prewarmMu.Lock()
+	defer p.prewarmMu.Unlock()
+	now := time.Now()
+	p.prewarmTokens = min(rate, p.prewarmTokens+now.Sub(p.prewarmAt).Seconds()*rate)
+	p.prewarmAt = now
+	if p.prewarmTokens < 1 {
+		return false
+	}
+	p.prewarmTokens--
+	return true
+}
+
+// EvictTx drops cached terms for a transaction that will not be mined.
+func (p *Processor) EvictTx(txid cache.TxID) error {
+	return p.cache.Delete(txid)
+}
+
+// AnnounceBlock checks a newly announced block against the chain tip ahead
+// of its blocks-final message, warning if it does not build on the tip and
+// will cause a reorg once it arrives.
+func (p *Processor) AnnounceBlock(ctx context.Context, blockHashHex string) error {
+	hash, err := chainhash.NewHashFromHex(blockHashHex)
+	if err != nil {
+		return fmt.Errorf("block hash %q: %w", blockHashHex, err)
+	}
+	existing, err := p.metadata.GetBlock(ctx, hash[:])
+	if err != nil {
+		return fmt.Errorf("get block: %w", err)
+	}
+	if existing != nil {
+		return nil
+	}
+
+	raw, err := p.client.FetchBlockHeader(ctx, blockHashHex)
+	if err != nil {
+		return err
+	}
+	header, err := block.NewHeaderFromBytes(raw)
+	if err != nil {
+		return fmt.Errorf("parse header %s: %w", blockHashHex, err)
+	}
+	if header.Hash() != *hash {
+		return fmt.Errorf("header for %s hashes to %s", blockHashHex, header.Hash())
+	}
+	if err := checkProofOfWork(header, p.config.PowLimit); err != nil {
+		p.logger.Warn("announced block fails proof of work", "hash", blockHashHex, "error", err)
+		return nil
+	}
+
+	tip, err := p.metadata.GetChainTip(ctx)
+	if err != nil {
+		return fmt.Errorf("get tip: %w", err)
+	}
+	if tip == nil || bytes.Equal(tip.Hash, header.PrevHash[:]) {
+		p.logger.Info("block announced", "hash", blockHashHex)
+		return nil
+	}
+	p.logger.Warn("announced block does not build on tip, reorg expected",
+		"hash", blockHashHex,
+		"prev", header.PrevHash.String(),
+		"tip_height", tip.Height,
+	)
+	return nil
+}
@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/shruggr/inspiration/store"
+	"github.com/shruggr/inspiration/teranode"
+	"github.com/shruggr/inspiration/txindexer"
+)
+
+func TestPrewarmAndEvictTx(t *testing.T) {
+	txid := [32]byte{0x01}
+	prevTxID := [32]byte{0xaa}
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/tx/"+teranode.TxIDToHex(txid[:]) {
+			http.NotFound(w, r)
+			return
+		}
+		fetches++
+		w.Write(buildMinimalRawTx(prevTxID, 3))
+	}))
+	defer srv.Close()
+
+	indexer := newMockIndexer()
+	indexer.results[fmt.Sprintf("%x", txid[:])] = []*txindexer.IndexResult{{Key: "type", Value: "ord"}}
+	termCache := newMemCache()
+	spends := newMemKVStore()
+	p := NewProcessor(store.NewDualStore(newMemKVStore(), newMemKVStore()), spends, termCache,
+		indexer, teranode.NewClient(srv.URL), &mockBuilder{}, newMemMetadata(), DefaultConfig(), slog.Default())
+	ctx := context.Background()
+
+	if err := p.PrewarmTx(ctx, txid); err != nil {
+		t.Fatalf("PrewarmTx: %v", err)
+	}
+	if terms, ok := termCache.Get(txid); !ok || len(terms) != 1 {
+		t.Fatalf("cached terms: %v, %v", terms, ok)
+	}
+	if ok, _ := spends.Has(ctx, makeOutpointKey(prevTxID[:], 3)); !ok {
+		t.Error("spend record not written")
+	}
+
+	// Already cached, so not fetched again; unknown transactions are skipped
+	if err := p.PrewarmTx(ctx, txid); err != nil || fetches != 1 {
+		t.Errorf("second prewarm: %d fetches, %v", fetches, err)
+	}
+	if err := p.PrewarmTx(ctx, [32]byte{0x02}); err != nil {
+		t.Errorf("prewarm missing tx: %v", err)
+	}
+
+	if err := p.EvictTx(txid); err != nil {
+		t.Fatalf("EvictTx: %v", err)
+	}
+	if _, ok := termCache.Get(txid); ok {
+		t.Error("terms still cached after eviction")
+	}
+}
+
+func TestPrewarmRateLimit(t *testing.T) {
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(buildMinimalRawTx([32]byte{0xaa}, 0))
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.PrewarmRate = 2
+	p := NewProcessor(store.NewDualStore(newMemKVStore(), newMemKVStore()), newMemKVStore(), newMemCache(),
+		newMockIndexer(), teranode.NewClient(srv.URL), &mockBuilder{}, newMemMetadata(), config, slog.Default())
+
+	// A second's worth are fetched and the rest dropped
+	for i := byte(1); i <= 5; i++ {
+		if err := p.PrewarmTx(context.Background(), [32]byte{i}); err != nil {
+			t.Fatalf("PrewarmTx: %v", err)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("fetches: got %d, want 2", fetches)
+	}
+}
+
+func TestAnnounceBlock(t *testing.T) {
+	h := newReorgHarness()
+	tip := h.add(t, 100, nil, 0)
+
+	next, _ := testBlock(tip, 0)
+	fork, _ := testBlock(make([]byte, 32), 1)
+	headers := map[string][]byte{}
+	for _, header := range [][]byte{next, fork} {
+		headers[chainhash.DoubleHashH(header).String()] = header
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header, ok := headers[strings.TrimPrefix(r.URL.Path, "/api/v1/header/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(header)
+	}))
+	defer srv.Close()
+	h.p.client = teranode.NewClient(srv.URL)
+
+	ctx := context.Background()
+	for hash := range headers {
+		if err := h.p.AnnounceBlock(ctx, hash); err != nil {
+			t.Errorf("AnnounceBlock(%s): %v", hash, err)
+		}
+	}
+
+	// Blocks already recorded are not fetched
+	known, _ := chainhash.NewHash(tip)
+	if err := h.p.AnnounceBlock(ctx, known.String()); err != nil {
+		t.Errorf("AnnounceBlock(tip): %v", err)
+	}
+	if err := h.p.AnnounceBlock(ctx, "not-a-hash"); err == nil {
+		t.Error("expected error for malformed hash")
+	}
+}
@@ -7,11 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
+	"github.com/bsv-blockchain/go-sdk/block"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
 	"github.com/bsv-blockchain/go-sdk/transaction"
 	"github.com/shruggr/inspiration/cache"
 	"github.com/shruggr/inspiration/kvstore"
 	"github.com/shruggr/inspiration/metadata"
+	"github.com/shruggr/inspiration/multihash"
 	"github.com/shruggr/inspiration/store"
 	"github.com/shruggr/inspiration/teranode"
 	"github.com/shruggr/inspiration/treebuilder"
@@ -20,12 +25,55 @@ import (
 
 var ErrSubtreeNotReady = errors.New("one or more subtrees not yet processed")
 
+// ErrParentNotReady is returned for a block whose parent is unknown and that
+// competes with a block on the best chain, so its fork point cannot be found.
+var ErrParentNotReady = errors.New("parent block not yet processed")
+
 type subtreeNode struct {
 	Hash [32]byte
 	Fee  uint64
 	Size uint64
 }
 
+type Config struct {
+	// PowLimit is the compact form of the easiest target a block header may
+	// claim. 0 accepts any target.
+	PowLimit uint32
+	// Concurrency is the number of transactions of a subtree fetched and
+	// indexed in parallel. Values below 1 process them one at a time.
+	Concurrency int
+	// MaxInFlight caps concurrent transaction fetches from Teranode across
+	// all subtrees being processed: subtree streams and batches, and
+	// separately single-transaction fetches by workers, which a stream may
+	// be waiting on. 0 means no cap beyond Concurrency.
+	MaxInFlight int
+	// TxTimeout bounds fetching and indexing a single transaction. 0 means
+	// no timeout.
+	TxTimeout time.Duration
+	// BatchSize is the number of transactions requested at once when they
+	// cannot be streamed from the subtree's data. 0 disables streaming and
+	// batch fetches, fetching each transaction individually.
+	BatchSize int
+	// SkipMissingTxs indexes a subtree without the transactions Teranode
+	// reports as not found, instead of failing it so it is retried later.
+	SkipMissingTxs bool
+	// PrewarmRate caps PrewarmTx fetches per second. Hints beyond it are
+	// dropped and their transactions fetched with their subtree instead.
+	// 0 means no cap.
+	PrewarmRate int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PowLimit:    MainnetPowLimit,
+		Concurrency: 16,
+		MaxInFlight: 64,
+		TxTimeout:   30 * time.Second,
+		BatchSize:   1000,
+		PrewarmRate: 100,
+	}
+}
+
 type Processor struct {
 	store      *store.DualStore
 	spendStore kvstore.KVStore
@@ -34,7 +82,29 @@ type Processor struct {
 	client     *teranode.Client
 	builder    treebuilder.Builder
 	metadata   metadata.Store
+	config     Config
 	logger     *slog.Logger
+
+	// fetchSem holds a slot per in-flight subtree stream or batch fetch, and
+	// txFetchSem per single-transaction fetch; nil if unbounded.
+	fetchSem   chan struct{}
+	txFetchSem chan struct{}
+
+	// prewarmTokens is a token bucket of PrewarmTx fetches, refilled at
+	// PrewarmRate per second since prewarmAt.
+	prewarmMu     sync.Mutex
+	prewarmTokens float64
+	prewarmAt     time.Time
+
+	// buildMu is read locked while a subtree's index tree is written and
+	// until its row is recorded; see BuildLock.
+	buildMu sync.RWMutex
+
+	// blockMu serializes block processing with retries of queued blocks.
+	blockMu         sync.Mutex
+	reorgHandlers   []ReorgHandler
+	subtreeHandlers []SubtreeIndexedHandler
+	blockHandlers   []BlockConnectedHandler
 }
 
 func NewProcessor(
@@ -45,9 +115,10 @@ func NewProcessor(
 	client *teranode.Client,
 	builder treebuilder.Builder,
 	metadata metadata.Store,
+	config Config,
 	logger *slog.Logger,
 ) *Processor {
-	return &Processor{
+	p := &Processor{
 		store:      store,
 		spendStore: spendStore,
 		cache:      cache,
@@ -55,8 +126,15 @@ func NewProcessor(
 		client:     client,
 		builder:    builder,
 		metadata:   metadata,
+		config:     config,
 		logger:     logger,
 	}
+	if config.MaxInFlight > 0 {
+		p.fetchSem = make(chan struct{}, config.MaxInFlight)
+		p.txFetchSem = make(chan struct{}, config.MaxInFlight)
+	}
+	p.prewarmTokens, p.prewarmAt = float64(config.PrewarmRate), time.Now()
+	return p
 }
 
 func (p *Processor) ProcessSubtree(ctx context.Context, subtreeHash string, fetchURL string) error {
@@ -79,66 +157,69 @@ func (p *Processor) processSubtreeData(ctx context.Context, subtreeHash string,
 		copy(subtreeRoot[:], subtreeData[:32])
 	}
 
-	taggedTxs := make([]treebuilder.TaggedTransaction, 0, len(nodes))
-
-	for i, node := range nodes {
-		txid := cache.TxID(node.Hash)
-
-		terms, ok := p.cache.Get(txid)
-		if !ok {
-			rawTx, err := p.client.FetchTransaction(ctx, teranode.TxIDToHex(txid[:]))
-			if err != nil {
-				return fmt.Errorf("fetch tx %x: %w", txid[:8], err)
-			}
+	// The first subtree of a block starts with a placeholder for the coinbase.
+	// Record its merkle path so the block's merkle root can be checked once
+	// the coinbase is known.
+	var coinbasePath [][]byte
+	if len(nodes) > 0 && isCoinbasePlaceholder(nodes[0].Hash[:]) {
+		leaves := make([]chainhash.Hash, len(nodes))
+		for i, node := range nodes {
+			leaves[i] = node.Hash
+		}
+		coinbasePath = firstLeafPath(leaves)
+		if coinbasePath == nil {
+			coinbasePath = [][]byte{}
+		}
+	}
 
-			results, err := p.indexer.Index(ctx, &txindexer.TransactionContext{
-				TxID:  txid[:],
-				RawTx: rawTx,
-			})
-			if err != nil {
-				return fmt.Errorf("index tx %x: %w", txid[:8], err)
-			}
+	first := 0
+	if coinbasePath != nil {
+		first = 1
+	}
+	taggedTxs, err := p.indexNodes(ctx, teranode.TxIDToHex(subtreeRoot[:]), nodes, first)
+	if err != nil {
+		return fmt.Errorf("subtree %s: %w", subtreeHash, err)
+	}
 
-			terms = make([]cache.IndexTerm, len(results))
-			for j, r := range results {
-				terms[j] = cache.IndexTerm{
-					Key:   r.Key,
-					Value: r.Value,
-					Vouts: r.Vouts,
-				}
-			}
+	p.buildMu.RLock()
+	indexRoot, err := p.recordSubtree(ctx, subtreeHash, subtreeRoot[:], taggedTxs, coinbasePath, uint32(len(nodes)))
+	p.buildMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	for _, h := range p.subtreeHandlers {
+		h(ctx, subtreeRoot[:], indexRoot.Bytes())
+	}
 
-			if err := p.cache.Put(txid, terms); err != nil {
-				p.logger.Warn("cache put failed", "txid", fmt.Sprintf("%x", txid[:8]), "err", err)
-			}
+	p.retryQueuedBlocks(ctx, subtreeRoot[:])
+	return nil
+}
 
-			if err := p.writeSpendRecords(ctx, txid, rawTx); err != nil {
-				return fmt.Errorf("write spends for %x: %w", txid[:8], err)
-			}
-		}
+// recordSubtree builds the subtree's index tree and records it in the
+// metadata store.
+func (p *Processor) recordSubtree(ctx context.Context, subtreeHash string, subtreeRoot []byte, taggedTxs []treebuilder.TaggedTransaction, coinbasePath [][]byte, txCount uint32) (multihash.IndexHash, error) {
+	indexRoot, err := p.builder.BuildSubtreeIndex(ctx, taggedTxs)
+	if err != nil {
+		return nil, fmt.Errorf("build subtree index %s: %w", subtreeHash, err)
+	}
 
-		tags := make([]treebuilder.Tag, len(terms))
-		for j, t := range terms {
-			tags[j] = treebuilder.Tag{
-				Key:   t.Key,
-				Value: t.Value,
-				Vouts: t.Vouts,
-			}
+	if coinbasePath != nil {
+		if err := p.metadata.InsertCoinbasePath(ctx, subtreeRoot, coinbasePath); err != nil {
+			return nil, fmt.Errorf("insert coinbase path %s: %w", subtreeHash, err)
 		}
-
-		taggedTxs = append(taggedTxs, treebuilder.TaggedTransaction{
-			TxID:            txid,
-			SubtreePosition: uint64(i),
-			Tags:            tags,
-		})
 	}
 
-	indexRoot, err := p.builder.BuildSubtreeIndex(ctx, taggedTxs)
-	if err != nil {
-		return fmt.Errorf("build subtree index %s: %w", subtreeHash, err)
+	if err := p.metadata.InsertSubtree(ctx, subtreeRoot, indexRoot.Bytes(), txCount); err != nil {
+		return nil, err
 	}
+	return indexRoot, nil
+}
 
-	return p.metadata.InsertSubtree(ctx, subtreeRoot[:], indexRoot.Bytes(), uint32(len(nodes)))
+// BuildLock returns a lock that, while held, stops subtree index trees from
+// being written. The garbage collector holds it for each pass so that it
+// never sweeps nodes of a tree whose subtree row is not recorded yet.
+func (p *Processor) BuildLock() sync.Locker {
+	return &p.buildMu
 }
 
 func (p *Processor) writeSpendRecords(ctx context.Context, currentTxID cache.TxID, rawTx []byte) error {
@@ -160,18 +241,81 @@ func (p *Processor) writeSpendRecords(ctx context.Context, currentTxID cache.TxI
 	return nil
 }
 
-func (p *Processor) ProcessBlock(ctx context.Context, height uint32, header []byte, subtreeHashes [][]byte, txCount uint64) error {
+// ProcessBlock records a block once all of its subtrees are indexed and makes
+// it the chain tip, handling a reorg if it does not extend the current tip.
+// Blocks whose header, parent height or merkle root do not check out are
+// rejected with ErrInvalidBlock.
+//
+// A block with subtrees that are not yet indexed is queued in the metadata
+// store and ErrSubtreeNotReady is returned; it is retried automatically as
+// its subtrees arrive. Likewise a block that needs its parent to be placed
+// is queued with ErrParentNotReady and retried once the parent is recorded.
+func (p *Processor) ProcessBlock(ctx context.Context, height uint32, header []byte, coinbaseTx []byte, subtreeHashes [][]byte, txCount uint64) error {
+	p.blockMu.Lock()
+	defer p.blockMu.Unlock()
+	return p.processBlock(ctx, height, header, coinbaseTx, subtreeHashes, txCount)
+}
+
+func (p *Processor) processBlock(ctx context.Context, height uint32, header []byte, coinbaseTx []byte, subtreeHashes [][]byte, txCount uint64) error {
+	if len(header) != 80 {
+		return fmt.Errorf("%w: header must be 80 bytes, got %d", ErrInvalidBlock, len(header))
+	}
+	parsed, err := block.NewHeaderFromBytes(header)
+	if err != nil {
+		return fmt.Errorf("%w: parse header: %v", ErrInvalidBlock, err)
+	}
+	if err := checkProofOfWork(parsed, p.config.PowLimit); err != nil {
+		return err
+	}
+	blockHash := blockHashFromHeader(header)
+
+	queued := metadata.QueuedBlock{
+		Height:        height,
+		Hash:          blockHash,
+		Header:        header,
+		CoinbaseTx:    coinbaseTx,
+		TxCount:       txCount,
+		SubtreeHashes: subtreeHashes,
+	}
 	for _, hash := range subtreeHashes {
 		exists, err := p.metadata.SubtreeExists(ctx, hash)
 		if err != nil {
 			return fmt.Errorf("check subtree: %w", err)
 		}
 		if !exists {
+			if err := p.metadata.QueueBlock(ctx, queued); err != nil {
+				return fmt.Errorf("queue block: %w", err)
+			}
 			return ErrSubtreeNotReady
 		}
 	}
 
-	return p.metadata.InsertBlock(ctx, height, blockHashFromHeader(header), header, txCount, subtreeHashes)
+	if err := p.validateBlock(ctx, height, parsed, coinbaseTx, subtreeHashes); err != nil {
+		return err
+	}
+
+	err = p.connectBlock(ctx, metadata.Block{
+		Height:  height,
+		Hash:    blockHash,
+		Header:  header,
+		TxCount: txCount,
+		Status:  metadata.StatusPending,
+	}, subtreeHashes)
+	if errors.Is(err, ErrParentNotReady) {
+		if err := p.metadata.QueueBlock(ctx, queued); err != nil {
+			return fmt.Errorf("queue block: %w", err)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := p.metadata.DequeueBlock(ctx, blockHash); err != nil {
+		return fmt.Errorf("dequeue block: %w", err)
+	}
+	p.retryQueuedChildren(ctx, blockHash)
+	return nil
 }
 
 func makeOutpointKey(txid []byte, vout uint32) []byte {
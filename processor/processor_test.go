@@ -1,16 +1,21 @@
 package processor
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/bsv-blockchain/go-sdk/chainhash"
 	"github.com/shruggr/inspiration/cache"
 	"github.com/shruggr/inspiration/kvstore"
 	"github.com/shruggr/inspiration/metadata"
@@ -130,19 +135,24 @@ type mockBuilder struct {
 	returnHash multihash.IndexHash
 	returnErr  error
 	called     bool
+	txs        []treebuilder.TaggedTransaction
 }
 
-func (b *mockBuilder) BuildSubtreeIndex(_ context.Context, _ []treebuilder.TaggedTransaction) (multihash.IndexHash, error) {
+func (b *mockBuilder) BuildSubtreeIndex(_ context.Context, txs []treebuilder.TaggedTransaction) (multihash.IndexHash, error) {
 	b.called = true
+	b.txs = txs
 	return b.returnHash, b.returnErr
 }
 
 // --- Mock Metadata Store ---
 
 type memMetadata struct {
-	mu       sync.Mutex
-	subtrees map[string]metaSubtree
-	blocks   map[string]metaBlock
+	mu            sync.Mutex
+	subtrees      map[string]metaSubtree
+	blocks        map[string]metaBlock
+	coinbasePaths map[string][][]byte
+	queued        map[string]metadata.QueuedBlock
+	checkpoints   map[string]uint32
 }
 
 type metaSubtree struct {
@@ -155,12 +165,16 @@ type metaBlock struct {
 	header        []byte
 	txCount       uint64
 	subtreeHashes [][]byte
+	status        string
 }
 
 func newMemMetadata() *memMetadata {
 	return &memMetadata{
-		subtrees: make(map[string]metaSubtree),
-		blocks:   make(map[string]metaBlock),
+		subtrees:      make(map[string]metaSubtree),
+		blocks:        make(map[string]metaBlock),
+		coinbasePaths: make(map[string][][]byte),
+		queued:        make(map[string]metadata.QueuedBlock),
+		checkpoints:   make(map[string]uint32),
 	}
 }
 
@@ -172,12 +186,70 @@ func (m *memMetadata) InsertSubtree(_ context.Context, hash, indexRoot []byte, t
 }
 
 func (m *memMetadata) InsertBlock(_ context.Context, height uint32, blockHash, header []byte, txCount uint64, subtreeHashes [][]byte) error {
+	return m.insertBlock(metadata.StatusPending, height, blockHash, header, txCount, subtreeHashes)
+}
+
+func (m *memMetadata) InsertSideBlock(_ context.Context, height uint32, blockHash, header []byte, txCount uint64, subtreeHashes [][]byte) error {
+	return m.insertBlock(metadata.StatusOrphaned, height, blockHash, header, txCount, subtreeHashes)
+}
+
+func (m *memMetadata) insertBlock(status string, height uint32, blockHash, header []byte, txCount uint64, subtreeHashes [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.blocks[string(blockHash)]; ok {
+		return fmt.Errorf("block %x already exists", blockHash)
+	}
+	m.blocks[string(blockHash)] = metaBlock{height: height, header: header, txCount: txCount, subtreeHashes: subtreeHashes, status: status}
+	return nil
+}
+
+func (m *memMetadata) InsertCoinbasePath(_ context.Context, subtreeHash []byte, path [][]byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.blocks[string(blockHash)] = metaBlock{height: height, header: header, txCount: txCount, subtreeHashes: subtreeHashes}
+	m.coinbasePaths[string(subtreeHash)] = path
 	return nil
 }
 
+func (m *memMetadata) GetCoinbasePath(_ context.Context, subtreeHash []byte) ([][]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, ok := m.coinbasePaths[string(subtreeHash)]
+	return path, ok, nil
+}
+
+func (m *memMetadata) GetBlock(_ context.Context, blockHash []byte) (*metadata.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blocks[string(blockHash)]
+	if !ok {
+		return nil, nil
+	}
+	return &metadata.Block{Height: b.height, Hash: blockHash, Header: b.header, TxCount: b.txCount, Status: b.status}, nil
+}
+
+func (m *memMetadata) GetTip(_ context.Context) (*metadata.Block, error) {
+	return m.tip(func(status string) bool { return status == metadata.StatusConfirmed }), nil
+}
+
+func (m *memMetadata) GetChainTip(_ context.Context) (*metadata.Block, error) {
+	return m.tip(func(status string) bool { return status != metadata.StatusOrphaned }), nil
+}
+
+func (m *memMetadata) tip(keep func(status string) bool) *metadata.Block {
+	blocks := m.blocksInRange(keep, 0, math.MaxUint32)
+	if len(blocks) == 0 {
+		return nil
+	}
+	// The highest block, lowest hash first on a tie
+	tip := blocks[len(blocks)-1]
+	for _, b := range blocks {
+		if b.Height == tip.Height {
+			return &b
+		}
+	}
+	return &tip
+}
+
 func (m *memMetadata) GetBlockSubtrees(_ context.Context, blockHash []byte) ([][]byte, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -188,6 +260,32 @@ func (m *memMetadata) GetBlockSubtrees(_ context.Context, blockHash []byte) ([][
 	return b.subtreeHashes, nil
 }
 
+func (m *memMetadata) GetBlocksByHeightRange(_ context.Context, fromHeight, toHeight uint32) ([]metadata.Block, error) {
+	return m.blocksInRange(func(status string) bool { return status == metadata.StatusConfirmed }, fromHeight, toHeight), nil
+}
+
+func (m *memMetadata) GetChainBlocks(_ context.Context, fromHeight, toHeight uint32) ([]metadata.Block, error) {
+	return m.blocksInRange(func(status string) bool { return status != metadata.StatusOrphaned }, fromHeight, toHeight), nil
+}
+
+func (m *memMetadata) blocksInRange(keep func(status string) bool, fromHeight, toHeight uint32) []metadata.Block {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var blocks []metadata.Block
+	for hash, b := range m.blocks {
+		if b.height >= fromHeight && b.height <= toHeight && keep(b.status) {
+			blocks = append(blocks, metadata.Block{Height: b.height, Hash: []byte(hash), Header: b.header, TxCount: b.txCount, Status: b.status})
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].Height != blocks[j].Height {
+			return blocks[i].Height < blocks[j].Height
+		}
+		return bytes.Compare(blocks[i].Hash, blocks[j].Hash) < 0
+	})
+	return blocks
+}
+
 func (m *memMetadata) GetSubtreeIndexRoot(_ context.Context, subtreeHash []byte) ([]byte, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -205,10 +303,111 @@ func (m *memMetadata) SubtreeExists(_ context.Context, subtreeHash []byte) (bool
 	return ok, nil
 }
 
-func (m *memMetadata) PromoteBlock(context.Context, []byte) error              { return nil }
-func (m *memMetadata) OrphanBlock(context.Context, []byte) error               { return nil }
+func (m *memMetadata) PromoteBlock(context.Context, []byte) error { return nil }
+
+func (m *memMetadata) OrphanBlock(_ context.Context, blockHash []byte) error {
+	return m.setStatus(blockHash, metadata.StatusOrphaned)
+}
+
+func (m *memMetadata) ReinstateBlock(_ context.Context, blockHash []byte) error {
+	return m.setStatus(blockHash, metadata.StatusPending)
+}
+
+func (m *memMetadata) setStatus(blockHash []byte, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b, ok := m.blocks[string(blockHash)]; ok {
+		b.status = status
+		m.blocks[string(blockHash)] = b
+	}
+	return nil
+}
+
 func (m *memMetadata) GetUnpromotedBlocks(context.Context, uint32) ([][]byte, error) { return nil, nil }
-func (m *memMetadata) Close() error                                            { return nil }
+func (m *memMetadata) GetUnpromotedSubtrees(context.Context) ([]metadata.Subtree, error) {
+	return nil, nil
+}
+
+func (m *memMetadata) DeleteSubtree(_ context.Context, subtreeHash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subtrees, string(subtreeHash))
+	return nil
+}
+
+func (m *memMetadata) QueueBlock(_ context.Context, block metadata.QueuedBlock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.queued[string(block.Hash)]; !ok {
+		block.QueuedAt = time.Now()
+		m.queued[string(block.Hash)] = block
+	}
+	return nil
+}
+
+func (m *memMetadata) GetQueuedBlocks(_ context.Context) ([]metadata.QueuedBlock, error) {
+	return m.queuedBlocks(nil), nil
+}
+
+func (m *memMetadata) GetQueuedBlocksBySubtree(_ context.Context, subtreeHash []byte) ([]metadata.QueuedBlock, error) {
+	return m.queuedBlocks(subtreeHash), nil
+}
+
+func (m *memMetadata) queuedBlocks(subtreeHash []byte) []metadata.QueuedBlock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []metadata.QueuedBlock
+	for _, b := range m.queued {
+		include := subtreeHash == nil
+		b.Missing = nil
+		for _, h := range b.SubtreeHashes {
+			if _, ok := m.subtrees[string(h)]; !ok {
+				b.Missing = append(b.Missing, h)
+			}
+			include = include || bytes.Equal(h, subtreeHash)
+		}
+		if include {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Height < out[j].Height })
+	return out
+}
+
+func (m *memMetadata) DequeueBlock(_ context.Context, blockHash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queued, string(blockHash))
+	return nil
+}
+
+func (m *memMetadata) GetTipHeight(context.Context) (uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tip uint32
+	for _, b := range m.blocks {
+		if b.status != metadata.StatusOrphaned && b.height > tip {
+			tip = b.height
+		}
+	}
+	return tip, nil
+}
+
+func (m *memMetadata) SetCheckpoint(_ context.Context, name string, height uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints[name] = height
+	return nil
+}
+
+func (m *memMetadata) GetCheckpoint(_ context.Context, name string) (uint32, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	height, ok := m.checkpoints[name]
+	return height, ok, nil
+}
+
+func (m *memMetadata) Close() error { return nil }
 
 // --- Helpers ---
 
@@ -337,7 +536,7 @@ func TestProcessSubtree(t *testing.T) {
 	logger := slog.Default()
 	client := teranode.NewClient(srv.URL)
 
-	p := NewProcessor(dualStore, spendStore, termCache, indexer, client, builder, meta, logger)
+	p := NewProcessor(dualStore, spendStore, termCache, indexer, client, builder, meta, DefaultConfig(), logger)
 
 	err = p.processSubtreeData(context.Background(), "test-subtree", subtreeData)
 	if err != nil {
@@ -388,13 +587,55 @@ func TestProcessSubtree(t *testing.T) {
 	}
 }
 
+func TestProcessSubtreeCoinbasePlaceholder(t *testing.T) {
+	txid1 := [32]byte{0x01}
+	rawTx1 := buildMinimalRawTx([32]byte{0xaa}, 0)
+	subtreeData := buildMinimalSubtreeData([][32]byte{coinbasePlaceholder, txid1})
+
+	// Only txid1 can be fetched; the placeholder must not be requested
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/tx/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path[len("/api/v1/tx/"):] != teranode.TxIDToHex(txid1[:]) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(rawTx1)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	fakeIndexRoot, err := multihash.NewIndexHash([]byte("fake-index-root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := &mockBuilder{returnHash: fakeIndexRoot}
+	meta := newMemMetadata()
+	p := NewProcessor(store.NewDualStore(newMemKVStore(), newMemKVStore()), newMemKVStore(), newMemCache(),
+		newMockIndexer(), teranode.NewClient(srv.URL), builder, meta, DefaultConfig(), slog.Default())
+
+	if err := p.processSubtreeData(context.Background(), "test-subtree", subtreeData); err != nil {
+		t.Fatalf("processSubtreeData failed: %v", err)
+	}
+
+	if len(builder.txs) != 1 || builder.txs[0].TxID != txid1 || builder.txs[0].SubtreePosition != 1 {
+		t.Fatalf("expected only txid1 at position 1 to be indexed, got %+v", builder.txs)
+	}
+
+	path, ok, _ := meta.GetCoinbasePath(context.Background(), subtreeData[:32])
+	if !ok || len(path) != 1 || !bytes.Equal(path[0], txid1[:]) {
+		t.Fatalf("coinbase path: got %x, ok=%v", path, ok)
+	}
+}
+
 func TestProcessBlockAllSubtreesReady(t *testing.T) {
 	meta := newMemMetadata()
 
 	subtreeHash1 := []byte("subtree-hash-1-that-is-32-bytes!")
 	subtreeHash2 := []byte("subtree-hash-2-that-is-32-bytes!")
+	sibling := chainhash.Hash{0x42}
 
-	// Pre-insert subtrees
+	// Pre-insert subtrees; the first holds the coinbase placeholder and one tx
+	meta.InsertCoinbasePath(context.Background(), subtreeHash1, [][]byte{sibling[:]})
 	meta.InsertSubtree(context.Background(), subtreeHash1, []byte("index-root-1"), 10)
 	meta.InsertSubtree(context.Background(), subtreeHash2, []byte("index-root-2"), 20)
 
@@ -403,10 +644,13 @@ func TestProcessBlockAllSubtreesReady(t *testing.T) {
 		logger:   slog.Default(),
 	}
 
-	header := make([]byte, 80)
-	header[0] = 0x01 // version byte
+	coinbase := []byte("coinbase")
+	var second chainhash.Hash
+	copy(second[:], subtreeHash2)
+	root := hashPair(hashPair(chainhash.DoubleHashH(coinbase), sibling), second)
+	header := mineHeader(nil, root)
 
-	err := p.ProcessBlock(context.Background(), 100, header, [][]byte{subtreeHash1, subtreeHash2}, 30)
+	err := p.ProcessBlock(context.Background(), 100, header, coinbase, [][]byte{subtreeHash1, subtreeHash2}, 30)
 	if err != nil {
 		t.Fatalf("ProcessBlock failed: %v", err)
 	}
@@ -436,12 +680,18 @@ func TestProcessBlockMissingSubtree(t *testing.T) {
 		logger:   slog.Default(),
 	}
 
-	header := make([]byte, 80)
+	header := mineHeader(nil, chainhash.Hash{})
 
-	err := p.ProcessBlock(context.Background(), 100, header, [][]byte{subtreeHash1, subtreeHash2}, 30)
+	err := p.ProcessBlock(context.Background(), 100, header, nil, [][]byte{subtreeHash1, subtreeHash2}, 30)
 	if !errors.Is(err, ErrSubtreeNotReady) {
 		t.Fatalf("expected ErrSubtreeNotReady, got: %v", err)
 	}
+
+	// The block is queued waiting on the second subtree
+	queued, _ := meta.GetQueuedBlocks(context.Background())
+	if len(queued) != 1 || len(queued[0].Missing) != 1 || !bytes.Equal(queued[0].Missing[0], subtreeHash2) {
+		t.Fatalf("expected block queued on subtree 2, got %+v", queued)
+	}
 }
 
 func TestParseSubtreeNodes(t *testing.T) {
@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shruggr/inspiration/metadata"
+)
+
+// RetryQueuedBlocks processes every queued block whose subtrees are all
+// indexed. It is called on startup to pick up blocks whose last subtree
+// arrived just before a shutdown.
+func (p *Processor) RetryQueuedBlocks(ctx context.Context) error {
+	p.blockMu.Lock()
+	defer p.blockMu.Unlock()
+
+	blocks, err := p.metadata.GetQueuedBlocks(ctx)
+	if err != nil {
+		return fmt.Errorf("get queued blocks: %w", err)
+	}
+	p.processQueued(ctx, blocks)
+	return nil
+}
+
+// retryQueuedBlocks processes the queued blocks that were waiting on the
+// newly indexed subtree and are now complete.
+func (p *Processor) retryQueuedBlocks(ctx context.Context, subtreeHash []byte) {
+	p.blockMu.Lock()
+	defer p.blockMu.Unlock()
+
+	blocks, err := p.metadata.GetQueuedBlocksBySubtree(ctx, subtreeHash)
+	if err != nil {
+		p.logger.Error("get queued blocks", "subtree", fmt.Sprintf("%x", subtreeHash), "error", err)
+		return
+	}
+	p.processQueued(ctx, blocks)
+}
+
+// retryQueuedChildren processes the queued blocks that were waiting on the
+// newly recorded block as their parent. The caller holds blockMu.
+func (p *Processor) retryQueuedChildren(ctx context.Context, parentHash []byte) {
+	blocks, err := p.metadata.GetQueuedBlocks(ctx)
+	if err != nil {
+		p.logger.Error("get queued blocks", "parent", fmt.Sprintf("%x", parentHash), "error", err)
+		return
+	}
+	var children []metadata.QueuedBlock
+	for _, b := range blocks {
+		child := metadata.Block{Header: b.Header}
+		if bytes.Equal(child.PrevHash(), parentHash) {
+			children = append(children, b)
+		}
+	}
+	p.processQueued(ctx, children)
+}
+
+// processQueued processes complete blocks lowest first. Invalid blocks are
+// dropped from the queue; other failures leave them queued.
+func (p *Processor) processQueued(ctx context.Context, blocks []metadata.QueuedBlock) {
+	for _, b := range blocks {
+		if len(b.Missing) > 0 {
+			continue
+		}
+		err := p.processBlock(ctx, b.Height, b.Header, b.CoinbaseTx, b.SubtreeHashes, b.TxCount)
+		switch {
+		case err == nil:
+			p.logger.Info("processed queued block", "height", b.Height, "waited", time.Since(b.QueuedAt).Round(time.Second))
+		case errors.Is(err, ErrParentNotReady):
+			p.logger.Debug("queued block still waiting on its parent", "height", b.Height)
+		case errors.Is(err, ErrInvalidBlock):
+			p.logger.Warn("dropping invalid queued block", "height", b.Height, "error", err)
+			if err := p.metadata.DequeueBlock(ctx, b.Hash); err != nil {
+				p.logger.Error("dequeue block", "height", b.Height, "error", err)
+			}
+		default:
+			p.logger.Error("process queued block", "height", b.Height, "error", err)
+		}
+	}
+}
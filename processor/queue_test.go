@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/shruggr/inspiration/multihash"
+	"github.com/shruggr/inspiration/store"
+	"github.com/shruggr/inspiration/teranode"
+)
+
+func TestQueuedBlockRetriedWhenSubtreeArrives(t *testing.T) {
+	ctx := context.Background()
+
+	txid1 := [32]byte{0x01}
+	rawTx1 := buildMinimalRawTx([32]byte{0xaa}, 0)
+	subtreeData := buildMinimalSubtreeData([][32]byte{coinbasePlaceholder, txid1})
+	subtreeHash := subtreeData[:32]
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/tx/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(rawTx1)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	fakeIndexRoot, err := multihash.NewIndexHash([]byte("fake-index-root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := newMemMetadata()
+	p := NewProcessor(store.NewDualStore(newMemKVStore(), newMemKVStore()), newMemKVStore(), newMemCache(),
+		newMockIndexer(), teranode.NewClient(srv.URL), &mockBuilder{returnHash: fakeIndexRoot}, meta, Config{}, slog.Default())
+
+	coinbase := []byte("coinbase")
+	header := mineHeader(nil, hashPair(chainhash.DoubleHashH(coinbase), txid1))
+	if err := p.ProcessBlock(ctx, 100, header, coinbase, [][]byte{subtreeHash}, 2); !errors.Is(err, ErrSubtreeNotReady) {
+		t.Fatalf("expected ErrSubtreeNotReady, got %v", err)
+	}
+
+	if err := p.processSubtreeData(ctx, "test-subtree", subtreeData); err != nil {
+		t.Fatalf("processSubtreeData failed: %v", err)
+	}
+
+	b, _ := meta.GetBlock(ctx, blockHashFromHeader(header))
+	if b == nil {
+		t.Fatal("expected queued block to be processed once its subtree arrived")
+	}
+	if queued, _ := meta.GetQueuedBlocks(ctx); len(queued) != 0 {
+		t.Errorf("expected empty queue, got %d blocks", len(queued))
+	}
+}
+
+func TestRetryQueuedBlocks(t *testing.T) {
+	ctx := context.Background()
+	meta := newMemMetadata()
+	p := &Processor{metadata: meta, logger: slog.Default()}
+
+	subtree := []byte("subtree-hash-1-that-is-32-bytes!")
+	coinbase := []byte("coinbase")
+	valid := mineHeader(nil, chainhash.DoubleHashH(coinbase))
+	invalid := mineHeader(nil, chainhash.Hash{0xBA, 0xD})
+	waiting := mineHeader(nil, chainhash.Hash{0x1})
+
+	for _, h := range [][]byte{valid, invalid} {
+		if err := p.ProcessBlock(ctx, 100, h, coinbase, [][]byte{subtree}, 1); !errors.Is(err, ErrSubtreeNotReady) {
+			t.Fatalf("expected ErrSubtreeNotReady, got %v", err)
+		}
+	}
+	other := bytes.Repeat([]byte{0x0F}, 32)
+	if err := p.ProcessBlock(ctx, 101, waiting, coinbase, [][]byte{other}, 1); !errors.Is(err, ErrSubtreeNotReady) {
+		t.Fatalf("expected ErrSubtreeNotReady, got %v", err)
+	}
+
+	// The subtree, holding just the coinbase, arrives without triggering a
+	// retry, as if the indexer stopped right after storing it.
+	meta.InsertCoinbasePath(ctx, subtree, [][]byte{})
+	meta.InsertSubtree(ctx, subtree, []byte("index-root"), 1)
+	if err := p.RetryQueuedBlocks(ctx); err != nil {
+		t.Fatalf("RetryQueuedBlocks failed: %v", err)
+	}
+
+	queued, _ := meta.GetQueuedBlocks(ctx)
+	if len(queued) != 1 || !bytes.Equal(queued[0].Hash, blockHashFromHeader(waiting)) {
+		t.Fatalf("expected only the block waiting on a missing subtree to remain, got %d", len(queued))
+	}
+	if b, _ := meta.GetBlock(ctx, blockHashFromHeader(valid)); b == nil {
+		t.Error("expected valid block to be recorded")
+	}
+	if b, _ := meta.GetBlock(ctx, blockHashFromHeader(invalid)); b != nil {
+		t.Error("invalid block was recorded")
+	}
+}
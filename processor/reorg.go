@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/shruggr/inspiration/metadata"
+)
+
+// ReorgEvent describes a switch of the best chain to a different branch.
+type ReorgEvent struct {
+	ForkHeight   uint32           // height of the last block common to both branches
+	ForkHash     []byte           // hash of the fork point block
+	Disconnected []metadata.Block // blocks removed from the best chain, highest first
+	Connected    []metadata.Block // blocks added to the best chain, lowest first; the new tip is last
+}
+
+// ReorgHandler is called after the metadata store has switched to the new branch.
+type ReorgHandler func(ctx context.Context, ev ReorgEvent)
+
+// OnReorg registers h to be called for every reorg. Handlers must be
+// registered before blocks are processed.
+func (p *Processor) OnReorg(h ReorgHandler) {
+	p.reorgHandlers = append(p.reorgHandlers, h)
+}
+
+// connectBlock records the block and makes it the chain tip if it extends
+// the best chain or its branch is now longer, orphaning whatever part of the
+// best chain it does not build on. A block on a branch that is no longer is
+// kept as a side branch, and one whose parent is unknown and that competes
+// with a best-chain block returns ErrParentNotReady.
+//
+// Displaced blocks are orphaned before the new branch is connected, so if
+// this is interrupted the redelivered block finds the fork point as the tip
+// and completes the switch.
+func (p *Processor) connectBlock(ctx context.Context, block metadata.Block, subtreeHashes [][]byte) error {
+	existing, err := p.metadata.GetBlock(ctx, block.Hash)
+	if err != nil {
+		return fmt.Errorf("get block: %w", err)
+	}
+	if existing != nil && existing.Status != metadata.StatusOrphaned {
+		return nil
+	}
+
+	tip, err := p.metadata.GetChainTip(ctx)
+	if err != nil {
+		return fmt.Errorf("get tip: %w", err)
+	}
+	if tip == nil || bytes.Equal(tip.Hash, block.PrevHash()) {
+		if err := p.attachBlock(ctx, existing, block, subtreeHashes); err != nil {
+			return err
+		}
+		p.notifyBlocksConnected(ctx, []metadata.Block{block})
+		return nil
+	}
+
+	// Walk back through side-branch ancestors until reaching a block on the
+	// best chain, the fork point. It stays nil if an ancestor is unknown.
+	var revived []metadata.Block
+	var fork *metadata.Block
+	for prev := block.PrevHash(); ; {
+		b, err := p.metadata.GetBlock(ctx, prev)
+		if err != nil {
+			return fmt.Errorf("get ancestor %x: %w", prev, err)
+		}
+		if b == nil {
+			break
+		}
+		if b.Status != metadata.StatusOrphaned {
+			fork = b
+			break
+		}
+		revived = append([]metadata.Block{*b}, revived...)
+		prev = b.PrevHash()
+	}
+
+	// A block building on the best chain or on an unknown parent, at a
+	// height the best chain has no block for, fills a gap, as when history
+	// is backfilled behind live blocks or blocks resume after downtime, and
+	// displaces nothing.
+	if len(revived) == 0 {
+		atHeight, err := p.metadata.GetChainBlocks(ctx, block.Height, block.Height)
+		if err != nil {
+			return fmt.Errorf("get blocks at height %d: %w", block.Height, err)
+		}
+		if len(atHeight) == 0 {
+			if err := p.attachBlock(ctx, existing, block, subtreeHashes); err != nil {
+				return err
+			}
+			p.notifyBlocksConnected(ctx, []metadata.Block{block})
+			return nil
+		}
+		if fork == nil {
+			return ErrParentNotReady
+		}
+	}
+
+	// Only a longer branch with a known fork point displaces the best chain.
+	if fork == nil || block.Height <= tip.Height {
+		if existing == nil {
+			err := p.metadata.InsertSideBlock(ctx, block.Height, block.Hash, block.Header, block.TxCount, subtreeHashes)
+			if err != nil {
+				return fmt.Errorf("insert side block: %w", err)
+			}
+		}
+		p.logger.Info("block recorded on a side branch", "height", block.Height, "tip", tip.Height, "hash", fmt.Sprintf("%x", block.Hash))
+		return nil
+	}
+
+	forkHeight, forkHash := fork.Height, fork.Hash
+	displaced, err := p.metadata.GetChainBlocks(ctx, forkHeight+1, math.MaxUint32)
+	if err != nil {
+		return fmt.Errorf("get displaced blocks: %w", err)
+	}
+
+	for i := len(displaced) - 1; i >= 0; i-- {
+		if err := p.metadata.OrphanBlock(ctx, displaced[i].Hash); err != nil {
+			return fmt.Errorf("orphan block %x: %w", displaced[i].Hash, err)
+		}
+	}
+	for _, b := range revived {
+		if err := p.metadata.ReinstateBlock(ctx, b.Hash); err != nil {
+			return fmt.Errorf("reinstate block %x: %w", b.Hash, err)
+		}
+	}
+	if err := p.attachBlock(ctx, existing, block, subtreeHashes); err != nil {
+		return err
+	}
+
+	connected := append(revived, block)
+	if len(displaced) == 0 {
+		p.notifyBlocksConnected(ctx, connected)
+		return nil
+	}
+
+	ev := ReorgEvent{
+		ForkHeight: forkHeight,
+		ForkHash:   forkHash,
+		Connected:  connected,
+	}
+	for i := len(displaced) - 1; i >= 0; i-- {
+		ev.Disconnected = append(ev.Disconnected, displaced[i])
+	}
+	p.logger.Warn("chain reorganization",
+		"fork_height", forkHeight,
+		"disconnected", len(ev.Disconnected),
+		"connected", len(ev.Connected),
+		"tip", fmt.Sprintf("%x", block.Hash),
+	)
+	for _, h := range p.reorgHandlers {
+		h(ctx, ev)
+	}
+	p.notifyBlocksConnected(ctx, connected)
+	return nil
+}
+
+// attachBlock records block on top of the current tip, reinstating it if it
+// was previously orphaned.
+func (p *Processor) attachBlock(ctx context.Context, existing *metadata.Block, block metadata.Block, subtreeHashes [][]byte) error {
+	if existing != nil {
+		return p.metadata.ReinstateBlock(ctx, block.Hash)
+	}
+	return p.metadata.InsertBlock(ctx, block.Height, block.Hash, block.Header, block.TxCount, subtreeHashes)
+}
@@ -0,0 +1,281 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/shruggr/inspiration/metadata"
+)
+
+// testBlock builds a mined header linking to prev for a block with no
+// subtrees, along with its coinbase; tag distinguishes competing blocks at
+// the same height.
+func testBlock(prev []byte, tag byte) (header, coinbase []byte) {
+	coinbase = []byte{'c', 'b', tag}
+	return mineHeader(prev, chainhash.DoubleHashH(coinbase)), coinbase
+}
+
+type reorgHarness struct {
+	p         *Processor
+	meta      *memMetadata
+	events    []ReorgEvent
+	connected [][]byte
+}
+
+func newReorgHarness() *reorgHarness {
+	h := &reorgHarness{meta: newMemMetadata()}
+	h.p = &Processor{metadata: h.meta, logger: slog.Default()}
+	h.p.OnReorg(func(_ context.Context, ev ReorgEvent) {
+		h.events = append(h.events, ev)
+	})
+	h.p.OnBlockConnected(func(_ context.Context, b metadata.Block) {
+		h.connected = append(h.connected, b.Hash)
+	})
+	return h
+}
+
+// add processes a block without subtrees and returns its hash.
+func (h *reorgHarness) add(t *testing.T, height uint32, prev []byte, tag byte) []byte {
+	t.Helper()
+	header, coinbase := testBlock(prev, tag)
+	if err := h.p.ProcessBlock(context.Background(), height, header, coinbase, nil, 1); err != nil {
+		t.Fatalf("ProcessBlock(%d): %v", height, err)
+	}
+	return blockHashFromHeader(header)
+}
+
+func (h *reorgHarness) status(t *testing.T, hash []byte) string {
+	t.Helper()
+	b, err := h.meta.GetBlock(context.Background(), hash)
+	if err != nil || b == nil {
+		t.Fatalf("GetBlock %x: %v, %v", hash[:4], b, err)
+	}
+	return b.Status
+}
+
+func hashesOf(blocks []metadata.Block) [][]byte {
+	out := make([][]byte, len(blocks))
+	for i, b := range blocks {
+		out[i] = b.Hash
+	}
+	return out
+}
+
+func sameHashes(got, want [][]byte) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestProcessBlockExtendsTip(t *testing.T) {
+	h := newReorgHarness()
+	a := h.add(t, 100, nil, 0)
+	b := h.add(t, 101, a, 0)
+
+	// Redelivery of the tip is a no-op
+	h.add(t, 101, a, 0)
+
+	tip, _ := h.meta.GetChainTip(context.Background())
+	if tip == nil || !bytes.Equal(tip.Hash, b) {
+		t.Fatalf("tip: got %+v", tip)
+	}
+	if len(h.events) != 0 {
+		t.Errorf("unexpected reorg events: %d", len(h.events))
+	}
+}
+
+func TestProcessBlockReorg(t *testing.T) {
+	h := newReorgHarness()
+	a := h.add(t, 100, nil, 0)
+	b := h.add(t, 101, a, 0)
+	c := h.add(t, 102, b, 0)
+
+	// A competing branch is kept on the side until it is longer
+	b2 := h.add(t, 101, a, 1)
+	c2 := h.add(t, 102, b2, 1)
+	if len(h.events) != 0 {
+		t.Fatalf("side branch produced reorg events: %+v", h.events)
+	}
+	for _, hash := range [][]byte{b2, c2} {
+		if s := h.status(t, hash); s != metadata.StatusOrphaned {
+			t.Errorf("side block %x: status %q, want orphaned", hash[:4], s)
+		}
+	}
+	tip, _ := h.meta.GetChainTip(context.Background())
+	if tip == nil || !bytes.Equal(tip.Hash, c) {
+		t.Fatalf("tip moved to %+v", tip)
+	}
+
+	d2 := h.add(t, 103, c2, 1)
+	if len(h.events) != 1 {
+		t.Fatalf("reorg events: got %d, want 1", len(h.events))
+	}
+	ev := h.events[0]
+	if ev.ForkHeight != 100 || !bytes.Equal(ev.ForkHash, a) {
+		t.Errorf("fork point: got %d %x", ev.ForkHeight, ev.ForkHash)
+	}
+	if !sameHashes(hashesOf(ev.Disconnected), [][]byte{c, b}) {
+		t.Errorf("disconnected: got %x", hashesOf(ev.Disconnected))
+	}
+	if !sameHashes(hashesOf(ev.Connected), [][]byte{b2, c2, d2}) {
+		t.Errorf("connected: got %x", hashesOf(ev.Connected))
+	}
+	for _, hash := range [][]byte{b, c} {
+		if s := h.status(t, hash); s != metadata.StatusOrphaned {
+			t.Errorf("block %x: status %q, want orphaned", hash[:4], s)
+		}
+	}
+
+	// Heights now resolve to the new branch
+	blocks, _ := h.meta.GetChainBlocks(context.Background(), 101, 103)
+	if !sameHashes(hashesOf(blocks), [][]byte{b2, c2, d2}) {
+		t.Errorf("blocks at 101-103: got %x", hashesOf(blocks))
+	}
+
+	if !sameHashes(h.connected, [][]byte{a, b, c, b2, c2, d2}) {
+		t.Errorf("connected notifications: got %x", h.connected)
+	}
+
+	// The original branch grows longer and takes over again, reviving b and c
+	d := h.add(t, 103, c, 2)
+	e := h.add(t, 104, d, 2)
+	if !sameHashes(h.connected[6:], [][]byte{b, c, d, e}) {
+		t.Errorf("connected notifications after revival: got %x", h.connected[6:])
+	}
+	if len(h.events) != 2 {
+		t.Fatalf("reorg events: got %d, want 2", len(h.events))
+	}
+	ev = h.events[1]
+	if !sameHashes(hashesOf(ev.Disconnected), [][]byte{d2, c2, b2}) {
+		t.Errorf("disconnected: got %x", hashesOf(ev.Disconnected))
+	}
+	if !sameHashes(hashesOf(ev.Connected), [][]byte{b, c, d, e}) {
+		t.Errorf("connected: got %x", hashesOf(ev.Connected))
+	}
+	if s := h.status(t, b); s != metadata.StatusPending {
+		t.Errorf("revived block status %q, want pending", s)
+	}
+}
+
+func TestProcessBlockStaleSibling(t *testing.T) {
+	h := newReorgHarness()
+	a := h.add(t, 100, nil, 0)
+	b := h.add(t, 101, a, 0)
+	c := h.add(t, 102, b, 0)
+
+	// A late block below the tip does not rewind the index
+	stale := h.add(t, 101, a, 1)
+	if len(h.events) != 0 {
+		t.Fatalf("stale block produced reorg events: %+v", h.events)
+	}
+	if s := h.status(t, stale); s != metadata.StatusOrphaned {
+		t.Errorf("stale block status %q, want orphaned", s)
+	}
+	for _, hash := range [][]byte{a, b, c} {
+		if s := h.status(t, hash); s != metadata.StatusPending {
+			t.Errorf("block %x: status %q, want pending", hash[:4], s)
+		}
+	}
+
+	// Redelivery of a side block is a no-op
+	h.add(t, 101, a, 1)
+	if !sameHashes(h.connected, [][]byte{a, b, c}) {
+		t.Errorf("connected notifications: got %x", h.connected)
+	}
+}
+
+func TestProcessBlockUnknownParent(t *testing.T) {
+	h := newReorgHarness()
+	ctx := context.Background()
+	a := h.add(t, 100, nil, 0)
+	b := h.add(t, 101, a, 0)
+
+	// A block whose parent was never seen competing with a best-chain block
+	// is queued rather than guessing where it forks
+	z, _ := testBlock(bytes.Repeat([]byte{0xEE}, 32), 0)
+	y, _ := testBlock(blockHashFromHeader(z), 1)
+	x, xCoinbase := testBlock(blockHashFromHeader(y), 2)
+	err := h.p.ProcessBlock(ctx, 101, x, xCoinbase, nil, 1)
+	if !errors.Is(err, ErrParentNotReady) {
+		t.Fatalf("ProcessBlock: got %v, want ErrParentNotReady", err)
+	}
+	if queued, _ := h.meta.GetQueuedBlocks(ctx); len(queued) != 1 {
+		t.Fatalf("queued blocks: got %d, want 1", len(queued))
+	}
+	if len(h.events) != 0 {
+		t.Fatalf("reorg events: %+v", h.events)
+	}
+	if s := h.status(t, b); s != metadata.StatusPending {
+		t.Errorf("best-chain block status %q, want pending", s)
+	}
+
+	// Once its ancestry reaches the best chain it is recorded on a side
+	// branch, and a longer branch takes over from the known fork point
+	zHash := h.add(t, 99, bytes.Repeat([]byte{0xEE}, 32), 0)
+	h.add(t, 100, zHash, 1)
+	if queued, _ := h.meta.GetQueuedBlocks(ctx); len(queued) != 0 {
+		t.Fatalf("child still queued: %+v", queued)
+	}
+	xHash := blockHashFromHeader(x)
+	if s := h.status(t, xHash); s != metadata.StatusOrphaned {
+		t.Errorf("dequeued block status %q, want orphaned", s)
+	}
+	w := h.add(t, 102, xHash, 3)
+	if len(h.events) != 1 || h.events[0].ForkHeight != 99 || !bytes.Equal(h.events[0].ForkHash, zHash) {
+		t.Fatalf("reorg events: %+v", h.events)
+	}
+	if !sameHashes(hashesOf(h.events[0].Connected), [][]byte{blockHashFromHeader(y), xHash, w}) {
+		t.Errorf("connected: got %x", hashesOf(h.events[0].Connected))
+	}
+
+	// A gap above the tip is accepted without a reorg
+	h.add(t, 105, bytes.Repeat([]byte{0xDD}, 32), 0)
+	if len(h.events) != 1 {
+		t.Errorf("gap produced a reorg event")
+	}
+	if s := h.status(t, w); s != metadata.StatusPending {
+		t.Errorf("block below gap status %q, want pending", s)
+	}
+}
+
+func TestProcessBlockFillsGap(t *testing.T) {
+	h := newReorgHarness()
+	a := h.add(t, 100, nil, 0)
+	b := h.add(t, 101, a, 0)
+	c := h.add(t, 105, bytes.Repeat([]byte{0xDD}, 32), 0)
+
+	// Blocks backfilled below the tip take the empty heights without
+	// displacing anything
+	h.add(t, 103, bytes.Repeat([]byte{0xCC}, 32), 0)
+	if len(h.events) != 0 {
+		t.Fatalf("gap fill produced reorg events: %+v", h.events)
+	}
+	for _, hash := range [][]byte{a, b, c} {
+		if s := h.status(t, hash); s != metadata.StatusPending {
+			t.Errorf("block %x: status %q, want pending", hash[:4], s)
+		}
+	}
+	tip, _ := h.meta.GetChainTip(context.Background())
+	if tip == nil || !bytes.Equal(tip.Hash, c) {
+		t.Errorf("tip moved to %+v", tip)
+	}
+
+	// An occupied height below the tip goes to a side branch
+	sibling := h.add(t, 101, a, 1)
+	if len(h.events) != 0 {
+		t.Errorf("reorg events: got %d, want 0", len(h.events))
+	}
+	if s := h.status(t, sibling); s != metadata.StatusOrphaned {
+		t.Errorf("sibling status %q, want orphaned", s)
+	}
+}
@@ -0,0 +1,179 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/bsv-blockchain/go-sdk/block"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+)
+
+// ErrInvalidBlock is returned by ProcessBlock for blocks that fail header,
+// linkage or merkle root validation. Such blocks are never recorded.
+var ErrInvalidBlock = errors.New("invalid block")
+
+// MainnetPowLimit is the compact form of the easiest target allowed on mainnet.
+const MainnetPowLimit = 0x1d00ffff
+
+// coinbasePlaceholder stands in for the coinbase txid at position 0 of the
+// first subtree of a block, since the coinbase is only known once mined.
+var coinbasePlaceholder = chainhash.Hash{
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+}
+
+// validateBlock checks the header's height against a known parent, and that
+// the merkle root commits to the coinbase and the block's subtrees, which
+// must all be indexed.
+func (p *Processor) validateBlock(ctx context.Context, height uint32, header *block.Header, coinbaseTx []byte, subtreeHashes [][]byte) error {
+	parent, err := p.metadata.GetBlock(ctx, header.PrevHash[:])
+	if err != nil {
+		return fmt.Errorf("get parent block: %w", err)
+	}
+	if parent != nil && parent.Height+1 != height {
+		return fmt.Errorf("%w: height %d does not follow parent at height %d", ErrInvalidBlock, height, parent.Height)
+	}
+
+	if len(coinbaseTx) == 0 {
+		return fmt.Errorf("%w: missing coinbase transaction", ErrInvalidBlock)
+	}
+	coinbaseTxID := chainhash.DoubleHashH(coinbaseTx)
+
+	var root chainhash.Hash
+	if len(subtreeHashes) == 0 {
+		root = coinbaseTxID
+	} else {
+		path, ok, err := p.metadata.GetCoinbasePath(ctx, subtreeHashes[0])
+		if err != nil {
+			return fmt.Errorf("get coinbase path: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("%w: first subtree %x has no coinbase placeholder", ErrInvalidBlock, subtreeHashes[0])
+		}
+
+		roots := make([]chainhash.Hash, len(subtreeHashes))
+		roots[0] = rootFromFirstLeaf(coinbaseTxID, path)
+		for i, h := range subtreeHashes[1:] {
+			copy(roots[i+1][:], h)
+		}
+		root = merkleRoot(roots)
+	}
+	if root != header.MerkleRoot {
+		return fmt.Errorf("%w: merkle root %s does not match computed %s", ErrInvalidBlock, header.MerkleRoot, root)
+	}
+	return nil
+}
+
+// checkProofOfWork verifies the header hash meets the target encoded in its
+// bits, and that the target is no easier than powLimit. A zero powLimit
+// accepts any positive target.
+func checkProofOfWork(header *block.Header, powLimit uint32) error {
+	target := compactToBig(header.Bits)
+	if target.Sign() <= 0 {
+		return fmt.Errorf("%w: target bits %08x are not positive", ErrInvalidBlock, header.Bits)
+	}
+	if powLimit != 0 && target.Cmp(compactToBig(powLimit)) > 0 {
+		return fmt.Errorf("%w: target bits %08x are easier than limit %08x", ErrInvalidBlock, header.Bits, powLimit)
+	}
+
+	hash := header.Hash()
+	if hashToBig(hash).Cmp(target) > 0 {
+		return fmt.Errorf("%w: hash %s does not meet target bits %08x", ErrInvalidBlock, hash, header.Bits)
+	}
+	return nil
+}
+
+// compactToBig expands the compact target representation used in block
+// header bits.
+func compactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	negative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var n *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		n = big.NewInt(int64(mantissa))
+	} else {
+		n = big.NewInt(int64(mantissa))
+		n.Lsh(n, 8*(exponent-3))
+	}
+	if negative {
+		n.Neg(n)
+	}
+	return n
+}
+
+// hashToBig interprets a hash in internal byte order as a little-endian number.
+func hashToBig(hash chainhash.Hash) *big.Int {
+	reversed := make([]byte, len(hash))
+	for i, b := range hash {
+		reversed[len(hash)-1-i] = b
+	}
+	return new(big.Int).SetBytes(reversed)
+}
+
+func hashPair(left, right chainhash.Hash) chainhash.Hash {
+	var buf [64]byte
+	copy(buf[:32], left[:])
+	copy(buf[32:], right[:])
+	return chainhash.DoubleHashH(buf[:])
+}
+
+// merkleRoot computes a Bitcoin merkle root, pairing the last hash of an odd
+// level with itself.
+func merkleRoot(hashes []chainhash.Hash) chainhash.Hash {
+	if len(hashes) == 0 {
+		return chainhash.Hash{}
+	}
+	level := hashes
+	for len(level) > 1 {
+		level = nextLevel(level)
+	}
+	return level[0]
+}
+
+// firstLeafPath returns the sibling hashes on the path from the first leaf
+// to the merkle root, bottom up.
+func firstLeafPath(leaves []chainhash.Hash) [][]byte {
+	var path [][]byte
+	level := leaves
+	for len(level) > 1 {
+		path = append(path, level[1][:])
+		level = nextLevel(level)
+	}
+	return path
+}
+
+func nextLevel(level []chainhash.Hash) []chainhash.Hash {
+	next := make([]chainhash.Hash, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		right := level[i]
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		next = append(next, hashPair(level[i], right))
+	}
+	return next
+}
+
+// rootFromFirstLeaf recomputes a merkle root with the first leaf replaced.
+func rootFromFirstLeaf(leaf chainhash.Hash, path [][]byte) chainhash.Hash {
+	h := leaf
+	for _, sibling := range path {
+		var s chainhash.Hash
+		copy(s[:], sibling)
+		h = hashPair(h, s)
+	}
+	return h
+}
+
+// isCoinbasePlaceholder reports whether hash is the first-subtree coinbase placeholder.
+func isCoinbasePlaceholder(hash []byte) bool {
+	return bytes.Equal(hash, coinbasePlaceholder[:])
+}
@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/block"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+)
+
+// regtestBits is an easy target, so mining a test header takes a few tries.
+const regtestBits = 0x207fffff
+
+// mineHeader builds a header committing to merkleRoot and grinds the nonce
+// until it meets regtestBits.
+func mineHeader(prev []byte, merkleRoot chainhash.Hash) []byte {
+	h := &block.Header{Version: 1, MerkleRoot: merkleRoot, Timestamp: 1700000000, Bits: regtestBits}
+	copy(h.PrevHash[:], prev)
+	for checkProofOfWork(h, 0) != nil {
+		h.Nonce++
+	}
+	return h.Bytes()
+}
+
+func TestCheckProofOfWork(t *testing.T) {
+	header, err := block.NewHeaderFromBytes(mineHeader(nil, chainhash.Hash{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkProofOfWork(header, 0); err != nil {
+		t.Fatalf("mined header rejected: %v", err)
+	}
+	if err := checkProofOfWork(header, MainnetPowLimit); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("target above pow limit: got %v", err)
+	}
+
+	// The nonce that satisfies an easy target will not meet a hard one
+	header.Bits = 0x1d00ffff
+	if err := checkProofOfWork(header, MainnetPowLimit); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("insufficient work: got %v", err)
+	}
+
+	header.Bits = 0x04800001 // negative
+	if err := checkProofOfWork(header, 0); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("negative target: got %v", err)
+	}
+}
+
+func TestCompactToBig(t *testing.T) {
+	if got := compactToBig(0x1d00ffff).Text(16); got != "ffff0000000000000000000000000000000000000000000000000000" {
+		t.Errorf("0x1d00ffff: got %s", got)
+	}
+	if got := compactToBig(0x03123456).Int64(); got != 0x123456 {
+		t.Errorf("0x03123456: got %x", got)
+	}
+	if got := compactToBig(0x02123400).Int64(); got != 0x1234 {
+		t.Errorf("0x02123400: got %x", got)
+	}
+}
+
+func TestFirstLeafPath(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		leaves := make([]chainhash.Hash, n)
+		for i := range leaves {
+			leaves[i] = chainhash.Hash{byte(i + 1)}
+		}
+		path := firstLeafPath(leaves)
+
+		coinbase := chainhash.Hash{0xCB}
+		want := append([]chainhash.Hash{coinbase}, leaves[1:]...)
+		if got := rootFromFirstLeaf(coinbase, path); got != merkleRoot(want) {
+			t.Errorf("%d leaves: root mismatch", n)
+		}
+	}
+}
+
+func TestValidateBlock(t *testing.T) {
+	ctx := context.Background()
+	meta := newMemMetadata()
+	p := &Processor{metadata: meta, config: Config{PowLimit: regtestBits}, logger: slog.Default()}
+
+	subtree := []byte("subtree-hash-1-that-is-32-bytes!")
+	sibling := chainhash.Hash{0x42}
+	meta.InsertCoinbasePath(ctx, subtree, [][]byte{sibling[:]})
+	meta.InsertSubtree(ctx, subtree, []byte("index-root"), 2)
+
+	coinbase := []byte("coinbase")
+	root := hashPair(chainhash.DoubleHashH(coinbase), sibling)
+
+	parentHeader := mineHeader(nil, chainhash.DoubleHashH([]byte("parent")))
+	if err := p.ProcessBlock(ctx, 100, parentHeader, []byte("parent"), nil, 1); err != nil {
+		t.Fatalf("parent: %v", err)
+	}
+	parent := blockHashFromHeader(parentHeader)
+
+	header := mineHeader(parent, root)
+	tests := []struct {
+		name     string
+		height   uint32
+		header   []byte
+		coinbase []byte
+		subtrees [][]byte
+	}{
+		{"wrong height for parent", 105, header, coinbase, [][]byte{subtree}},
+		{"different coinbase", 101, header, []byte("other"), [][]byte{subtree}},
+		{"missing coinbase", 101, header, nil, [][]byte{subtree}},
+		{"merkle root of other block", 101, mineHeader(parent, chainhash.Hash{9}), coinbase, [][]byte{subtree}},
+		{"extra subtree", 101, header, coinbase, [][]byte{subtree, subtree}},
+		{"short header", 101, header[:79], coinbase, [][]byte{subtree}},
+	}
+	for _, tt := range tests {
+		if err := p.ProcessBlock(ctx, tt.height, tt.header, tt.coinbase, tt.subtrees, 2); !errors.Is(err, ErrInvalidBlock) {
+			t.Errorf("%s: got %v, want ErrInvalidBlock", tt.name, err)
+		}
+	}
+	if b, _ := meta.GetBlock(ctx, blockHashFromHeader(header)); b != nil {
+		t.Fatal("invalid block was recorded")
+	}
+
+	// A subtree without a recorded coinbase path cannot start a block
+	other := []byte("subtree-hash-2-that-is-32-bytes!")
+	meta.InsertSubtree(ctx, other, []byte("index-root"), 2)
+	if err := p.ProcessBlock(ctx, 101, header, coinbase, [][]byte{other}, 2); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("first subtree without placeholder: got %v", err)
+	}
+
+	if err := p.ProcessBlock(ctx, 101, header, coinbase, [][]byte{subtree}, 2); err != nil {
+		t.Fatalf("valid block rejected: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/shruggr/inspiration/cache"
+	"github.com/shruggr/inspiration/teranode"
+	"github.com/shruggr/inspiration/treebuilder"
+	"github.com/shruggr/inspiration/txindexer"
+)
+
+// txJob is a transaction for a worker to index. rawTx is nil if the worker
+// must find it in the cache or fetch it itself.
+type txJob struct {
+	pos   int
+	rawTx []byte
+}
+
+// indexNodes fetches and indexes nodes[first:] on a pool of
+// config.Concurrency workers and returns them tagged, in subtree-position
+// order. The first error stops the remaining work.
+func (p *Processor) indexNodes(ctx context.Context, subtreeHashHex string, nodes []subtreeNode, first int) ([]treebuilder.TaggedTransaction, error) {
+	if first >= len(nodes) {
+		return nil, nil
+	}
+	tagged := make([]treebuilder.TaggedTransaction, len(nodes)-first)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	jobs := make(chan txJob)
+	workers := min(max(p.config.Concurrency, 1), len(tagged))
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				txid := cache.TxID(nodes[job.pos].Hash)
+				terms, err := p.indexTx(ctx, txid, job.rawTx)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				tagged[job.pos-first] = treebuilder.TaggedTransaction{
+					TxID:            txid,
+					SubtreePosition: uint64(job.pos),
+					Tags:            termsToTags(terms),
+				}
+			}
+		}()
+	}
+
+	dispatchErr := p.dispatchTxs(ctx, subtreeHashHex, nodes, first, jobs)
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if dispatchErr != nil {
+		return nil, dispatchErr
+	}
+	return tagged, nil
+}
+
+// dispatchTxs sends a job for every position from first on. Transactions
+// not already cached are streamed from the subtree's data, then fetched in
+// batches, and any still missing are left for the workers to fetch one at a
+// time.
+func (p *Processor) dispatchTxs(ctx context.Context, subtreeHashHex string, nodes []subtreeNode, first int, jobs chan<- txJob) error {
+	send := func(job txJob) error {
+		select {
+		case jobs <- job:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	pending := make(map[[32]byte]int)
+	for i := first; i < len(nodes); i++ {
+		if _, ok := p.cache.Get(cache.TxID(nodes[i].Hash)); ok || p.config.BatchSize <= 0 {
+			if err := send(txJob{pos: i}); err != nil {
+				return err
+			}
+			continue
+		}
+		pending[nodes[i].Hash] = i
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := p.streamSubtreeTxs(ctx, subtreeHashHex, func(txid chainhash.Hash, rawTx []byte) error {
+		pos, ok := pending[txid]
+		if !ok {
+			return nil
+		}
+		delete(pending, txid)
+		return send(txJob{pos: pos, rawTx: rawTx})
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		p.logger.Debug("stream subtree transactions", "subtree", subtreeHashHex, "error", err)
+	}
+
+	remaining := make([]int, 0, len(pending))
+	for _, pos := range pending {
+		remaining = append(remaining, pos)
+	}
+	sort.Ints(remaining)
+
+	for len(remaining) > 0 {
+		chunk := remaining[:min(p.config.BatchSize, len(remaining))]
+		remaining = remaining[len(chunk):]
+
+		txids := make([][32]byte, len(chunk))
+		for i, pos := range chunk {
+			txids[i] = nodes[pos].Hash
+		}
+		rawTxs, err := p.fetchTxBatch(ctx, subtreeHashHex, txids)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			p.logger.Debug("batch fetch transactions", "subtree", subtreeHashHex, "count", len(txids), "error", err)
+		}
+		for i, pos := range chunk {
+			job := txJob{pos: pos}
+			if rawTxs != nil {
+				job.rawTx = rawTxs[i]
+			}
+			if err := send(job); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexTx returns the index terms for a transaction, from the cache or by
+// indexing it and recording its spends. rawTx is fetched if nil.
+func (p *Processor) indexTx(ctx context.Context, txid cache.TxID, rawTx []byte) ([]cache.IndexTerm, error) {
+	if terms, ok := p.cache.Get(txid); ok {
+		return terms, nil
+	}
+
+	if p.config.TxTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.TxTimeout)
+		defer cancel()
+	}
+
+	if rawTx == nil {
+		var err error
+		if rawTx, err = p.fetchTx(ctx, txid); err != nil {
+			if p.config.SkipMissingTxs && errors.Is(err, teranode.ErrTxNotFound) {
+				p.logger.Warn("skipping transaction missing from teranode", "txid", teranode.TxIDToHex(txid[:]))
+				return nil, nil
+			}
+			return nil, fmt.Errorf("fetch tx %x: %w", txid[:8], err)
+		}
+	}
+
+	results, err := p.indexer.Index(ctx, &txindexer.TransactionContext{
+		TxID:  txid[:],
+		RawTx: rawTx,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index tx %x: %w", txid[:8], err)
+	}
+
+	terms := make([]cache.IndexTerm, len(results))
+	for j, r := range results {
+		terms[j] = cache.IndexTerm{
+			Key:   r.Key,
+			Value: r.Value,
+			Vouts: r.Vouts,
+			Vins:  r.Vins,
+		}
+	}
+
+	if err := p.cache.Put(txid, terms); err != nil {
+		p.logger.Warn("cache put failed", "txid", fmt.Sprintf("%x", txid[:8]), "err", err)
+	}
+
+	if err := p.writeSpendRecords(ctx, txid, rawTx); err != nil {
+		return nil, fmt.Errorf("write spends for %x: %w", txid[:8], err)
+	}
+	return terms, nil
+}
+
+// acquireFetch waits for a slot in sem if in-flight fetches are capped. The
+// returned func releases it.
+func acquireFetch(ctx context.Context, sem chan struct{}) (func(), error) {
+	if sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetchTx fetches a single transaction. It draws on its own budget, since a
+// stream holding a slot in fetchSem may be blocked on the worker calling it.
+func (p *Processor) fetchTx(ctx context.Context, txid cache.TxID) ([]byte, error) {
+	release, err := acquireFetch(ctx, p.txFetchSem)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return p.client.FetchTransaction(ctx, teranode.TxIDToHex(txid[:]))
+}
+
+func (p *Processor) fetchTxBatch(ctx context.Context, subtreeHashHex string, txids [][32]byte) ([][]byte, error) {
+	release, err := acquireFetch(ctx, p.fetchSem)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return p.client.FetchTransactions(ctx, subtreeHashHex, txids)
+}
+
+func (p *Processor) streamSubtreeTxs(ctx context.Context, subtreeHashHex string, fn func(txid chainhash.Hash, rawTx []byte) error) error {
+	release, err := acquireFetch(ctx, p.fetchSem)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.client.FetchSubtreeTransactions(ctx, subtreeHashHex, fn)
+}
+
+func termsToTags(terms []cache.IndexTerm) []treebuilder.Tag {
+	tags := make([]treebuilder.Tag, len(terms))
+	for j, t := range terms {
+		tags[j] = treebuilder.Tag{
+			Key:   t.Key,
+			Value: t.Value,
+			Vouts: t.Vouts,
+			Vins:  t.Vins,
+		}
+	}
+	return tags
+}
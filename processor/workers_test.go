@@ -0,0 +1,208 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/shruggr/inspiration/store"
+	"github.com/shruggr/inspiration/teranode"
+	"github.com/shruggr/inspiration/txindexer"
+)
+
+// newWorkerTestProcessor serves every transaction after delay, tracking the
+// peak number of concurrent fetches.
+func newWorkerTestProcessor(t *testing.T, config Config, delay time.Duration, peak *int32) (*Processor, *mockIndexer) {
+	t.Helper()
+	var inFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			old := atomic.LoadInt32(peak)
+			if n <= old || atomic.CompareAndSwapInt32(peak, old, n) {
+				break
+			}
+		}
+		if strings.HasSuffix(r.URL.Path, "dead") {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(delay)
+		w.Write(buildMinimalRawTx([32]byte{0xaa}, 0))
+	}))
+	t.Cleanup(srv.Close)
+
+	indexer := newMockIndexer()
+	p := NewProcessor(store.NewDualStore(newMemKVStore(), newMemKVStore()), newMemKVStore(), newMemCache(),
+		indexer, teranode.NewClient(srv.URL), &mockBuilder{}, newMemMetadata(), config, slog.Default())
+	return p, indexer
+}
+
+func TestIndexNodesPreservesOrder(t *testing.T) {
+	var peak int32
+	p, indexer := newWorkerTestProcessor(t, Config{Concurrency: 8, MaxInFlight: 3}, 5*time.Millisecond, &peak)
+
+	nodes := make([]subtreeNode, 40)
+	for i := range nodes {
+		nodes[i].Hash = [32]byte{byte(i + 1)}
+		indexer.results[fmt.Sprintf("%x", nodes[i].Hash[:])] = []*txindexer.IndexResult{
+			{Key: "n", Value: strconv.Itoa(i), Vouts: []uint32{0}},
+		}
+	}
+
+	tagged, err := p.indexNodes(context.Background(), "ab", nodes, 1)
+	if err != nil {
+		t.Fatalf("indexNodes failed: %v", err)
+	}
+	if len(tagged) != len(nodes)-1 {
+		t.Fatalf("expected %d transactions, got %d", len(nodes)-1, len(tagged))
+	}
+	for i, tx := range tagged {
+		if tx.SubtreePosition != uint64(i+1) || tx.TxID != nodes[i+1].Hash {
+			t.Fatalf("transaction %d out of order: position %d", i, tx.SubtreePosition)
+		}
+		if len(tx.Tags) != 1 || tx.Tags[0].Value != strconv.Itoa(i+1) {
+			t.Fatalf("transaction %d has tags %+v", i, tx.Tags)
+		}
+	}
+	if peak > 3 {
+		t.Errorf("in-flight fetches peaked at %d, limit 3", peak)
+	}
+	if peak < 2 {
+		t.Errorf("expected concurrent fetches, peak was %d", peak)
+	}
+}
+
+func TestIndexNodesStopsOnError(t *testing.T) {
+	var peak int32
+	p, _ := newWorkerTestProcessor(t, Config{Concurrency: 4}, time.Millisecond, &peak)
+
+	nodes := make([]subtreeNode, 100)
+	for i := range nodes {
+		nodes[i].Hash = [32]byte{byte(i + 1)}
+	}
+	// The txid hex ends with "dead" for this hash, which the server rejects
+	nodes[10].Hash = [32]byte{0xad, 0xde}
+
+	if _, err := p.indexNodes(context.Background(), "ab", nodes, 0); err == nil {
+		t.Fatal("expected error for missing transaction")
+	}
+}
+
+func TestIndexNodesTxTimeout(t *testing.T) {
+	var peak int32
+	p, _ := newWorkerTestProcessor(t, Config{Concurrency: 2, TxTimeout: 10 * time.Millisecond}, 200*time.Millisecond, &peak)
+
+	nodes := []subtreeNode{{Hash: [32]byte{1}}, {Hash: [32]byte{2}}}
+	_, err := p.indexNodes(context.Background(), "ab", nodes, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestStreamLeavesSingleFetchBudget(t *testing.T) {
+	var peak int32
+	p, _ := newWorkerTestProcessor(t, Config{Concurrency: 1, MaxInFlight: 1, BatchSize: 10}, 0, &peak)
+
+	// A stream holding the only subtree-level slot waits on a worker that
+	// has to fetch a transaction itself
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := p.streamSubtreeTxs(ctx, "ab", func(chainhash.Hash, []byte) error {
+		_, err := p.fetchTx(ctx, [32]byte{1})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("streamSubtreeTxs: %v", err)
+	}
+}
+
+func TestIndexNodesStreamsAndBatches(t *testing.T) {
+	txs := make([]*transaction.Transaction, 6)
+	nodes := make([]subtreeNode, len(txs))
+	byHex := make(map[string][]byte)
+	for i := range txs {
+		txs[i] = transaction.NewTransaction()
+		txs[i].AddInput(&transaction.TransactionInput{SourceTXID: &chainhash.Hash{0xaa}, UnlockingScript: &script.Script{}, SequenceNumber: 0xffffffff})
+		txs[i].AddOutput(&transaction.TransactionOutput{Satoshis: uint64(i), LockingScript: &script.Script{}})
+		nodes[i].Hash = *txs[i].TxID()
+		byHex[teranode.TxIDToHex(nodes[i].Hash[:])] = txs[i].Bytes()
+	}
+
+	// The subtree data holds txs 0-2 and an unrelated tx; the batch
+	// endpoint serves 3 and 4; tx 5 is only available on its own.
+	var streamed, batched, single int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/subtree_data/ab", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&streamed, 1)
+		other := buildMinimalRawTx([32]byte{0xbb}, 0)
+		w.Write(append(append(append(txs[0].Bytes(), other...), txs[1].Bytes()...), txs[2].Bytes()...))
+	})
+	mux.HandleFunc("POST /api/v1/subtree/ab/txs", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&batched, 1)
+		body, _ := io.ReadAll(r.Body)
+		for i := 0; i+32 <= len(body); i += 32 {
+			hex := teranode.TxIDToHex(body[i : i+32])
+			if hex == teranode.TxIDToHex(nodes[5].Hash[:]) {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(byHex[hex])
+		}
+	})
+	mux.HandleFunc("GET /api/v1/tx/{txid}", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&single, 1)
+		w.Write(byHex[r.PathValue("txid")])
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := NewProcessor(store.NewDualStore(newMemKVStore(), newMemKVStore()), newMemKVStore(), newMemCache(),
+		newMockIndexer(), teranode.NewClient(srv.URL), &mockBuilder{}, newMemMetadata(), Config{Concurrency: 4, BatchSize: 2}, slog.Default())
+
+	tagged, err := p.indexNodes(context.Background(), "ab", nodes, 0)
+	if err != nil {
+		t.Fatalf("indexNodes failed: %v", err)
+	}
+	for i, tx := range tagged {
+		if tx.TxID != nodes[i].Hash || tx.SubtreePosition != uint64(i) {
+			t.Fatalf("transaction %d out of order", i)
+		}
+	}
+	// Batches are [3 4] and [5]; the second fails and falls back to a single GET
+	if streamed != 1 || batched != 2 || single != 1 {
+		t.Errorf("requests: streamed %d, batched %d, single %d", streamed, batched, single)
+	}
+}
+
+func TestIndexNodesSkipMissingTxs(t *testing.T) {
+	nodes := []subtreeNode{{Hash: [32]byte{1}}, {Hash: [32]byte{0xad, 0xde}}, {Hash: [32]byte{3}}}
+
+	var peak int32
+	p, _ := newWorkerTestProcessor(t, Config{Concurrency: 2}, 0, &peak)
+	if _, err := p.indexNodes(context.Background(), "ab", nodes, 0); !errors.Is(err, teranode.ErrTxNotFound) {
+		t.Fatalf("expected ErrTxNotFound, got %v", err)
+	}
+
+	p, _ = newWorkerTestProcessor(t, Config{Concurrency: 2, SkipMissingTxs: true}, 0, &peak)
+	tagged, err := p.indexNodes(context.Background(), "ab", nodes, 0)
+	if err != nil {
+		t.Fatalf("indexNodes failed: %v", err)
+	}
+	if len(tagged) != 3 || tagged[1].SubtreePosition != 1 || len(tagged[1].Tags) != 0 {
+		t.Errorf("expected missing tx indexed without tags, got %+v", tagged)
+	}
+}
@@ -0,0 +1,149 @@
+// Package promoter moves the index trees of confirmed blocks from the working
+// store into the persistent store.
+package promoter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/shruggr/inspiration/metadata"
+	"github.com/shruggr/inspiration/multihash"
+	"github.com/shruggr/inspiration/store"
+	"github.com/shruggr/inspiration/treereader"
+)
+
+// Config controls when blocks are promoted.
+type Config struct {
+	ConfirmationDepth uint32        // blocks required on top of a block before it is promoted
+	Interval          time.Duration // how often to check for promotable blocks
+}
+
+// DefaultConfig promotes blocks six deep, checking every 30 seconds.
+func DefaultConfig() Config {
+	return Config{
+		ConfirmationDepth: 6,
+		Interval:          30 * time.Second,
+	}
+}
+
+// Promoter periodically promotes every pending block that has reached the
+// confirmation depth.
+//
+// Each node is copied to persistent space before the block is marked
+// confirmed, and only then dropped from working space. DualStore reads fall
+// through to persistent space and Promote tolerates keys that were already
+// moved, so a pass interrupted at any point is simply redone on the next one.
+type Promoter struct {
+	store    *store.DualStore
+	metadata metadata.Store
+	reader   treereader.Reader
+	config   Config
+	logger   *slog.Logger
+}
+
+func NewPromoter(store *store.DualStore, metadata metadata.Store, config Config, logger *slog.Logger) *Promoter {
+	return &Promoter{
+		store:    store,
+		metadata: metadata,
+		reader:   treereader.NewReader(store),
+		config:   config,
+		logger:   logger,
+	}
+}
+
+// Run promotes ready blocks every Interval until ctx is cancelled.
+func (p *Promoter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := p.PromoteReady(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			p.logger.Error("promote blocks", "error", err)
+		} else if n > 0 {
+			p.logger.Info("promoted blocks", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// PromoteReady promotes every pending block at least ConfirmationDepth blocks
+// below the chain tip, oldest first, and returns how many were promoted.
+func (p *Promoter) PromoteReady(ctx context.Context) (int, error) {
+	tip, err := p.metadata.GetTipHeight(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get tip height: %w", err)
+	}
+	if tip < p.config.ConfirmationDepth {
+		return 0, nil
+	}
+
+	blocks, err := p.metadata.GetUnpromotedBlocks(ctx, tip-p.config.ConfirmationDepth)
+	if err != nil {
+		return 0, fmt.Errorf("get unpromoted blocks: %w", err)
+	}
+
+	for i, blockHash := range blocks {
+		if err := p.promoteBlock(ctx, blockHash); err != nil {
+			return i, fmt.Errorf("promote block %x: %w", blockHash, err)
+		}
+	}
+	return len(blocks), nil
+}
+
+func (p *Promoter) promoteBlock(ctx context.Context, blockHash []byte) error {
+	subtreeHashes, err := p.metadata.GetBlockSubtrees(ctx, blockHash)
+	if err != nil {
+		return fmt.Errorf("get subtrees: %w", err)
+	}
+
+	var keys [][]byte
+	for _, subtreeHash := range subtreeHashes {
+		indexRoot, err := p.metadata.GetSubtreeIndexRoot(ctx, subtreeHash)
+		if err != nil {
+			return fmt.Errorf("get index root for subtree %x: %w", subtreeHash, err)
+		}
+		if indexRoot == nil {
+			// Nothing to promote, and failing would hold back every later
+			// block; queries skip it the same way.
+			p.logger.Warn("promote: subtree has no index", "block", fmt.Sprintf("%x", blockHash), "subtree", fmt.Sprintf("%x", subtreeHash))
+			continue
+		}
+
+		err = p.reader.Walk(ctx, indexRoot, func(key multihash.IndexHash) error {
+			if err := p.store.Promote(ctx, key.Bytes()); err != nil {
+				return fmt.Errorf("promote node %s: %w", key.Hex(), err)
+			}
+			keys = append(keys, key.Bytes())
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("walk subtree %x: %w", subtreeHash, err)
+		}
+	}
+
+	if err := p.metadata.PromoteBlock(ctx, blockHash); err != nil {
+		return fmt.Errorf("mark confirmed: %w", err)
+	}
+
+	// The block is durable in persistent space; the working copies are now
+	// redundant. A failure here only leaves garbage behind.
+	for _, key := range keys {
+		if err := p.store.Delete(ctx, key); err != nil {
+			p.logger.Warn("drop promoted node from working space", "error", err)
+			break
+		}
+	}
+
+	p.logger.Debug("promoted block", "hash", fmt.Sprintf("%x", blockHash), "subtrees", len(subtreeHashes), "nodes", len(keys))
+	return nil
+}
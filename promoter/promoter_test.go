@@ -0,0 +1,183 @@
+package promoter
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	kvmem "github.com/shruggr/inspiration/kvstore/memory"
+	metasqlite "github.com/shruggr/inspiration/metadata/sqlite"
+	"github.com/shruggr/inspiration/multihash"
+	"github.com/shruggr/inspiration/store"
+	"github.com/shruggr/inspiration/treebuilder"
+	"github.com/shruggr/inspiration/treereader"
+)
+
+const addr1 = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+
+type testEnv struct {
+	promoter   *Promoter
+	meta       *metasqlite.SQLiteStore
+	working    *kvmem.Store
+	persistent *kvmem.Store
+	dual       *store.DualStore
+	roots      []multihash.IndexHash
+}
+
+// newTestEnv records one block per height from 100 to tip, each with a single
+// indexed subtree.
+func newTestEnv(t *testing.T, tip uint32) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+
+	working, persistent := kvmem.New(), kvmem.New()
+	dual := store.NewDualStore(working, persistent)
+	meta, err := metasqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("create metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+
+	env := &testEnv{meta: meta, working: working, persistent: persistent, dual: dual}
+	builder := treebuilder.NewBuilder(dual)
+	for height := uint32(100); height <= tip; height++ {
+		root, err := builder.BuildSubtreeIndex(ctx, []treebuilder.TaggedTransaction{{
+			TxID: [32]byte{byte(height)},
+			Tags: []treebuilder.Tag{{Key: "address", Value: addr1, Vouts: []uint32{0}}},
+		}})
+		if err != nil {
+			t.Fatalf("BuildSubtreeIndex: %v", err)
+		}
+		subtreeHash := bytes.Repeat([]byte{byte(height)}, 32)
+		if err := meta.InsertSubtree(ctx, subtreeHash, root.Bytes(), 1); err != nil {
+			t.Fatalf("InsertSubtree: %v", err)
+		}
+		blockHash := bytes.Repeat([]byte{byte(height), 0xBB}, 16)
+		if err := meta.InsertBlock(ctx, height, blockHash, make([]byte, 80), 1, [][]byte{subtreeHash}); err != nil {
+			t.Fatalf("InsertBlock: %v", err)
+		}
+		env.roots = append(env.roots, root)
+	}
+
+	env.promoter = NewPromoter(dual, meta, Config{ConfirmationDepth: 2}, slog.Default())
+	return env
+}
+
+// nodeKeys returns every store key of the tree at root.
+func (env *testEnv) nodeKeys(t *testing.T, root multihash.IndexHash) [][]byte {
+	t.Helper()
+	var keys [][]byte
+	err := treereader.NewReader(env.dual).Walk(context.Background(), root, func(key multihash.IndexHash) error {
+		keys = append(keys, key.Bytes())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	return keys
+}
+
+func TestPromoteReady(t *testing.T) {
+	env := newTestEnv(t, 103)
+	ctx := context.Background()
+
+	// Tip 103 with depth 2 promotes heights 100 and 101
+	n, err := env.promoter.PromoteReady(ctx)
+	if err != nil {
+		t.Fatalf("PromoteReady: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("promoted: got %d, want 2", n)
+	}
+
+	for i, root := range env.roots {
+		promoted := i < 2
+		for _, key := range env.nodeKeys(t, root) {
+			inPersistent, _ := env.persistent.Has(ctx, key)
+			inWorking, _ := env.working.Has(ctx, key)
+			if promoted && (!inPersistent || inWorking) {
+				t.Errorf("height %d: node should have moved to persistent (persistent=%v working=%v)", 100+i, inPersistent, inWorking)
+			}
+			if !promoted && inPersistent {
+				t.Errorf("height %d: node promoted before reaching depth", 100+i)
+			}
+		}
+	}
+
+	remaining, err := env.meta.GetUnpromotedBlocks(ctx, 103)
+	if err != nil {
+		t.Fatalf("GetUnpromotedBlocks: %v", err)
+	}
+	if len(remaining) != 2 {
+		t.Errorf("pending blocks: got %d, want 2", len(remaining))
+	}
+
+	// Nothing new is ready
+	if n, err := env.promoter.PromoteReady(ctx); err != nil || n != 0 {
+		t.Errorf("second pass: got %d, %v", n, err)
+	}
+}
+
+func TestPromoteReadyResumesInterruptedBlock(t *testing.T) {
+	env := newTestEnv(t, 102)
+	ctx := context.Background()
+
+	// Simulate a crash after part of block 100 was moved but before it was
+	// marked confirmed.
+	keys := env.nodeKeys(t, env.roots[0])
+	for _, key := range keys[:len(keys)/2] {
+		if err := env.dual.Promote(ctx, key); err != nil {
+			t.Fatalf("Promote: %v", err)
+		}
+		if err := env.working.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+
+	n, err := env.promoter.PromoteReady(ctx)
+	if err != nil {
+		t.Fatalf("PromoteReady: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("promoted: got %d, want 1", n)
+	}
+	for _, key := range keys {
+		if ok, _ := env.persistent.Has(ctx, key); !ok {
+			t.Errorf("node %x missing from persistent store", key)
+		}
+	}
+
+	entries, err := treereader.NewReader(env.dual).Lookup(ctx, env.roots[0], "address", addr1)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("lookup after promotion: got %d entries, %v", len(entries), err)
+	}
+}
+
+func TestPromoteReadyBelowDepth(t *testing.T) {
+	env := newTestEnv(t, 100)
+	env.promoter.config.ConfirmationDepth = 200
+
+	if n, err := env.promoter.PromoteReady(context.Background()); err != nil || n != 0 {
+		t.Errorf("got %d, %v; want nothing promoted", n, err)
+	}
+}
+
+func TestPromoteReadySkipsUnindexedSubtree(t *testing.T) {
+	env := newTestEnv(t, 102)
+	ctx := context.Background()
+
+	// Block 99's only subtree was never indexed
+	blockHash := bytes.Repeat([]byte{99, 0xBB}, 16)
+	if err := env.meta.InsertBlock(ctx, 99, blockHash, make([]byte, 80), 1, [][]byte{bytes.Repeat([]byte{99}, 32)}); err != nil {
+		t.Fatalf("InsertBlock: %v", err)
+	}
+
+	n, err := env.promoter.PromoteReady(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("PromoteReady: got %d, %v; want 2", n, err)
+	}
+	if b, _ := env.meta.GetBlock(ctx, blockHash); b == nil || b.Status != "confirmed" {
+		t.Errorf("block 99: %+v", b)
+	}
+}
@@ -0,0 +1,108 @@
+package query
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cursor identifies a position in chain order: block height, subtree index
+// within the block, and transaction position within the subtree.
+//
+// Mempool cursors sort after every block. Unmined subtrees have no stable
+// index, since they leave the mempool as their blocks arrive, so mempool
+// cursors identify the subtree by when it was received and its hash instead.
+type Cursor struct {
+	Mempool         bool
+	Height          uint32
+	SubtreeIndex    uint32
+	ReceivedAt      int64  // unix seconds; compared for mempool cursors only
+	SubtreeHash     []byte // compared for mempool cursors only
+	SubtreePosition uint64
+}
+
+// mempoolPrefix replaces the height in encoded mempool cursors.
+const mempoolPrefix = "mempool"
+
+// String encodes the cursor as "height:subtreeIndex:position", or
+// "mempool:receivedAt:subtreeHash:position" for mempool cursors.
+func (c Cursor) String() string {
+	if c.Mempool {
+		return fmt.Sprintf("%s:%d:%x:%d", mempoolPrefix, c.ReceivedAt, c.SubtreeHash, c.SubtreePosition)
+	}
+	return fmt.Sprintf("%d:%d:%d", c.Height, c.SubtreeIndex, c.SubtreePosition)
+}
+
+// Less reports whether c sorts before other in chain order.
+func (c Cursor) Less(other Cursor) bool {
+	if c.Mempool != other.Mempool {
+		return other.Mempool
+	}
+	if c.Mempool {
+		if cmp := c.compareSubtree(other.ReceivedAt, other.SubtreeHash); cmp != 0 {
+			return cmp < 0
+		}
+		return c.SubtreePosition < other.SubtreePosition
+	}
+	if c.Height != other.Height {
+		return c.Height < other.Height
+	}
+	if c.SubtreeIndex != other.SubtreeIndex {
+		return c.SubtreeIndex < other.SubtreeIndex
+	}
+	return c.SubtreePosition < other.SubtreePosition
+}
+
+// compareSubtree orders the subtree of a mempool cursor against another
+// unmined subtree, by receipt time and then hash.
+func (c Cursor) compareSubtree(receivedAt int64, hash []byte) int {
+	if c.ReceivedAt != receivedAt {
+		if c.ReceivedAt < receivedAt {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(c.SubtreeHash, hash)
+}
+
+// ParseCursor decodes a cursor produced by Cursor.String.
+func ParseCursor(s string) (Cursor, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) == 4 && parts[0] == mempoolPrefix {
+		receivedAt, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return Cursor{}, fmt.Errorf("invalid cursor receipt time: %w", err)
+		}
+		hash, err := hex.DecodeString(parts[2])
+		if err != nil {
+			return Cursor{}, fmt.Errorf("invalid cursor subtree hash: %w", err)
+		}
+		position, err := strconv.ParseUint(parts[3], 10, 64)
+		if err != nil {
+			return Cursor{}, fmt.Errorf("invalid cursor position: %w", err)
+		}
+		return Cursor{Mempool: true, ReceivedAt: receivedAt, SubtreeHash: hash, SubtreePosition: position}, nil
+	}
+	if len(parts) != 3 {
+		return Cursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+	var c Cursor
+	height, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor height: %w", err)
+	}
+	c.Height = uint32(height)
+	subtreeIndex, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor subtree index: %w", err)
+	}
+	position, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor position: %w", err)
+	}
+	c.SubtreeIndex = uint32(subtreeIndex)
+	c.SubtreePosition = position
+	return c, nil
+}
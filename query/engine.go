@@ -0,0 +1,306 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/shruggr/inspiration/indexnode"
+	"github.com/shruggr/inspiration/metadata"
+	"github.com/shruggr/inspiration/treereader"
+)
+
+// errStop is returned by a ResultFunc to end iteration early without error.
+var errStop = errors.New("stop iteration")
+
+// Result is a single indexed transaction located in chain order.
+type Result struct {
+	TxID            []byte
+	BlockHash       []byte
+	BlockHeight     uint32
+	SubtreeHash     []byte
+	SubtreeIndex    uint32
+	SubtreePosition uint64
+	Vouts           []uint32
+	Vins            []uint32
+	// Unconfirmed is set for results from subtrees not yet in a block, which
+	// have no block hash or height.
+	Unconfirmed bool
+	// ReceivedAt is when an unconfirmed result's subtree was received, in
+	// unix seconds.
+	ReceivedAt int64
+}
+
+// Cursor returns the chain position of this result.
+func (r *Result) Cursor() Cursor {
+	return Cursor{
+		Mempool:         r.Unconfirmed,
+		Height:          r.BlockHeight,
+		SubtreeIndex:    r.SubtreeIndex,
+		ReceivedAt:      r.ReceivedAt,
+		SubtreeHash:     r.SubtreeHash,
+		SubtreePosition: r.SubtreePosition,
+	}
+}
+
+// Request describes a tag lookup across a range of blocks.
+type Request struct {
+	Key        string
+	Value      string
+	Expr       Expr // if set, evaluated instead of Key=Value
+	FromHeight uint32
+	ToHeight   uint32  // 0 means no upper bound
+	After      *Cursor // resume strictly after this position
+	// Scope selects blocks, the mempool or both. The mempool is only read
+	// when ToHeight is 0.
+	Scope Scope
+	// Pending also reads best-chain blocks that are not yet confirmed.
+	// Otherwise their subtrees are read as part of the mempool.
+	Pending bool
+}
+
+// Page is one page of results with the cursor to resume from, if any.
+type Page struct {
+	Results []Result
+	Next    *Cursor
+}
+
+// ResultFunc is called for each result in chain order.
+// Returning an error stops iteration.
+type ResultFunc func(r Result) error
+
+// Engine answers tag queries by walking the subtree indexes of blocks
+// recorded in the metadata store.
+type Engine struct {
+	metadata metadata.Store
+	reader   treereader.Reader
+}
+
+func NewEngine(metadata metadata.Store, reader treereader.Reader) *Engine {
+	return &Engine{metadata: metadata, reader: reader}
+}
+
+// QueuedBlocks returns the blocks waiting for subtrees to be indexed before
+// they can be recorded, lowest height first.
+func (e *Engine) QueuedBlocks(ctx context.Context) ([]metadata.QueuedBlock, error) {
+	return e.metadata.GetQueuedBlocks(ctx)
+}
+
+// TipHeight returns the height of the best chain tip, or 0 if there are no
+// blocks.
+func (e *Engine) TipHeight(ctx context.Context) (uint32, error) {
+	return e.metadata.GetTipHeight(ctx)
+}
+
+// Lookup returns up to limit results for req, in chain order.
+func (e *Engine) Lookup(ctx context.Context, req Request, limit int) (*Page, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	page := &Page{}
+	err := e.Each(ctx, req, func(r Result) error {
+		if len(page.Results) == limit {
+			last := page.Results[len(page.Results)-1].Cursor()
+			page.Next = &last
+			return errStop
+		}
+		page.Results = append(page.Results, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Each streams every result for req to fn in chain order without buffering.
+func (e *Engine) Each(ctx context.Context, req Request, fn ResultFunc) error {
+	expr := req.Expr
+	if expr == nil {
+		expr = Term{Key: req.Key, Value: req.Value}
+	}
+	if err := checkExpr(expr, false); err != nil {
+		return err
+	}
+
+	walk := func(sub subtreeRef) error {
+		return e.evalSubtree(ctx, expr, sub, req.After, fn)
+	}
+
+	var err error
+	if req.Scope != ScopeMempool {
+		err = e.walkSubtrees(ctx, req.FromHeight, req.ToHeight, req.Pending, req.After, walk)
+	}
+	if err == nil && req.Scope != ScopeBlocks && req.ToHeight == 0 {
+		err = e.walkMempool(ctx, req.Pending, req.After, walk)
+	}
+	if errors.Is(err, errStop) {
+		return nil
+	}
+	return err
+}
+
+// EachInBlock streams the results for expr within one block, whatever its
+// status, in chain order.
+func (e *Engine) EachInBlock(ctx context.Context, expr Expr, block metadata.Block, fn ResultFunc) error {
+	if err := checkExpr(expr, false); err != nil {
+		return err
+	}
+	subtreeHashes, err := e.metadata.GetBlockSubtrees(ctx, block.Hash)
+	if err != nil {
+		return fmt.Errorf("get subtrees for block %x: %w", block.Hash, err)
+	}
+	for i, subtreeHash := range subtreeHashes {
+		indexRoot, err := e.metadata.GetSubtreeIndexRoot(ctx, subtreeHash)
+		if err != nil {
+			return fmt.Errorf("get index root for subtree %x: %w", subtreeHash, err)
+		}
+		if indexRoot == nil {
+			continue
+		}
+		sub := subtreeRef{block: block, index: uint32(i), hash: subtreeHash, indexRoot: indexRoot}
+		if err := e.evalSubtree(ctx, expr, sub, nil, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EachInSubtree streams the results for expr within one subtree index as
+// unconfirmed, since its block is not known.
+func (e *Engine) EachInSubtree(ctx context.Context, expr Expr, subtreeHash, indexRoot []byte, fn ResultFunc) error {
+	if err := checkExpr(expr, false); err != nil {
+		return err
+	}
+	sub := subtreeRef{hash: subtreeHash, indexRoot: indexRoot, unconfirmed: true}
+	return e.evalSubtree(ctx, expr, sub, nil, fn)
+}
+
+// evalSubtree evaluates expr against one subtree index and emits its results
+// after the resume cursor.
+func (e *Engine) evalSubtree(ctx context.Context, expr Expr, sub subtreeRef, after *Cursor, fn ResultFunc) error {
+	entries, err := expr.eval(e.subtreeLookup(ctx, sub))
+	if err != nil {
+		return fmt.Errorf("lookup subtree %x: %w", sub.hash, err)
+	}
+	return emitEntries(sub, entries, after, fn)
+}
+
+// subtreeLookup returns a lookupFunc over one subtree index that reads each
+// distinct term at most once.
+func (e *Engine) subtreeLookup(ctx context.Context, sub subtreeRef) lookupFunc {
+	seen := make(map[Term][]indexnode.LeafEntry)
+	return func(key, value string) ([]indexnode.LeafEntry, error) {
+		t := Term{Key: key, Value: value}
+		if entries, ok := seen[t]; ok {
+			return entries, nil
+		}
+		entries, err := e.reader.Lookup(ctx, sub.indexRoot, key, value)
+		if err != nil {
+			return nil, err
+		}
+		seen[t] = entries
+		return entries, nil
+	}
+}
+
+// subtreeRef locates a subtree index within a block, or within the mempool
+// if unconfirmed.
+type subtreeRef struct {
+	block       metadata.Block
+	index       uint32
+	hash        []byte
+	indexRoot   []byte
+	receivedAt  int64
+	unconfirmed bool
+}
+
+// walkSubtrees calls fn for each subtree of each confirmed block in the
+// height range, or each best-chain block if pending, in chain order,
+// skipping subtrees that lie entirely before after.
+func (e *Engine) walkSubtrees(ctx context.Context, fromHeight, toHeight uint32, pending bool, after *Cursor, fn func(sub subtreeRef) error) error {
+	if after != nil && after.Mempool {
+		return nil
+	}
+	if toHeight == 0 {
+		toHeight = math.MaxUint32
+	}
+	if after != nil && after.Height > fromHeight {
+		fromHeight = after.Height
+	}
+	if fromHeight > toHeight {
+		return nil
+	}
+
+	getBlocks := e.metadata.GetBlocksByHeightRange
+	if pending {
+		getBlocks = e.metadata.GetChainBlocks
+	}
+	blocks, err := getBlocks(ctx, fromHeight, toHeight)
+	if err != nil {
+		return fmt.Errorf("get blocks: %w", err)
+	}
+
+	for _, block := range blocks {
+		subtreeHashes, err := e.metadata.GetBlockSubtrees(ctx, block.Hash)
+		if err != nil {
+			return fmt.Errorf("get subtrees for block %x: %w", block.Hash, err)
+		}
+
+		for i, subtreeHash := range subtreeHashes {
+			if after != nil && (block.Height < after.Height ||
+				(block.Height == after.Height && uint32(i) < after.SubtreeIndex)) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			indexRoot, err := e.metadata.GetSubtreeIndexRoot(ctx, subtreeHash)
+			if err != nil {
+				return fmt.Errorf("get index root for subtree %x: %w", subtreeHash, err)
+			}
+			if indexRoot == nil {
+				continue
+			}
+
+			err = fn(subtreeRef{
+				block:     block,
+				index:     uint32(i),
+				hash:      subtreeHash,
+				indexRoot: indexRoot,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// emitEntries converts leaf entries of one subtree into results, dropping any
+// at or before the resume cursor.
+func emitEntries(sub subtreeRef, entries []indexnode.LeafEntry, after *Cursor, fn ResultFunc) error {
+	for _, entry := range entries {
+		r := Result{
+			TxID:            entry.TxID,
+			BlockHash:       sub.block.Hash,
+			BlockHeight:     sub.block.Height,
+			SubtreeHash:     sub.hash,
+			SubtreeIndex:    sub.index,
+			SubtreePosition: entry.SubtreePosition,
+			Vouts:           entry.Vouts,
+			Vins:            entry.Vins,
+			Unconfirmed:     sub.unconfirmed,
+			ReceivedAt:      sub.receivedAt,
+		}
+		if after != nil && !after.Less(r.Cursor()) {
+			continue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
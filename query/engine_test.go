@@ -0,0 +1,203 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	kvmem "github.com/shruggr/inspiration/kvstore/memory"
+	metasqlite "github.com/shruggr/inspiration/metadata/sqlite"
+	"github.com/shruggr/inspiration/treebuilder"
+	"github.com/shruggr/inspiration/treereader"
+)
+
+const (
+	addr1 = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	addr2 = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+)
+
+type testChain struct {
+	engine *Engine
+	meta   *metasqlite.SQLiteStore
+	kv     *kvmem.Store
+}
+
+// newTestChain indexes one subtree per entry of subtrees and assembles them
+// into blocks at consecutive heights starting from 100, subtreesPerBlock at a time.
+func newTestChain(t *testing.T, subtreesPerBlock int, subtrees ...[]treebuilder.TaggedTransaction) *testChain {
+	t.Helper()
+	ctx := context.Background()
+
+	kv := kvmem.New()
+	meta, err := metasqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("create metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+
+	builder := treebuilder.NewBuilder(kv)
+	var blockSubtrees [][]byte
+	height := uint32(100)
+	for i, txs := range subtrees {
+		root, err := builder.BuildSubtreeIndex(ctx, txs)
+		if err != nil {
+			t.Fatalf("BuildSubtreeIndex: %v", err)
+		}
+		subtreeHash := bytes.Repeat([]byte{byte(i + 1)}, 32)
+		if err := meta.InsertSubtree(ctx, subtreeHash, root.Bytes(), uint32(len(txs))); err != nil {
+			t.Fatalf("InsertSubtree: %v", err)
+		}
+		blockSubtrees = append(blockSubtrees, subtreeHash)
+
+		if len(blockSubtrees) == subtreesPerBlock || i == len(subtrees)-1 {
+			blockHash := bytes.Repeat([]byte{byte(height)}, 32)
+			if err := meta.InsertBlock(ctx, height, blockHash, make([]byte, 80), 0, blockSubtrees); err != nil {
+				t.Fatalf("InsertBlock: %v", err)
+			}
+			if err := meta.PromoteBlock(ctx, blockHash); err != nil {
+				t.Fatalf("PromoteBlock: %v", err)
+			}
+			blockSubtrees = nil
+			height++
+		}
+	}
+
+	return &testChain{
+		engine: NewEngine(meta, treereader.NewReader(kv)),
+		meta:   meta,
+		kv:     kv,
+	}
+}
+
+func tagged(txid byte, pos uint64, tags ...treebuilder.Tag) treebuilder.TaggedTransaction {
+	return treebuilder.TaggedTransaction{TxID: [32]byte{txid}, SubtreePosition: pos, Tags: tags}
+}
+
+func addressTag(addr string, vouts ...uint32) treebuilder.Tag {
+	return treebuilder.Tag{Key: "address", Value: addr, Vouts: vouts}
+}
+
+func TestLookupAcrossBlocks(t *testing.T) {
+	chain := newTestChain(t, 1,
+		[]treebuilder.TaggedTransaction{
+			tagged(1, 0, addressTag(addr1, 0)),
+			tagged(2, 1, addressTag(addr2, 0)),
+		},
+		[]treebuilder.TaggedTransaction{
+			tagged(3, 0, addressTag(addr2, 1)),
+			tagged(4, 1, addressTag(addr1, 0, 1)),
+		},
+	)
+
+	page, err := chain.engine.Lookup(context.Background(), Request{Key: "address", Value: addr1}, 10)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(page.Results) != 2 {
+		t.Fatalf("results: got %d, want 2", len(page.Results))
+	}
+	if page.Next != nil {
+		t.Errorf("expected no next cursor, got %v", page.Next)
+	}
+
+	first, second := page.Results[0], page.Results[1]
+	if first.TxID[0] != 1 || first.BlockHeight != 100 || first.SubtreePosition != 0 {
+		t.Errorf("first result: txid=%x height=%d pos=%d", first.TxID[:1], first.BlockHeight, first.SubtreePosition)
+	}
+	if second.TxID[0] != 4 || second.BlockHeight != 101 || second.SubtreePosition != 1 {
+		t.Errorf("second result: txid=%x height=%d pos=%d", second.TxID[:1], second.BlockHeight, second.SubtreePosition)
+	}
+	if len(second.Vouts) != 2 {
+		t.Errorf("second vouts: got %v, want [0 1]", second.Vouts)
+	}
+}
+
+func TestLookupHeightRange(t *testing.T) {
+	chain := newTestChain(t, 1,
+		[]treebuilder.TaggedTransaction{tagged(1, 0, addressTag(addr1, 0))},
+		[]treebuilder.TaggedTransaction{tagged(2, 0, addressTag(addr1, 0))},
+		[]treebuilder.TaggedTransaction{tagged(3, 0, addressTag(addr1, 0))},
+	)
+
+	page, err := chain.engine.Lookup(context.Background(), Request{
+		Key: "address", Value: addr1, FromHeight: 101, ToHeight: 101,
+	}, 10)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(page.Results) != 1 || page.Results[0].TxID[0] != 2 {
+		t.Fatalf("expected only txid 2 at height 101, got %d results", len(page.Results))
+	}
+}
+
+func TestLookupPagination(t *testing.T) {
+	chain := newTestChain(t, 2,
+		[]treebuilder.TaggedTransaction{
+			tagged(1, 0, addressTag(addr1, 0)),
+			tagged(2, 1, addressTag(addr1, 0)),
+		},
+		[]treebuilder.TaggedTransaction{
+			tagged(3, 0, addressTag(addr1, 0)),
+		},
+		[]treebuilder.TaggedTransaction{
+			tagged(4, 0, addressTag(addr1, 0)),
+			tagged(5, 5, addressTag(addr1, 0)),
+		},
+	)
+	ctx := context.Background()
+
+	var got []byte
+	req := Request{Key: "address", Value: addr1}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := chain.engine.Lookup(ctx, req, 2)
+		if err != nil {
+			t.Fatalf("Lookup: %v", err)
+		}
+		for _, r := range page.Results {
+			got = append(got, r.TxID[0])
+		}
+		if page.Next == nil {
+			break
+		}
+		cursor, err := ParseCursor(page.Next.String())
+		if err != nil {
+			t.Fatalf("ParseCursor: %v", err)
+		}
+		req.After = &cursor
+	}
+
+	if !bytes.Equal(got, []byte{1, 2, 3, 4, 5}) {
+		t.Errorf("paginated txids: got %v, want [1 2 3 4 5]", got)
+	}
+}
+
+func TestLookupSkipsOrphanedBlocks(t *testing.T) {
+	chain := newTestChain(t, 1,
+		[]treebuilder.TaggedTransaction{tagged(1, 0, addressTag(addr1, 0))},
+		[]treebuilder.TaggedTransaction{tagged(2, 0, addressTag(addr1, 0))},
+	)
+	ctx := context.Background()
+
+	if err := chain.meta.OrphanBlock(ctx, bytes.Repeat([]byte{101}, 32)); err != nil {
+		t.Fatalf("OrphanBlock: %v", err)
+	}
+
+	page, err := chain.engine.Lookup(ctx, Request{Key: "address", Value: addr1}, 10)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(page.Results) != 1 || page.Results[0].TxID[0] != 1 {
+		t.Fatalf("expected only txid 1 after orphaning height 101, got %d results", len(page.Results))
+	}
+}
+
+func TestParseCursorInvalid(t *testing.T) {
+	for _, s := range []string{"", "1:2", "a:b:c", "1:2:3:4", "mempool:1:2", "mempool:1:zz:3"} {
+		if _, err := ParseCursor(s); err == nil {
+			t.Errorf("expected error for cursor %q", s)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shruggr/inspiration/indexnode"
+)
+
+// Expr is a boolean combination of tag terms evaluated within one subtree index.
+//
+// NOT is a set difference: it may only appear as an operand of an AND that has
+// at least one positive operand, e.g. "address=X AND NOT protocol=MAP".
+type Expr interface {
+	String() string
+	eval(lookup lookupFunc) ([]indexnode.LeafEntry, error)
+}
+
+// lookupFunc returns the leaf entries for key=value in the current subtree,
+// sorted by SubtreePosition.
+type lookupFunc func(key, value string) ([]indexnode.LeafEntry, error)
+
+// Term matches transactions tagged key=value.
+type Term struct {
+	Key   string
+	Value string
+}
+
+// And matches transactions matched by every operand.
+type And []Expr
+
+// Or matches transactions matched by any operand.
+type Or []Expr
+
+// Not excludes transactions matched by X from its enclosing And.
+type Not struct {
+	X Expr
+}
+
+func (t Term) String() string {
+	return t.Key + "=" + quoteValue(t.Value)
+}
+
+func (a And) String() string { return joinExprs(a, " AND ") }
+func (o Or) String() string  { return joinExprs(o, " OR ") }
+func (n Not) String() string { return "NOT " + n.X.String() }
+
+func (t Term) eval(lookup lookupFunc) ([]indexnode.LeafEntry, error) {
+	return lookup(t.Key, t.Value)
+}
+
+func (a And) eval(lookup lookupFunc) ([]indexnode.LeafEntry, error) {
+	var result []indexnode.LeafEntry
+	first := true
+	for _, e := range a {
+		if _, ok := e.(Not); ok {
+			continue
+		}
+		entries, err := e.eval(lookup)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			result, first = entries, false
+		} else {
+			result = intersectEntries(result, entries)
+		}
+		if len(result) == 0 {
+			return nil, nil
+		}
+	}
+	if first {
+		return nil, fmt.Errorf("AND requires at least one operand without NOT")
+	}
+
+	for _, e := range a {
+		n, ok := e.(Not)
+		if !ok {
+			continue
+		}
+		excluded, err := n.X.eval(lookup)
+		if err != nil {
+			return nil, err
+		}
+		result = subtractEntries(result, excluded)
+		if len(result) == 0 {
+			return nil, nil
+		}
+	}
+	return result, nil
+}
+
+func (o Or) eval(lookup lookupFunc) ([]indexnode.LeafEntry, error) {
+	var result []indexnode.LeafEntry
+	for _, e := range o {
+		entries, err := e.eval(lookup)
+		if err != nil {
+			return nil, err
+		}
+		result = unionEntries(result, entries)
+	}
+	return result, nil
+}
+
+func (n Not) eval(lookupFunc) ([]indexnode.LeafEntry, error) {
+	return nil, fmt.Errorf("NOT %s must be combined with AND", n.X)
+}
+
+// intersectEntries keeps positions present in both lists, merging their vouts and vins.
+func intersectEntries(a, b []indexnode.LeafEntry) []indexnode.LeafEntry {
+	var out []indexnode.LeafEntry
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].SubtreePosition < b[j].SubtreePosition:
+			i++
+		case a[i].SubtreePosition > b[j].SubtreePosition:
+			j++
+		default:
+			out = append(out, mergeEntry(a[i], b[j]))
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// unionEntries keeps positions present in either list, merging vouts and vins where both match.
+func unionEntries(a, b []indexnode.LeafEntry) []indexnode.LeafEntry {
+	out := make([]indexnode.LeafEntry, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].SubtreePosition < b[j].SubtreePosition:
+			out = append(out, a[i])
+			i++
+		case a[i].SubtreePosition > b[j].SubtreePosition:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, mergeEntry(a[i], b[j]))
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// subtractEntries keeps positions in a that are absent from b.
+func subtractEntries(a, b []indexnode.LeafEntry) []indexnode.LeafEntry {
+	var out []indexnode.LeafEntry
+	j := 0
+	for _, e := range a {
+		for j < len(b) && b[j].SubtreePosition < e.SubtreePosition {
+			j++
+		}
+		if j < len(b) && b[j].SubtreePosition == e.SubtreePosition {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func mergeEntry(a, b indexnode.LeafEntry) indexnode.LeafEntry {
+	return indexnode.LeafEntry{
+		TxID:            a.TxID,
+		SubtreePosition: a.SubtreePosition,
+		Vouts:           mergeIndexes(a.Vouts, b.Vouts),
+		Vins:            mergeIndexes(a.Vins, b.Vins),
+	}
+}
+
+func mergeIndexes(a, b []uint32) []uint32 {
+	seen := make(map[uint32]struct{}, len(a)+len(b))
+	out := make([]uint32, 0, len(a)+len(b))
+	for _, v := range append(append([]uint32{}, a...), b...) {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// ParseExpr parses a boolean tag expression such as
+//
+//	address=1BvB... AND type=bsv21 AND NOT protocol=MAP
+//	(address=A OR address=B) AND NOT type="ord reveal"
+//
+// Operators are case-insensitive; AND binds tighter than OR. Values containing
+// spaces or parentheses must be double-quoted.
+func ParseExpr(s string) (Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err := checkExpr(expr, false); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// checkExpr rejects NOT anywhere other than directly under an AND with a positive operand.
+func checkExpr(e Expr, underAnd bool) error {
+	switch e := e.(type) {
+	case Not:
+		if !underAnd {
+			return fmt.Errorf("NOT %s must be combined with AND", e.X)
+		}
+		return checkExpr(e.X, false)
+	case And:
+		positive := false
+		for _, x := range e {
+			if _, ok := x.(Not); !ok {
+				positive = true
+			}
+			if err := checkExpr(x, true); err != nil {
+				return err
+			}
+		}
+		if !positive {
+			return fmt.Errorf("%s requires at least one operand without NOT", e)
+		}
+	case Or:
+		for _, x := range e {
+			if err := checkExpr(x, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type tokenKind int
+
+const (
+	tokTerm tokenKind = iota
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	term Term
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case isSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")"})
+			i++
+		default:
+			start := i
+			for i < len(s) && !isSpace(s[i]) && s[i] != '(' && s[i] != ')' && s[i] != '=' {
+				i++
+			}
+			word := s[start:i]
+			if i < len(s) && s[i] == '=' {
+				value, n, err := readValue(s[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				if word == "" {
+					return nil, fmt.Errorf("missing key before %q", "="+value)
+				}
+				i += 1 + n
+				tokens = append(tokens, token{kind: tokTerm, text: word + "=" + value, term: Term{Key: word, Value: value}})
+				continue
+			}
+			switch strings.ToUpper(word) {
+			case "AND":
+				tokens = append(tokens, token{kind: tokAnd, text: word})
+			case "OR":
+				tokens = append(tokens, token{kind: tokOr, text: word})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokNot, text: word})
+			default:
+				return nil, fmt.Errorf("expected key=value, got %q", word)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// isSpace reports whether c is ASCII whitespace. Bytes of multi-byte UTF-8
+// sequences are never whitespace, so they stay part of the surrounding word.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// readValue reads a bare or double-quoted value, returning it and the bytes consumed.
+func readValue(s string) (string, int, error) {
+	if strings.HasPrefix(s, `"`) {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				if i+1 < len(s) {
+					i++
+					b.WriteByte(s[i])
+				}
+			case '"':
+				return b.String(), i + 1, nil
+			default:
+				b.WriteByte(s[i])
+			}
+		}
+		return "", 0, fmt.Errorf("unterminated quoted value")
+	}
+	i := 0
+	for i < len(s) && !isSpace(s[i]) && s[i] != '(' && s[i] != ')' {
+		i++
+	}
+	return s[:i], i, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := Or{left}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != tokOr {
+			break
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, right)
+	}
+	if len(or) == 1 {
+		return left, nil
+	}
+	return or, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	and := And{left}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != tokAnd {
+			break
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, right)
+	}
+	if len(and) == 1 {
+		return left, nil
+	}
+	return and, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case tokTerm:
+		return t.term, nil
+	case tokNot:
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{X: x}, nil
+	case tokLParen:
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != tokRParen {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return x, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+}
+
+func joinExprs(exprs []Expr, sep string) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		s := e.String()
+		switch e.(type) {
+		case And, Or:
+			s = "(" + s + ")"
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, sep)
+}
+
+func quoteValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n()\"\\") {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
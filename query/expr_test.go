@@ -0,0 +1,159 @@
+package query
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/shruggr/inspiration/indexnode"
+	"github.com/shruggr/inspiration/treebuilder"
+)
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Expr
+	}{
+		{"address=X", Term{"address", "X"}},
+		{
+			"address=X AND type=bsv21 AND NOT protocol=MAP",
+			And{Term{"address", "X"}, Term{"type", "bsv21"}, Not{Term{"protocol", "MAP"}}},
+		},
+		{
+			"a=1 or b=2 and c=3",
+			Or{Term{"a", "1"}, And{Term{"b", "2"}, Term{"c", "3"}}},
+		},
+		{
+			`(a=1 OR a=2) AND NOT type="ord reveal"`,
+			And{Or{Term{"a", "1"}, Term{"a", "2"}}, Not{Term{"type", "ord reveal"}}},
+		},
+		{`k=a=b`, Term{"k", "a=b"}},
+		// 0xa0 and 0x85 are continuation bytes here, not NBSP or NEL
+		{"app=à AND name=…", And{Term{"app", "à"}, Term{"name", "…"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseExpr(tt.in)
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseExpr(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+		// String output must parse back to the same expression
+		again, err := ParseExpr(got.String())
+		if err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("round trip of %q via %q failed: %v", tt.in, got.String(), err)
+		}
+	}
+}
+
+func TestParseExprInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"address",
+		"=X",
+		"a=1 AND",
+		"(a=1",
+		"a=1)",
+		`a="unterminated`,
+		"NOT a=1",
+		"a=1 OR NOT b=2",
+		"NOT a=1 AND NOT b=2",
+	} {
+		if _, err := ParseExpr(in); err == nil {
+			t.Errorf("ParseExpr(%q): expected error", in)
+		}
+	}
+}
+
+func entriesAt(positions ...uint64) []indexnode.LeafEntry {
+	entries := make([]indexnode.LeafEntry, len(positions))
+	for i, p := range positions {
+		entries[i] = indexnode.LeafEntry{SubtreePosition: p, Vouts: []uint32{uint32(p)}}
+	}
+	return entries
+}
+
+func positionsOf(entries []indexnode.LeafEntry) []uint64 {
+	out := []uint64{}
+	for _, e := range entries {
+		out = append(out, e.SubtreePosition)
+	}
+	return out
+}
+
+func TestSetOperations(t *testing.T) {
+	a := entriesAt(1, 3, 5, 7)
+	b := entriesAt(3, 4, 7, 9)
+
+	if got := positionsOf(intersectEntries(a, b)); !reflect.DeepEqual(got, []uint64{3, 7}) {
+		t.Errorf("intersect: got %v", got)
+	}
+	if got := positionsOf(unionEntries(a, b)); !reflect.DeepEqual(got, []uint64{1, 3, 4, 5, 7, 9}) {
+		t.Errorf("union: got %v", got)
+	}
+	if got := positionsOf(subtractEntries(a, b)); !reflect.DeepEqual(got, []uint64{1, 5}) {
+		t.Errorf("subtract: got %v", got)
+	}
+
+	merged := mergeEntry(
+		indexnode.LeafEntry{SubtreePosition: 1, Vouts: []uint32{2, 0}},
+		indexnode.LeafEntry{SubtreePosition: 1, Vouts: []uint32{1, 2}, Vins: []uint32{3}},
+	)
+	if !reflect.DeepEqual(merged.Vouts, []uint32{0, 1, 2}) {
+		t.Errorf("merged vouts: got %v", merged.Vouts)
+	}
+	if !reflect.DeepEqual(merged.Vins, []uint32{3}) {
+		t.Errorf("merged vins: got %v", merged.Vins)
+	}
+}
+
+func TestEachExprAcrossSubtrees(t *testing.T) {
+	tokenTag := treebuilder.Tag{Key: "type", Value: "bsv21", Vouts: []uint32{1}}
+	mapTag := treebuilder.Tag{Key: "protocol", Value: "MAP", Vouts: []uint32{2}}
+
+	chain := newTestChain(t, 1,
+		[]treebuilder.TaggedTransaction{
+			tagged(1, 0, addressTag(addr1, 0), tokenTag),
+			tagged(2, 1, addressTag(addr1, 0)),
+			tagged(3, 2, addressTag(addr1, 0), tokenTag, mapTag),
+		},
+		[]treebuilder.TaggedTransaction{
+			tagged(4, 0, addressTag(addr2, 0), tokenTag),
+			tagged(5, 1, addressTag(addr1, 0), tokenTag),
+		},
+	)
+
+	expr, err := ParseExpr("address=" + addr1 + " AND type=bsv21 AND NOT protocol=MAP")
+	if err != nil {
+		t.Fatalf("ParseExpr: %v", err)
+	}
+
+	var txids []byte
+	var vouts [][]uint32
+	err = chain.engine.Each(context.Background(), Request{Expr: expr}, func(r Result) error {
+		txids = append(txids, r.TxID[0])
+		vouts = append(vouts, r.Vouts)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Each: %v", err)
+	}
+	if !reflect.DeepEqual(txids, []byte{1, 5}) {
+		t.Fatalf("txids: got %v, want [1 5]", txids)
+	}
+	if !reflect.DeepEqual(vouts[0], []uint32{0, 1}) {
+		t.Errorf("vouts merged across terms: got %v, want [0 1]", vouts[0])
+	}
+
+	expr, _ = ParseExpr("address=" + addr2 + " OR protocol=MAP")
+	page, err := chain.engine.Lookup(context.Background(), Request{Expr: expr}, 10)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(page.Results) != 2 || page.Results[0].TxID[0] != 3 || page.Results[1].TxID[0] != 4 {
+		t.Fatalf("OR results: got %d", len(page.Results))
+	}
+}
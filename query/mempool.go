@@ -0,0 +1,78 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Scope selects which subtrees a lookup reads.
+type Scope int
+
+const (
+	// ScopeBlocks reads subtrees of confirmed blocks on the best chain.
+	ScopeBlocks Scope = iota
+	// ScopeMempool reads subtrees not yet included in any confirmed block on
+	// the best chain. Their results are flagged unconfirmed.
+	ScopeMempool
+	// ScopeAll reads blocks and then the mempool.
+	ScopeAll
+)
+
+// ParseScope decodes "blocks", "mempool" or "all"; empty means blocks.
+func ParseScope(s string) (Scope, error) {
+	switch s {
+	case "", "blocks":
+		return ScopeBlocks, nil
+	case "mempool":
+		return ScopeMempool, nil
+	case "all":
+		return ScopeAll, nil
+	}
+	return 0, fmt.Errorf("invalid scope %q", s)
+}
+
+// walkMempool calls fn for each indexed subtree not yet in a confirmed
+// block, or in any best-chain block if pending, oldest first, skipping those
+// before after. Subtrees are ordered by receipt time and hash, which stays
+// stable as others are mined or arrive.
+func (e *Engine) walkMempool(ctx context.Context, pending bool, after *Cursor, fn func(sub subtreeRef) error) error {
+	subtrees, err := e.metadata.GetUnpromotedSubtrees(ctx)
+	if err != nil {
+		return fmt.Errorf("get unmined subtrees: %w", err)
+	}
+	sort.Slice(subtrees, func(i, j int) bool {
+		if !subtrees[i].ReceivedAt.Equal(subtrees[j].ReceivedAt) {
+			return subtrees[i].ReceivedAt.Before(subtrees[j].ReceivedAt)
+		}
+		return bytes.Compare(subtrees[i].Hash, subtrees[j].Hash) < 0
+	})
+
+	index := uint32(0)
+	for _, st := range subtrees {
+		if pending && st.InBlock {
+			continue
+		}
+		i := index
+		index++
+		receivedAt := st.ReceivedAt.Unix()
+		if after != nil && after.Mempool && after.compareSubtree(receivedAt, st.Hash) > 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn(subtreeRef{
+			index:       i,
+			hash:        st.Hash,
+			indexRoot:   st.IndexRoot,
+			receivedAt:  receivedAt,
+			unconfirmed: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
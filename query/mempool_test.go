@@ -0,0 +1,128 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/shruggr/inspiration/treebuilder"
+)
+
+// addMempoolSubtree indexes a subtree without attaching it to a block.
+func (c *testChain) addMempoolSubtree(t *testing.T, hash byte, txs ...treebuilder.TaggedTransaction) []byte {
+	t.Helper()
+	ctx := context.Background()
+	root, err := treebuilder.NewBuilder(c.kv).BuildSubtreeIndex(ctx, txs)
+	if err != nil {
+		t.Fatalf("BuildSubtreeIndex: %v", err)
+	}
+	subtreeHash := bytes.Repeat([]byte{hash}, 32)
+	if err := c.meta.InsertSubtree(ctx, subtreeHash, root.Bytes(), uint32(len(txs))); err != nil {
+		t.Fatalf("InsertSubtree: %v", err)
+	}
+	return subtreeHash
+}
+
+func lookupTxIDs(t *testing.T, e *Engine, req Request) ([]byte, []bool) {
+	t.Helper()
+	var txids []byte
+	var unconfirmed []bool
+	err := e.Each(context.Background(), req, func(r Result) error {
+		txids = append(txids, r.TxID[0])
+		unconfirmed = append(unconfirmed, r.Unconfirmed)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Each: %v", err)
+	}
+	return txids, unconfirmed
+}
+
+func TestLookupMempool(t *testing.T) {
+	chain := newTestChain(t, 1,
+		[]treebuilder.TaggedTransaction{tagged(1, 0, addressTag(addr1, 0))},
+	)
+	sub1 := chain.addMempoolSubtree(t, 0xA1, tagged(2, 0, addressTag(addr1, 0)), tagged(3, 1, addressTag(addr2, 0)))
+	chain.addMempoolSubtree(t, 0xA2, tagged(4, 0, addressTag(addr1, 1)))
+
+	req := Request{Key: "address", Value: addr1}
+	if txids, _ := lookupTxIDs(t, chain.engine, req); !bytes.Equal(txids, []byte{1}) {
+		t.Errorf("blocks scope: got %v, want [1]", txids)
+	}
+
+	req.Scope = ScopeMempool
+	txids, unconfirmed := lookupTxIDs(t, chain.engine, req)
+	if !bytes.Equal(txids, []byte{2, 4}) || !unconfirmed[0] || !unconfirmed[1] {
+		t.Errorf("mempool scope: got %v %v, want unconfirmed [2 4]", txids, unconfirmed)
+	}
+
+	req.Scope = ScopeAll
+	txids, unconfirmed = lookupTxIDs(t, chain.engine, req)
+	if !bytes.Equal(txids, []byte{1, 2, 4}) || unconfirmed[0] || !unconfirmed[1] {
+		t.Errorf("all scope: got %v %v", txids, unconfirmed)
+	}
+
+	// Paging crosses from blocks into the mempool
+	page, err := chain.engine.Lookup(context.Background(), req, 2)
+	if err != nil || page.Next == nil || !page.Next.Mempool || !bytes.Equal(page.Next.SubtreeHash, sub1) {
+		t.Fatalf("first page: %+v, %v", page, err)
+	}
+	cursor, err := ParseCursor(page.Next.String())
+	if err != nil {
+		t.Fatalf("ParseCursor: %v", err)
+	}
+	req.After = &cursor
+	if page, err = chain.engine.Lookup(context.Background(), req, 2); err != nil || len(page.Results) != 1 || page.Results[0].TxID[0] != 4 {
+		t.Fatalf("second page: %+v, %v", page, err)
+	}
+
+	// Mined but not yet confirmed, the first subtree's transactions stay in
+	// the mempool scope unless pending blocks are read
+	block := bytes.Repeat([]byte{101}, 32)
+	if err := chain.meta.InsertBlock(context.Background(), 101, block, make([]byte, 80), 2, [][]byte{sub1}); err != nil {
+		t.Fatalf("InsertBlock: %v", err)
+	}
+	req.After = nil
+	if txids, unconfirmed := lookupTxIDs(t, chain.engine, req); !bytes.Equal(txids, []byte{1, 2, 4}) || unconfirmed[0] || !unconfirmed[1] || !unconfirmed[2] {
+		t.Errorf("pending block: got %v %v", txids, unconfirmed)
+	}
+	pending := req
+	pending.Pending = true
+	if txids, unconfirmed := lookupTxIDs(t, chain.engine, pending); !bytes.Equal(txids, []byte{1, 2, 4}) || unconfirmed[0] || unconfirmed[1] || !unconfirmed[2] {
+		t.Errorf("pending block read as pending: got %v %v", txids, unconfirmed)
+	}
+
+	// Once confirmed, they are read from the block
+	if err := chain.meta.PromoteBlock(context.Background(), block); err != nil {
+		t.Fatalf("PromoteBlock: %v", err)
+	}
+	req.After = &cursor
+
+	// The mempool cursor still resumes after the mined subtree
+	if page, err = chain.engine.Lookup(context.Background(), req, 2); err != nil || len(page.Results) != 1 || page.Results[0].TxID[0] != 4 {
+		t.Fatalf("resumed page after mining: %+v, %v", page, err)
+	}
+
+	req.After = nil
+	txids, unconfirmed = lookupTxIDs(t, chain.engine, req)
+	if !bytes.Equal(txids, []byte{1, 2, 4}) || unconfirmed[1] || !unconfirmed[2] {
+		t.Errorf("after mining: got %v %v", txids, unconfirmed)
+	}
+
+	// The mempool is past any height bound
+	req.ToHeight = 200
+	if txids, _ := lookupTxIDs(t, chain.engine, req); !bytes.Equal(txids, []byte{1, 2}) {
+		t.Errorf("bounded all scope: got %v, want [1 2]", txids)
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	for s, want := range map[string]Scope{"": ScopeBlocks, "blocks": ScopeBlocks, "mempool": ScopeMempool, "all": ScopeAll} {
+		if got, err := ParseScope(s); err != nil || got != want {
+			t.Errorf("ParseScope(%q): %v, %v", s, got, err)
+		}
+	}
+	if _, err := ParseScope("pending"); err == nil {
+		t.Error("expected error for unknown scope")
+	}
+}
@@ -0,0 +1,169 @@
+package query
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shruggr/inspiration/treereader"
+)
+
+// ScanRequest describes a scan over the values of one tag key across a range
+// of blocks. Prefix and Start/End are mutually exclusive; with neither set
+// every value of Key matches.
+type ScanRequest struct {
+	Key        string
+	Prefix     string // match values starting with Prefix
+	Start      string // match values >= Start
+	End        string // match values < End; empty means no upper bound
+	FromHeight uint32
+	ToHeight   uint32      // 0 means no upper bound
+	After      *ScanCursor // resume strictly after this position
+}
+
+// ValueResults is one tag value with its results in chain order.
+type ValueResults struct {
+	Value   string
+	Results []Result
+}
+
+// Cursor returns the scan position of the last result.
+func (v ValueResults) Cursor() ScanCursor {
+	return ScanCursor{Cursor: v.Results[len(v.Results)-1].Cursor(), Value: v.Value}
+}
+
+// ScanPage is one page of values with the position to resume after, if any.
+type ScanPage struct {
+	Values []ValueResults
+	Next   *ScanCursor
+}
+
+// ScanCursor is the position of a scan result. Scans run subtree by subtree
+// in chain order and by value within a subtree, so it is the result's chain
+// position with its value ordered before the subtree position.
+type ScanCursor struct {
+	Cursor
+	Value string
+}
+
+// String encodes the cursor as "height:subtreeIndex:position:valuehex".
+func (c ScanCursor) String() string {
+	return c.Cursor.String() + ":" + hex.EncodeToString([]byte(c.Value))
+}
+
+// ParseScanCursor decodes a cursor produced by ScanCursor.String.
+func ParseScanCursor(s string) (ScanCursor, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return ScanCursor{}, fmt.Errorf("invalid scan cursor %q", s)
+	}
+	c, err := ParseCursor(s[:i])
+	if err != nil {
+		return ScanCursor{}, err
+	}
+	if c.Mempool {
+		return ScanCursor{}, fmt.Errorf("invalid scan cursor %q", s)
+	}
+	value, err := hex.DecodeString(s[i+1:])
+	if err != nil {
+		return ScanCursor{}, fmt.Errorf("invalid scan cursor value: %w", err)
+	}
+	return ScanCursor{Cursor: c, Value: string(value)}, nil
+}
+
+// Scan returns up to limit results for values of req.Key, grouped by value
+// in sorted order. Subtrees are read in chain order from req.After, and only
+// until the page is full, so a value whose results span pages appears on
+// each of them.
+func (e *Engine) Scan(ctx context.Context, req ScanRequest, limit int) (*ScanPage, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	values := make(map[string][]Result)
+	n := 0
+	page := &ScanPage{}
+	var last ScanCursor
+	err := e.ScanEach(ctx, req, func(v ValueResults) error {
+		for _, r := range v.Results {
+			if n == limit {
+				page.Next = &last
+				return errStop
+			}
+			values[v.Value] = append(values[v.Value], r)
+			last = ScanCursor{Cursor: r.Cursor(), Value: v.Value}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]string, 0, len(values))
+	for v := range values {
+		sorted = append(sorted, v)
+	}
+	sort.Strings(sorted)
+	page.Values = make([]ValueResults, len(sorted))
+	for i, v := range sorted {
+		page.Values[i] = ValueResults{Value: v, Results: values[v]}
+	}
+	return page, nil
+}
+
+// ScanEach streams the matches of req to fn subtree by subtree in chain
+// order, one ValueResults per matching value of each subtree, in value order.
+func (e *Engine) ScanEach(ctx context.Context, req ScanRequest, fn func(v ValueResults) error) error {
+	if req.Key == "" {
+		return errors.New("key is required")
+	}
+	if req.Prefix != "" && (req.Start != "" || req.End != "") {
+		return errors.New("prefix and range are mutually exclusive")
+	}
+	after := req.After
+	var afterSubtree *Cursor
+	if after != nil {
+		afterSubtree = &after.Cursor
+	}
+
+	err := e.walkSubtrees(ctx, req.FromHeight, req.ToHeight, false, afterSubtree, func(sub subtreeRef) error {
+		var matches []treereader.ValueEntries
+		var err error
+		if req.Prefix != "" {
+			matches, err = e.reader.ScanPrefix(ctx, sub.indexRoot, req.Key, req.Prefix)
+		} else {
+			matches, err = e.reader.ScanRange(ctx, sub.indexRoot, req.Key, req.Start, req.End)
+		}
+		if err != nil {
+			return fmt.Errorf("scan subtree %x: %w", sub.hash, err)
+		}
+
+		resuming := after != nil && sub.block.Height == after.Height && sub.index == after.SubtreeIndex
+		for _, m := range matches {
+			if resuming && m.Value < after.Value {
+				continue
+			}
+			v := ValueResults{Value: m.Value}
+			emitEntries(sub, m.Entries, nil, func(r Result) error {
+				if !resuming || m.Value != after.Value || r.SubtreePosition > after.SubtreePosition {
+					v.Results = append(v.Results, r)
+				}
+				return nil
+			})
+			if len(v.Results) == 0 {
+				continue
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errStop) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/shruggr/inspiration/treebuilder"
+)
+
+func valuesOf(page *ScanPage) []string {
+	out := []string{}
+	for _, v := range page.Values {
+		out = append(out, v.Value)
+	}
+	return out
+}
+
+func TestScanPrefixAcrossBlocks(t *testing.T) {
+	chain := newTestChain(t, 1,
+		[]treebuilder.TaggedTransaction{
+			tagged(1, 0, addressTag(addr2, 0)),
+			tagged(2, 1, addressTag(addr1, 1)),
+		},
+		[]treebuilder.TaggedTransaction{
+			tagged(3, 0, addressTag(addr2, 2)),
+			tagged(4, 1, addressTag("3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", 0)),
+		},
+	)
+	ctx := context.Background()
+
+	page, err := chain.engine.Scan(ctx, ScanRequest{Key: "address", Prefix: "1"}, 10)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if got := valuesOf(page); !reflect.DeepEqual(got, []string{addr1, addr2}) {
+		t.Fatalf("values: got %v", got)
+	}
+	if page.Next != nil {
+		t.Errorf("expected no next page, got %v", page.Next)
+	}
+
+	// addr2 results are merged across both blocks in chain order
+	results := page.Values[1].Results
+	if len(results) != 2 || results[0].BlockHeight != 100 || results[1].BlockHeight != 101 {
+		t.Fatalf("addr2 results: got %+v", results)
+	}
+	if results[1].TxID[0] != 3 || !reflect.DeepEqual(results[1].Vouts, []uint32{2}) {
+		t.Errorf("addr2 second result: got %+v", results[1])
+	}
+
+	page, err = chain.engine.Scan(ctx, ScanRequest{Key: "address", Prefix: "1", FromHeight: 101}, 10)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if got := valuesOf(page); !reflect.DeepEqual(got, []string{addr2}) {
+		t.Fatalf("values from height 101: got %v", got)
+	}
+}
+
+func TestScanRangePagination(t *testing.T) {
+	// Each subtree holds the same spread of values, so values recur across
+	// pages as subtrees are read in chain order.
+	var subtrees [][]treebuilder.TaggedTransaction
+	for s := 0; s < 3; s++ {
+		var txs []treebuilder.TaggedTransaction
+		for v := 0; v < 10; v++ {
+			tag := treebuilder.Tag{Key: "timestamp", Value: fmt.Sprintf("%03d", 9-v), Vouts: []uint32{0}}
+			txs = append(txs, tagged(byte(s*10+v), uint64(v), tag))
+		}
+		subtrees = append(subtrees, txs)
+	}
+	chain := newTestChain(t, 1, subtrees...)
+	ctx := context.Background()
+
+	req := ScanRequest{Key: "timestamp", Start: "002", End: "008"}
+	var pages [][]string
+	counts := make(map[string]int)
+	for {
+		if len(pages) > 10 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := chain.engine.Scan(ctx, req, 4)
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		var values []string
+		for _, v := range page.Values {
+			values = append(values, v.Value)
+			for _, r := range v.Results {
+				counts[fmt.Sprintf("%s/%d", v.Value, r.TxID[0])]++
+			}
+		}
+		pages = append(pages, values)
+		if page.Next == nil {
+			break
+		}
+		next, err := ParseScanCursor(page.Next.String())
+		if err != nil || next.String() != page.Next.String() || next.Value != page.Next.Value {
+			t.Fatalf("cursor round trip of %s: %+v, %v", page.Next, next, err)
+		}
+		req.After = &next
+	}
+
+	// 18 results in pages of 4, each value sorted within its page. The
+	// first subtree's last two values share the second page with the next
+	// subtree's first two.
+	if len(pages) != 5 || len(counts) != 18 {
+		t.Fatalf("pages: got %v, %d results", pages, len(counts))
+	}
+	for k, n := range counts {
+		if n != 1 {
+			t.Errorf("result %s returned %d times", k, n)
+		}
+	}
+	if want := []string{"002", "003", "006", "007"}; !reflect.DeepEqual(pages[1], want) {
+		t.Errorf("second page: got %v, want %v", pages[1], want)
+	}
+}
+
+func TestScanInvalid(t *testing.T) {
+	chain := newTestChain(t, 1, []treebuilder.TaggedTransaction{tagged(1, 0, addressTag(addr1, 0))})
+	ctx := context.Background()
+
+	for _, req := range []ScanRequest{
+		{},
+		{Key: "address", Prefix: "1", Start: "1"},
+	} {
+		if _, err := chain.engine.Scan(ctx, req, 10); err == nil {
+			t.Errorf("Scan(%+v): expected error", req)
+		}
+	}
+	if _, err := chain.engine.Scan(ctx, ScanRequest{Key: "address"}, 0); err == nil {
+		t.Error("expected error for zero limit")
+	}
+	for _, s := range []string{"", "1:0:0", "1:0:0:zz", "mempool:1:00:0:61"} {
+		if _, err := ParseScanCursor(s); err == nil {
+			t.Errorf("ParseScanCursor(%q): expected error", s)
+		}
+	}
+}
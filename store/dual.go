@@ -16,6 +16,11 @@ func NewDualStore(working, persistent kvstore.KVStore) *DualStore {
 	return &DualStore{working: working, persistent: persistent}
 }
 
+// Working returns the underlying working-space store.
+func (d *DualStore) Working() kvstore.KVStore {
+	return d.working
+}
+
 func (d *DualStore) Put(ctx context.Context, key, value []byte) error {
 	return d.working.Put(ctx, key, value)
 }
@@ -59,12 +64,21 @@ func (d *DualStore) Close() error {
 }
 
 // Promote copies a key from working to persistent space.
+// Promoting a key that is already persistent is a no-op, so an interrupted
+// promotion can safely be repeated.
 func (d *DualStore) Promote(ctx context.Context, key []byte) error {
 	val, err := d.working.Get(ctx, key)
 	if err != nil {
 		return err
 	}
 	if val == nil {
+		ok, err := d.persistent.Has(ctx, key)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
 		return fmt.Errorf("key not found in working space")
 	}
 	return d.persistent.Put(ctx, key, val)
@@ -80,6 +80,29 @@ func TestPromote(t *testing.T) {
 	}
 }
 
+func TestPromoteIdempotent(t *testing.T) {
+	dual, w, _ := newTestDual()
+	ctx := context.Background()
+
+	if err := dual.Put(ctx, []byte("k1"), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dual.Promote(ctx, []byte("k1")); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate the working copy being dropped after a previous promotion
+	if err := w.Delete(ctx, []byte("k1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dual.Promote(ctx, []byte("k1")); err != nil {
+		t.Fatalf("expected repeat promotion to succeed, got %v", err)
+	}
+
+	if err := dual.Promote(ctx, []byte("missing")); err == nil {
+		t.Fatal("expected error promoting a key in neither space")
+	}
+}
+
 func TestHasReadThrough(t *testing.T) {
 	dual, _, p := newTestDual()
 	ctx := context.Background()
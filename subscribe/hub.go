@@ -0,0 +1,306 @@
+// Package subscribe streams tag matches to subscribers as subtrees are
+// indexed and blocks join or leave the best chain.
+package subscribe
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+
+	"github.com/shruggr/inspiration/metadata"
+	"github.com/shruggr/inspiration/processor"
+	"github.com/shruggr/inspiration/query"
+)
+
+// Event types.
+const (
+	// EventUnconfirmed is a match in a newly indexed subtree not yet in a block.
+	EventUnconfirmed = "unconfirmed"
+	// EventConfirmed is a match in a block on the best chain.
+	EventConfirmed = "confirmed"
+	// EventRetracted is a previously confirmed match in a block removed from
+	// the best chain by a reorg.
+	EventRetracted = "retracted"
+)
+
+// ErrSlowConsumer ends a subscription that fell too far behind. The client
+// should resubscribe from the cursor of the last event it received.
+var ErrSlowConsumer = errors.New("subscriber fell behind")
+
+// Event is a single match delivered to a subscriber.
+type Event struct {
+	Type   string
+	Result query.Result
+	// Cursor is where to resubscribe from to receive every confirmed match
+	// after this event. It is always a block cursor.
+	Cursor query.Cursor
+}
+
+type Config struct {
+	// Buffer is the number of chain notifications and events held for each
+	// subscriber. A subscriber whose notifications overflow is dropped with
+	// ErrSlowConsumer. Notifications while it replays matches after its cursor
+	// are queued apart and do not count.
+	Buffer int
+}
+
+func DefaultConfig() Config {
+	return Config{Buffer: 256}
+}
+
+// notification is one change to the index, fanned out to every subscriber.
+// Exactly one of its fields is set.
+type notification struct {
+	subtree *subtreeNote
+	block   *metadata.Block
+	reorg   *processor.ReorgEvent
+}
+
+type subtreeNote struct {
+	hash, indexRoot []byte
+}
+
+// Hub fans processor notifications out to subscriptions, each of which
+// evaluates its own filter.
+type Hub struct {
+	engine *query.Engine
+	config Config
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+func NewHub(engine *query.Engine, config Config, logger *slog.Logger) *Hub {
+	return &Hub{
+		engine: engine,
+		config: config,
+		logger: logger,
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// SubtreeIndexed is a processor.SubtreeIndexedHandler.
+func (h *Hub) SubtreeIndexed(_ context.Context, subtreeHash, indexRoot []byte) {
+	h.notify(notification{subtree: &subtreeNote{hash: subtreeHash, indexRoot: indexRoot}})
+}
+
+// BlockConnected is a processor.BlockConnectedHandler.
+func (h *Hub) BlockConnected(_ context.Context, block metadata.Block) {
+	h.notify(notification{block: &block})
+}
+
+// Reorg is a processor.ReorgHandler. The connected blocks are delivered
+// separately through BlockConnected.
+func (h *Hub) Reorg(_ context.Context, ev processor.ReorgEvent) {
+	h.notify(notification{reorg: &ev})
+}
+
+func (h *Hub) notify(n notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if s.catchingUp {
+			s.backlog = append(s.backlog, n)
+			continue
+		}
+		select {
+		case s.notes <- n:
+		default:
+			h.logger.Warn("dropping slow subscriber", "filter", s.expr.String())
+			if s.err == nil {
+				s.err = ErrSlowConsumer
+			}
+			h.removeLocked(s)
+		}
+	}
+}
+
+func (h *Hub) removeLocked(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.notes)
+	}
+}
+
+// Subscribe streams matches for expr until ctx is done or the subscription
+// is closed. Confirmed matches after the cursor are replayed first; with no
+// cursor only matches from now on are delivered.
+func (h *Hub) Subscribe(ctx context.Context, expr query.Expr, after *query.Cursor) (*Subscription, error) {
+	if after == nil {
+		// Read the tip before registering so a block connected in between
+		// is caught up rather than missed.
+		tip, err := h.engine.TipHeight(ctx)
+		if err != nil {
+			return nil, err
+		}
+		end := blockEnd(tip)
+		after = &end
+	}
+
+	s := &Subscription{
+		hub:        h,
+		expr:       expr,
+		notes:      make(chan notification, h.config.Buffer),
+		events:     make(chan Event, h.config.Buffer),
+		catchingUp: true,
+	}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+
+	go s.run(ctx, *after)
+	return s, nil
+}
+
+// Subscription is one subscriber's stream of events.
+type Subscription struct {
+	hub    *Hub
+	expr   query.Expr
+	notes  chan notification
+	events chan Event
+	err    error
+	// While catchingUp, notifications are queued in backlog instead of
+	// notes, as replaying matches after the cursor may take longer than
+	// Buffer notifications.
+	catchingUp bool
+	backlog    []notification
+}
+
+// Events returns the event stream, which is closed when the subscription
+// ends. Err then reports why.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns the error that ended the subscription, if any. It is only
+// valid once Events is closed.
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	s.hub.removeLocked(s)
+	s.hub.mu.Unlock()
+}
+
+func (s *Subscription) run(ctx context.Context, last query.Cursor) {
+	defer close(s.events)
+	defer s.Close()
+
+	emit := func(ev Event) error {
+		select {
+		case s.events <- ev:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	// Catch up on confirmed matches after the cursor. Blocks also notified
+	// while this runs are skipped below by cursor.
+	start := last
+	err := s.hub.engine.Each(ctx, query.Request{Expr: s.expr, After: &start, Pending: true}, func(r query.Result) error {
+		last = r.Cursor()
+		return emit(Event{Type: EventConfirmed, Result: r, Cursor: last})
+	})
+	if err != nil {
+		s.fail(ctx, err)
+		return
+	}
+
+	// Then on the notifications that arrived meanwhile; later ones go to
+	// notes and count towards Buffer
+	s.hub.mu.Lock()
+	backlog := s.backlog
+	s.backlog, s.catchingUp = nil, false
+	s.hub.mu.Unlock()
+	for _, n := range backlog {
+		if err := s.handle(ctx, n, &last, emit); err != nil {
+			s.fail(ctx, err)
+			return
+		}
+	}
+
+	for {
+		var n notification
+		var ok bool
+		select {
+		case n, ok = <-s.notes:
+		case <-ctx.Done():
+			return
+		}
+		if !ok {
+			return
+		}
+		if err := s.handle(ctx, n, &last, emit); err != nil {
+			s.fail(ctx, err)
+			return
+		}
+	}
+}
+
+// handle emits the events for one notification, advancing last past the
+// confirmed matches delivered.
+func (s *Subscription) handle(ctx context.Context, n notification, last *query.Cursor, emit func(Event) error) error {
+	engine := s.hub.engine
+	switch {
+	case n.subtree != nil:
+		return engine.EachInSubtree(ctx, s.expr, n.subtree.hash, n.subtree.indexRoot, func(r query.Result) error {
+			return emit(Event{Type: EventUnconfirmed, Result: r, Cursor: *last})
+		})
+	case n.block != nil:
+		err := engine.EachInBlock(ctx, s.expr, *n.block, func(r query.Result) error {
+			if !last.Less(r.Cursor()) {
+				return nil
+			}
+			*last = r.Cursor()
+			return emit(Event{Type: EventConfirmed, Result: r, Cursor: *last})
+		})
+		if end := blockEnd(n.block.Height); last.Less(end) {
+			*last = end
+		}
+		return err
+	case n.reorg != nil:
+		fork := blockEnd(n.reorg.ForkHeight)
+		for _, b := range n.reorg.Disconnected {
+			err := engine.EachInBlock(ctx, s.expr, b, func(r query.Result) error {
+				if last.Less(r.Cursor()) {
+					return nil // never delivered
+				}
+				return emit(Event{Type: EventRetracted, Result: r, Cursor: fork})
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if fork.Less(*last) {
+			*last = fork
+		}
+	}
+	return nil
+}
+
+// fail records err as the reason the subscription ended, unless it ended
+// because ctx is done.
+func (s *Subscription) fail(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	s.hub.logger.Error("subscription", "filter", s.expr.String(), "error", err)
+	s.hub.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.hub.mu.Unlock()
+}
+
+// blockEnd is the cursor just after every transaction in the block at height.
+func blockEnd(height uint32) query.Cursor {
+	return query.Cursor{Height: height, SubtreeIndex: math.MaxUint32, SubtreePosition: math.MaxUint64}
+}
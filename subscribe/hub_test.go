@@ -0,0 +1,252 @@
+package subscribe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	kvmem "github.com/shruggr/inspiration/kvstore/memory"
+	"github.com/shruggr/inspiration/metadata"
+	metasqlite "github.com/shruggr/inspiration/metadata/sqlite"
+	"github.com/shruggr/inspiration/processor"
+	"github.com/shruggr/inspiration/query"
+	"github.com/shruggr/inspiration/treebuilder"
+	"github.com/shruggr/inspiration/treereader"
+)
+
+const addr1 = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+
+type testIndex struct {
+	hub     *Hub
+	meta    *metasqlite.SQLiteStore
+	builder treebuilder.Builder
+}
+
+func newTestIndex(t *testing.T, config Config) *testIndex {
+	t.Helper()
+	kv := kvmem.New()
+	meta, err := metasqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("create metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	engine := query.NewEngine(meta, treereader.NewReader(kv))
+	return &testIndex{
+		hub:     NewHub(engine, config, slog.Default()),
+		meta:    meta,
+		builder: treebuilder.NewBuilder(kv),
+	}
+}
+
+// addSubtree indexes a subtree paying addr1 in txid and notifies the hub.
+func (x *testIndex) addSubtree(t *testing.T, id byte, txid byte) []byte {
+	t.Helper()
+	ctx := context.Background()
+	root, err := x.builder.BuildSubtreeIndex(ctx, []treebuilder.TaggedTransaction{{
+		TxID: [32]byte{txid},
+		Tags: []treebuilder.Tag{{Key: "address", Value: addr1, Vouts: []uint32{0}}},
+	}})
+	if err != nil {
+		t.Fatalf("BuildSubtreeIndex: %v", err)
+	}
+	hash := bytes.Repeat([]byte{id}, 32)
+	if err := x.meta.InsertSubtree(ctx, hash, root.Bytes(), 1); err != nil {
+		t.Fatalf("InsertSubtree: %v", err)
+	}
+	x.hub.SubtreeIndexed(ctx, hash, root.Bytes())
+	return hash
+}
+
+// addBlock records a block of subtrees at height and notifies the hub; tag
+// distinguishes competing blocks at the same height.
+func (x *testIndex) addBlock(t *testing.T, height uint32, tag byte, subtrees ...[]byte) metadata.Block {
+	t.Helper()
+	hash := bytes.Repeat([]byte{byte(height)}, 32)
+	hash[31] = tag
+	b := metadata.Block{Height: height, Hash: hash, Header: make([]byte, 80)}
+	if err := x.meta.InsertBlock(context.Background(), height, b.Hash, b.Header, 1, subtrees); err != nil {
+		t.Fatalf("InsertBlock: %v", err)
+	}
+	x.hub.BlockConnected(context.Background(), b)
+	return b
+}
+
+func next(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("subscription ended: %v", sub.Err())
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return Event{}
+}
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	x := newTestIndex(t, DefaultConfig())
+	ctx := context.Background()
+	sub, err := x.hub.Subscribe(ctx, query.Term{Key: "address", Value: addr1}, nil)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	st := x.addSubtree(t, 0xA1, 1)
+	ev := next(t, sub)
+	if ev.Type != EventUnconfirmed || ev.Result.TxID[0] != 1 || !ev.Result.Unconfirmed {
+		t.Fatalf("subtree event: %+v", ev)
+	}
+
+	block := x.addBlock(t, 100, 0, st)
+	ev = next(t, sub)
+	if ev.Type != EventConfirmed || ev.Result.BlockHeight != 100 || ev.Cursor.String() != "100:0:0" {
+		t.Fatalf("block event: %+v", ev)
+	}
+
+	if err := x.meta.OrphanBlock(ctx, block.Hash); err != nil {
+		t.Fatalf("OrphanBlock: %v", err)
+	}
+	x.hub.Reorg(ctx, processor.ReorgEvent{ForkHeight: 99, Disconnected: []metadata.Block{block}})
+	ev = next(t, sub)
+	if ev.Type != EventRetracted || ev.Result.TxID[0] != 1 || ev.Cursor.Height != 99 {
+		t.Fatalf("retraction event: %+v", ev)
+	}
+
+	// The replacement block is delivered even though it sits at the same height
+	block2 := x.addBlock(t, 100, 1, x.addSubtree(t, 0xA2, 2))
+	if ev = next(t, sub); ev.Type != EventUnconfirmed {
+		t.Fatalf("second subtree event: %+v", ev)
+	}
+	if ev = next(t, sub); ev.Type != EventConfirmed || !bytes.Equal(ev.Result.BlockHash, block2.Hash) {
+		t.Fatalf("replacement block event: %+v", ev)
+	}
+}
+
+func TestSubscriptionResumes(t *testing.T) {
+	x := newTestIndex(t, DefaultConfig())
+	x.addBlock(t, 100, 0, x.addSubtree(t, 0xA1, 1))
+	x.addBlock(t, 101, 0, x.addSubtree(t, 0xA2, 2))
+
+	cursor, _ := query.ParseCursor("100:0:0")
+	sub, err := x.hub.Subscribe(context.Background(), query.Term{Key: "address", Value: addr1}, &cursor)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	if ev := next(t, sub); ev.Type != EventConfirmed || ev.Result.BlockHeight != 101 {
+		t.Fatalf("catch-up event: %+v", ev)
+	}
+
+	// A block already caught up on is not delivered twice
+	hash := bytes.Repeat([]byte{101}, 32)
+	hash[31] = 0
+	block, _ := x.meta.GetBlock(context.Background(), hash)
+	x.hub.BlockConnected(context.Background(), *block)
+	x.addBlock(t, 102, 0, x.addSubtree(t, 0xA3, 3))
+	if ev := next(t, sub); ev.Type != EventUnconfirmed || ev.Result.TxID[0] != 3 {
+		t.Fatalf("expected subtree event for txid 3, got %+v", ev)
+	}
+	if ev := next(t, sub); ev.Type != EventConfirmed || ev.Result.BlockHeight != 102 {
+		t.Fatalf("expected block 102, got %+v", ev)
+	}
+}
+
+// waitLive waits for sub to finish catching up, after which its
+// notifications count towards Buffer.
+func waitLive(t *testing.T, sub *Subscription) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sub.hub.mu.Lock()
+		live := !sub.catchingUp
+		sub.hub.mu.Unlock()
+		if live {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscription did not finish catching up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLongCatchUp(t *testing.T) {
+	x := newTestIndex(t, Config{Buffer: 16})
+	ctx := context.Background()
+	const n = 300
+	txs := make([]treebuilder.TaggedTransaction, n)
+	for i := range txs {
+		txs[i] = treebuilder.TaggedTransaction{
+			TxID:            [32]byte{0xFF, byte(i >> 8), byte(i)},
+			SubtreePosition: uint64(i),
+			Tags:            []treebuilder.Tag{{Key: "address", Value: addr1, Vouts: []uint32{0}}},
+		}
+	}
+	root, err := x.builder.BuildSubtreeIndex(ctx, txs)
+	if err != nil {
+		t.Fatalf("BuildSubtreeIndex: %v", err)
+	}
+	st := bytes.Repeat([]byte{0xFF}, 32)
+	if err := x.meta.InsertSubtree(ctx, st, root.Bytes(), n); err != nil {
+		t.Fatalf("InsertSubtree: %v", err)
+	}
+	x.addBlock(t, 100, 0, st)
+
+	cursor := blockEnd(99)
+	sub, err := x.hub.Subscribe(ctx, query.Term{Key: "address", Value: addr1}, &cursor)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	// The catch-up outlasts both buffers while nothing reads, and more
+	// notifications arrive than Buffer holds
+	for i := range 20 {
+		x.addSubtree(t, byte(0xA0+i), byte(i+1))
+	}
+	for i := range n {
+		if ev := next(t, sub); ev.Type != EventConfirmed || ev.Result.SubtreePosition != uint64(i) {
+			t.Fatalf("catch-up event %d: %+v", i, ev)
+		}
+	}
+	for i := range 20 {
+		if ev := next(t, sub); ev.Type != EventUnconfirmed || ev.Result.TxID[0] != byte(i+1) {
+			t.Fatalf("event %d after catch-up: %+v", i, ev)
+		}
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	x := newTestIndex(t, Config{Buffer: 1})
+	sub, err := x.hub.Subscribe(context.Background(), query.Term{Key: "address", Value: addr1}, nil)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	waitLive(t, sub)
+
+	// Nothing reads events, so notifications back up
+	for i := range 5 {
+		x.addSubtree(t, byte(0xA0+i), byte(i+1))
+	}
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-sub.Events():
+			if !ok {
+				if !errors.Is(sub.Err(), ErrSlowConsumer) {
+					t.Fatalf("Err: got %v, want ErrSlowConsumer", sub.Err())
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatal("slow subscriber was not dropped")
+		}
+	}
+}
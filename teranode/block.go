@@ -0,0 +1,178 @@
+package teranode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsv-blockchain/go-sdk/util"
+)
+
+// maxBlockPage is the most blocks Teranode lists in one page.
+const maxBlockPage = 100
+
+// Block is a block as served by Teranode: its header, the subtrees holding
+// its transactions and its coinbase.
+type Block struct {
+	Header      []byte
+	TxCount     uint64
+	SizeInBytes uint64
+	Subtrees    [][]byte // subtree root hashes in internal byte order
+	CoinbaseTx  []byte
+	Height      uint32
+}
+
+// BlockInfo identifies a block on Teranode's best chain.
+type BlockInfo struct {
+	Height uint32 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// FetchBlock fetches a block with its subtree list. It returns an error
+// wrapping ErrBlockNotFound if no server has it.
+func (c *Client) FetchBlock(ctx context.Context, blockHashHex string) (*Block, error) {
+	body, err := c.get(ctx, c.urls("/api/v1/block/"+blockHashHex))
+	if errors.Is(err, errNotFound) {
+		return nil, fmt.Errorf("fetch block %s: %w", blockHashHex, ErrBlockNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetch block %s: %w", blockHashHex, err)
+	}
+	b, err := parseBlock(body)
+	if err != nil {
+		return nil, fmt.Errorf("parse block %s: %w", blockHashHex, err)
+	}
+	return b, nil
+}
+
+// FetchBlockInfos returns the best-chain blocks from fromHeight to toHeight,
+// lowest first. Teranode lists blocks by their distance from its tip, so the
+// range may come back short if the tip moves between requests.
+func (c *Client) FetchBlockInfos(ctx context.Context, fromHeight, toHeight uint32) ([]BlockInfo, error) {
+	if toHeight < fromHeight {
+		return nil, nil
+	}
+	tip, err := c.listBlocks(ctx, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(tip) == 0 {
+		return nil, fmt.Errorf("list blocks: %w", ErrBlockNotFound)
+	}
+	tipHeight := tip[0].Height
+	if toHeight > tipHeight {
+		return nil, fmt.Errorf("list blocks: height %d is above tip %d: %w", toHeight, tipHeight, ErrBlockNotFound)
+	}
+
+	var infos []BlockInfo
+	for top := toHeight; ; {
+		limit := maxBlockPage
+		if n := top - fromHeight + 1; n < uint32(limit) {
+			limit = int(n)
+		}
+		page, err := c.listBlocks(ctx, int(tipHeight-top), limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range page {
+			if info.Height >= fromHeight && info.Height <= toHeight {
+				infos = append(infos, info)
+			}
+		}
+		if top-fromHeight < uint32(limit) {
+			break
+		}
+		top -= uint32(limit)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Height < infos[j].Height })
+	return infos, nil
+}
+
+// listBlocks fetches a page of best-chain blocks, newest first, starting
+// offset blocks below the tip.
+func (c *Client) listBlocks(ctx context.Context, offset, limit int) ([]BlockInfo, error) {
+	q := url.Values{}
+	q.Set("offset", strconv.Itoa(offset))
+	q.Set("limit", strconv.Itoa(limit))
+	body, err := c.get(ctx, c.urls("/api/v1/blocks?"+q.Encode()))
+	if errors.Is(err, errNotFound) {
+		return nil, fmt.Errorf("list blocks: %w", ErrBlockNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list blocks: %w", err)
+	}
+	var page struct {
+		Data []BlockInfo `json:"data"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("decode block list: %w", err)
+	}
+	return page.Data, nil
+}
+
+// SubtreeURL returns the URL of a subtree on the preferred server, for
+// ProcessSubtree.
+func (c *Client) SubtreeURL(subtreeHashHex string) string {
+	return c.urls("/api/v1/subtree/" + subtreeHashHex)[0]
+}
+
+// parseBlock decodes Teranode's binary block format:
+// 80b header | varint txCount | varint size | varint n | n * 32b subtree | coinbase tx | varint height
+func parseBlock(data []byte) (*Block, error) {
+	if len(data) < 80 {
+		return nil, fmt.Errorf("block too short: %d bytes", len(data))
+	}
+	b := &Block{Header: data[:80]}
+	r := bytes.NewReader(data[80:])
+
+	readVarInt := func(field string) (uint64, error) {
+		var v util.VarInt
+		if _, err := v.ReadFrom(r); err != nil {
+			return 0, fmt.Errorf("read %s: %w", field, err)
+		}
+		return uint64(v), nil
+	}
+
+	var err error
+	if b.TxCount, err = readVarInt("tx count"); err != nil {
+		return nil, err
+	}
+	if b.SizeInBytes, err = readVarInt("size"); err != nil {
+		return nil, err
+	}
+	n, err := readVarInt("subtree count")
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len())/32 {
+		return nil, fmt.Errorf("subtree count %d exceeds block data", n)
+	}
+	b.Subtrees = make([][]byte, n)
+	for i := range b.Subtrees {
+		b.Subtrees[i] = make([]byte, 32)
+		if _, err := io.ReadFull(r, b.Subtrees[i]); err != nil {
+			return nil, fmt.Errorf("read subtree %d: %w", i, err)
+		}
+	}
+
+	start := len(data) - r.Len()
+	var tx transaction.Transaction
+	if _, err := tx.ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("read coinbase: %w", err)
+	}
+	b.CoinbaseTx = data[start : len(data)-r.Len()]
+
+	height, err := readVarInt("height")
+	if err != nil {
+		return nil, err
+	}
+	b.Height = uint32(height)
+	return b, nil
+}
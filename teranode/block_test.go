@@ -0,0 +1,111 @@
+package teranode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/util"
+)
+
+func TestFetchBlock(t *testing.T) {
+	header := bytes.Repeat([]byte{0x22}, 80)
+	subtrees := [][]byte{bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 32)}
+	coinbase := testTx(t, 5000).Bytes()
+
+	var data []byte
+	data = append(data, header...)
+	data = append(data, util.VarInt(3000).Bytes()...)
+	data = append(data, util.VarInt(1_500_000).Bytes()...)
+	data = append(data, util.VarInt(len(subtrees)).Bytes()...)
+	for _, st := range subtrees {
+		data = append(data, st...)
+	}
+	data = append(data, coinbase...)
+	data = append(data, util.VarInt(840_000).Bytes()...)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/block/aa":
+			w.Write(data)
+		case "/api/v1/block/bb":
+			w.Write(data[:len(data)-1])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	b, err := c.FetchBlock(context.Background(), "aa")
+	if err != nil {
+		t.Fatalf("FetchBlock: %v", err)
+	}
+	if !bytes.Equal(b.Header, header) || b.TxCount != 3000 || b.SizeInBytes != 1_500_000 || b.Height != 840_000 {
+		t.Errorf("block fields: %+v", b)
+	}
+	if len(b.Subtrees) != 2 || !bytes.Equal(b.Subtrees[1], subtrees[1]) {
+		t.Errorf("subtrees: %x", b.Subtrees)
+	}
+	if !bytes.Equal(b.CoinbaseTx, coinbase) {
+		t.Errorf("coinbase: got %x, want %x", b.CoinbaseTx, coinbase)
+	}
+
+	if _, err := c.FetchBlock(context.Background(), "bb"); err == nil {
+		t.Error("expected error for truncated block")
+	}
+	if _, err := c.FetchBlock(context.Background(), "cc"); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("missing block: got %v, want ErrBlockNotFound", err)
+	}
+}
+
+func TestFetchBlockInfos(t *testing.T) {
+	const tip = 1000
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/blocks" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests++
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if limit > maxBlockPage {
+			t.Errorf("limit %d exceeds page size", limit)
+		}
+		var page struct {
+			Data []BlockInfo `json:"data"`
+		}
+		for h := tip - offset; h > tip-offset-limit && h >= 0; h-- {
+			page.Data = append(page.Data, BlockInfo{Height: uint32(h), Hash: strconv.Itoa(h)})
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	infos, err := c.FetchBlockInfos(context.Background(), 750, 960)
+	if err != nil {
+		t.Fatalf("FetchBlockInfos: %v", err)
+	}
+	if len(infos) != 211 {
+		t.Fatalf("got %d blocks, want 211", len(infos))
+	}
+	for i, info := range infos {
+		if info.Height != uint32(750+i) || info.Hash != strconv.Itoa(750+i) {
+			t.Fatalf("block %d: %+v", i, info)
+		}
+	}
+	if requests != 4 {
+		t.Errorf("made %d requests, want the tip and three pages", requests)
+	}
+
+	if _, err := c.FetchBlockInfos(context.Background(), 990, 1010); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("heights above tip: got %v, want ErrBlockNotFound", err)
+	}
+}
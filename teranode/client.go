@@ -1,61 +1,167 @@
 package teranode
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/transaction"
 )
 
 type Client struct {
-	baseURL    string
+	config     Config
 	httpClient *http.Client
+
+	mu       sync.Mutex
+	breakers map[string]*breaker // by endpoint host
+	next     int                 // index of the preferred base URL
 }
 
+// NewClient creates a client for a single Teranode asset server with the
+// default retry and circuit breaker settings.
 func NewClient(baseURL string) *Client {
-	return &Client{baseURL: baseURL, httpClient: &http.Client{}}
+	config := DefaultConfig()
+	config.BaseURLs = []string{baseURL}
+	return NewClientWithConfig(config)
+}
+
+// NewClientWithConfig creates a client that fails over between
+// config.BaseURLs.
+func NewClientWithConfig(config Config) *Client {
+	return &Client{
+		config:     config,
+		httpClient: &http.Client{},
+		breakers:   make(map[string]*breaker),
+	}
 }
 
+// FetchTransaction fetches a raw transaction. It returns an error wrapping
+// ErrTxNotFound if no server has it.
 func (c *Client) FetchTransaction(ctx context.Context, txidHex string) ([]byte, error) {
-	url := fmt.Sprintf("%s/api/v1/tx/%s", c.baseURL, txidHex)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	body, err := c.get(ctx, c.urls("/api/v1/tx/"+txidHex))
+	if errors.Is(err, errNotFound) {
+		return nil, fmt.Errorf("fetch tx %s: %w", txidHex, ErrTxNotFound)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("fetch tx %s: %w", txidHex, err)
 	}
-	req.Header.Set("Accept", "application/octet-stream")
+	return body, nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// FetchBlockHeader fetches the 80-byte header of a block. It returns an
+// error wrapping ErrBlockNotFound if no server has it.
+func (c *Client) FetchBlockHeader(ctx context.Context, blockHashHex string) ([]byte, error) {
+	body, err := c.get(ctx, c.urls("/api/v1/header/"+blockHashHex))
+	if errors.Is(err, errNotFound) {
+		return nil, fmt.Errorf("fetch header %s: %w", blockHashHex, ErrBlockNotFound)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("fetch header %s: %w", blockHashHex, err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("fetch tx %s: status %d", txidHex, resp.StatusCode)
+	if len(body) != 80 {
+		return nil, fmt.Errorf("fetch header %s: got %d bytes, want 80", blockHashHex, len(body))
 	}
-	return io.ReadAll(resp.Body)
+	return body, nil
 }
 
 // FetchSubtreeData retrieves raw subtree bytes from a URL.
 // The caller is responsible for parsing the bytes with go-subtree.
 func (c *Client) FetchSubtreeData(ctx context.Context, url string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	body, err := c.get(ctx, []string{url})
+	if errors.Is(err, errNotFound) {
+		return nil, fmt.Errorf("fetch subtree: %w", ErrSubtreeNotFound)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("fetch subtree: %w", err)
 	}
+	return body, nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// FetchTransactions fetches many transactions in one request through the
+// batch endpoint of the subtree containing them. Raw transactions, possibly in
+// extended format, are returned in the order of txids.
+func (c *Client) FetchTransactions(ctx context.Context, subtreeHashHex string, txids [][32]byte) ([][]byte, error) {
+	body := make([]byte, 0, 32*len(txids))
+	for _, txid := range txids {
+		body = append(body, txid[:]...)
+	}
+
+	// The response is not in request order, so match transactions by txid.
+	var byTxID map[[32]byte][]byte
+	err := c.do(ctx, "POST", c.urls("/api/v1/subtree/"+subtreeHashHex+"/txs"), body, true, func(r io.Reader) error {
+		byTxID = make(map[[32]byte][]byte, len(txids))
+		return readTransactions(r, func(txid chainhash.Hash, rawTx []byte) error {
+			byTxID[txid] = rawTx
+			return nil
+		})
+	})
+	if errors.Is(err, errNotFound) {
+		return nil, fmt.Errorf("fetch txs from subtree %s: %w", subtreeHashHex, ErrTxNotFound)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("fetch txs from subtree %s: %w", subtreeHashHex, err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("fetch subtree: status %d", resp.StatusCode)
+	txs := make([][]byte, len(txids))
+	for i, txid := range txids {
+		raw, ok := byTxID[txid]
+		if !ok {
+			return nil, fmt.Errorf("fetch txs from subtree %s: tx %s: %w", subtreeHashHex, TxIDToHex(txid[:]), ErrTxNotFound)
+		}
+		txs[i] = raw
 	}
+	return txs, nil
+}
 
-	return io.ReadAll(resp.Body)
+// FetchSubtreeTransactions streams every transaction stored for a subtree, in
+// subtree order, calling fn with each txid and raw transaction as it is read.
+// An error from fn stops the stream and is returned. Only failures before the
+// first transaction is read are retried.
+func (c *Client) FetchSubtreeTransactions(ctx context.Context, subtreeHashHex string, fn func(txid chainhash.Hash, rawTx []byte) error) error {
+	err := c.do(ctx, "GET", c.urls("/api/v1/subtree_data/"+subtreeHashHex), nil, false, func(r io.Reader) error {
+		return readTransactions(r, fn)
+	})
+	if errors.Is(err, errNotFound) {
+		return fmt.Errorf("fetch subtree data %s: %w", subtreeHashHex, ErrSubtreeNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("fetch subtree data %s: %w", subtreeHashHex, err)
+	}
+	return nil
+}
+
+// readTransactions parses concatenated raw or extended-format transactions
+// from r, passing each one's txid and bytes to fn.
+func readTransactions(r io.Reader, fn func(txid chainhash.Hash, rawTx []byte) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var buf bytes.Buffer
+	for n := 0; ; n++ {
+		if _, err := br.Peek(1); err == io.EOF {
+			return nil
+		}
+
+		buf.Reset()
+		var tx transaction.Transaction
+		if _, err := tx.ReadFrom(io.TeeReader(br, &buf)); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("parse tx %d: %w", n, err)
+		}
+
+		rawTx := make([]byte, buf.Len())
+		copy(rawTx, buf.Bytes())
+		if err := fn(*tx.TxID(), rawTx); err != nil {
+			return err
+		}
+	}
 }
 
 // TxIDToHex converts a 32-byte txid to hex string (reversed, Bitcoin byte-order convention).
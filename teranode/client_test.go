@@ -1,11 +1,18 @@
 package teranode
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
 )
 
 func TestFetchTransaction_Success(t *testing.T) {
@@ -91,3 +98,127 @@ func TestTxIDToHex(t *testing.T) {
 		t.Fatalf("expected %s, got %s", expected, got)
 	}
 }
+
+// testTx builds a one-input, one-output transaction distinguished by sats,
+// with its source output set so it can be serialized in extended format.
+func testTx(t *testing.T, sats uint64) *transaction.Transaction {
+	t.Helper()
+	tx := transaction.NewTransaction()
+	unlocking := script.Script{script.OpTRUE}
+	input := &transaction.TransactionInput{
+		SourceTXID:      &chainhash.Hash{0xaa},
+		UnlockingScript: &unlocking,
+		SequenceNumber:  0xffffffff,
+	}
+	input.SetSourceTxOutput(&transaction.TransactionOutput{Satoshis: 1000, LockingScript: &script.Script{script.OpTRUE}})
+	tx.AddInput(input)
+	tx.AddOutput(&transaction.TransactionOutput{Satoshis: sats, LockingScript: &script.Script{script.OpTRUE}})
+	return tx
+}
+
+func TestFetchSubtreeTransactions(t *testing.T) {
+	tx1, tx2 := testTx(t, 1), testTx(t, 2)
+	ef2, err := tx2.EF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := append(tx1.Bytes(), ef2...)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/subtree_data/ab12" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	var txids []chainhash.Hash
+	var raws [][]byte
+	err = NewClient(srv.URL).FetchSubtreeTransactions(context.Background(), "ab12", func(txid chainhash.Hash, rawTx []byte) error {
+		txids = append(txids, txid)
+		raws = append(raws, rawTx)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(txids) != 2 || txids[0] != *tx1.TxID() || txids[1] != *tx2.TxID() {
+		t.Fatalf("unexpected txids: %v", txids)
+	}
+	if !bytes.Equal(raws[0], tx1.Bytes()) || !bytes.Equal(raws[1], ef2) {
+		t.Error("raw bytes not passed through as received")
+	}
+}
+
+func TestFetchSubtreeTransactions_Truncated(t *testing.T) {
+	raw := testTx(t, 1).Bytes()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(append(raw, raw[:10]...))
+	}))
+	defer srv.Close()
+
+	n := 0
+	err := NewClient(srv.URL).FetchSubtreeTransactions(context.Background(), "ab12", func(chainhash.Hash, []byte) error {
+		n++
+		return nil
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) || n != 1 {
+		t.Fatalf("expected unexpected EOF after 1 tx, got %v after %d", err, n)
+	}
+}
+
+func TestFetchTransactions(t *testing.T) {
+	tx1, tx2, tx3 := testTx(t, 1), testTx(t, 2), testTx(t, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/subtree/ab12/txs" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		req, _ := io.ReadAll(r.Body)
+		if len(req) != 64 {
+			t.Errorf("expected 2 txids in request body, got %d bytes", len(req))
+		}
+		// Responses are not in request order
+		w.Write(append(tx2.Bytes(), tx1.Bytes()...))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	got, err := c.FetchTransactions(context.Background(), "ab12", [][32]byte{*tx1.TxID(), *tx2.TxID()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || !bytes.Equal(got[0], tx1.Bytes()) || !bytes.Equal(got[1], tx2.Bytes()) {
+		t.Fatal("transactions not returned in request order")
+	}
+
+	if _, err := c.FetchTransactions(context.Background(), "ab12", [][32]byte{*tx1.TxID(), *tx3.TxID()}); err == nil {
+		t.Fatal("expected error for transaction missing from response")
+	}
+}
+
+func TestFetchBlockHeader(t *testing.T) {
+	header := bytes.Repeat([]byte{0x11}, 80)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/header/aa":
+			w.Write(header)
+		case "/api/v1/header/bb":
+			w.Write(header[:40])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	got, err := c.FetchBlockHeader(context.Background(), "aa")
+	if err != nil || !bytes.Equal(got, header) {
+		t.Fatalf("FetchBlockHeader: %x, %v", got, err)
+	}
+	if _, err := c.FetchBlockHeader(context.Background(), "bb"); err == nil {
+		t.Error("expected error for short header")
+	}
+	if _, err := c.FetchBlockHeader(context.Background(), "cc"); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("missing header: got %v, want ErrBlockNotFound", err)
+	}
+}
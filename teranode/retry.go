@@ -0,0 +1,295 @@
+package teranode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTxNotFound is returned when Teranode does not have a transaction.
+	ErrTxNotFound = errors.New("transaction not found")
+	// ErrSubtreeNotFound is returned when Teranode does not have a subtree.
+	ErrSubtreeNotFound = errors.New("subtree not found")
+	// ErrBlockNotFound is returned when Teranode does not have a block.
+	ErrBlockNotFound = errors.New("block not found")
+	// ErrUnavailable is returned when a request still fails after all retries.
+	ErrUnavailable = errors.New("teranode unavailable")
+	// ErrCircuitOpen is returned, wrapped in ErrUnavailable, when every
+	// endpoint's circuit breaker is open.
+	ErrCircuitOpen = errors.New("circuit breaker open")
+
+	errNotFound = errors.New("not found")
+)
+
+// StatusError is a non-200 response that was not retried or was the last
+// failure before giving up.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d", e.StatusCode)
+}
+
+// Config controls retries, failover and circuit breaking.
+type Config struct {
+	// BaseURLs are asset server base URLs, tried in order and failed over
+	// between on errors.
+	BaseURLs []string
+	// MaxRetries is how many times a failed request is retried. A 404 is
+	// not retried, but asked of the other base URLs in turn.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry; it doubles with
+	// each retry up to MaxBackoff, with jitter.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// BreakerThreshold is the number of consecutive failures after which an
+	// endpoint is skipped for BreakerCooldown. 0 disables circuit breaking.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxRetries:       5,
+		InitialBackoff:   100 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// breaker tracks consecutive failures of one endpoint. Once open it lets a
+// single trial request through after the cooldown.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// urls returns path on each base URL, starting with the preferred one.
+func (c *Client) urls(path string) []string {
+	c.mu.Lock()
+	next := c.next
+	c.mu.Unlock()
+
+	n := len(c.config.BaseURLs)
+	out := make([]string, n)
+	for i := range out {
+		out[i] = c.config.BaseURLs[(next+i)%n] + path
+	}
+	return out
+}
+
+// get fetches the full response body from the first of urls that serves it.
+func (c *Client) get(ctx context.Context, urls []string) ([]byte, error) {
+	var body []byte
+	err := c.do(ctx, "GET", urls, nil, true, func(r io.Reader) error {
+		var err error
+		body, err = io.ReadAll(r)
+		return err
+	})
+	return body, err
+}
+
+// do sends the request to urls in turn, retrying with backoff, until one
+// responds 200, then passes the body to read. Errors from read are retried
+// only if retryRead is set. A 404 moves on to the next URL straight away,
+// and errNotFound is returned once every URL has responded 404.
+func (c *Client) do(ctx context.Context, method string, urls []string, reqBody []byte, retryRead bool, read func(io.Reader) error) error {
+	if len(urls) == 0 {
+		return fmt.Errorf("no teranode base URLs configured")
+	}
+
+	var lastErr error
+	missing := make(map[string]bool)
+	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				return err
+			}
+		}
+
+		for {
+			u, ok := c.pick(urls, attempt, missing)
+			if !ok {
+				lastErr = ErrCircuitOpen
+				break
+			}
+
+			retry, err := c.try(ctx, method, u, reqBody, retryRead, read)
+			if errors.Is(err, errNotFound) {
+				missing[u] = true
+				if allMissing(urls, missing) {
+					return errNotFound
+				}
+				continue
+			}
+			if err == nil || !retry {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lastErr = err
+			break
+		}
+	}
+	return fmt.Errorf("%w after %d attempts: %w", ErrUnavailable, c.config.MaxRetries+1, lastErr)
+}
+
+func allMissing(urls []string, missing map[string]bool) bool {
+	for _, u := range urls {
+		if !missing[u] {
+			return false
+		}
+	}
+	return true
+}
+
+// try makes one request and reports whether a failure is worth retrying.
+func (c *Client) try(ctx context.Context, method, u string, reqBody []byte, retryRead bool, read func(io.Reader) error) (bool, error) {
+	var body io.Reader
+	if reqBody != nil {
+		body = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.record(u, false)
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusNotFound:
+		c.record(u, true)
+		return false, errNotFound
+	case retryableStatus(resp.StatusCode):
+		c.record(u, false)
+		return true, &StatusError{StatusCode: resp.StatusCode}
+	default:
+		c.record(u, true)
+		return false, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	if err := read(resp.Body); err != nil {
+		if retryRead {
+			c.record(u, false)
+		}
+		return retryRead, err
+	}
+	c.record(u, true)
+	return false, nil
+}
+
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+}
+
+// pick returns the first of urls not in skip whose breaker is closed,
+// rotating by attempt so retries fail over to the next endpoint.
+func (c *Client) pick(urls []string, attempt int, skip map[string]bool) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for i := range urls {
+		u := urls[(attempt+i)%len(urls)]
+		if skip[u] {
+			continue
+		}
+		b := c.breakers[endpoint(u)]
+		if b == nil || !now.Before(b.openUntil) {
+			if b != nil && !b.openUntil.IsZero() {
+				// Half open: let this request through and hold the rest
+				// back until it reports.
+				b.openUntil = now.Add(c.config.BreakerCooldown)
+			}
+			return u, true
+		}
+	}
+	return "", false
+}
+
+// record updates the endpoint's breaker and, on failure, makes the next base
+// URL preferred.
+func (c *Client) record(u string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := endpoint(u)
+	b := c.breakers[key]
+	if b == nil {
+		b = &breaker{}
+		c.breakers[key] = b
+	}
+	if ok {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+
+	b.failures++
+	if c.config.BreakerThreshold > 0 && b.failures >= c.config.BreakerThreshold {
+		b.openUntil = time.Now().Add(c.config.BreakerCooldown)
+	}
+	for i, base := range c.config.BaseURLs {
+		if strings.HasPrefix(u, base) && i == c.next {
+			c.next = (i + 1) % len(c.config.BaseURLs)
+			break
+		}
+	}
+}
+
+// backoff returns the delay before a retry: exponential with jitter in the
+// upper half of the interval.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.config.InitialBackoff << (attempt - 1)
+	if d <= 0 || (c.config.MaxBackoff > 0 && d > c.config.MaxBackoff) {
+		d = c.config.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// endpoint identifies the server a URL points at, for circuit breaking.
+func endpoint(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
@@ -0,0 +1,163 @@
+package teranode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig(urls ...string) Config {
+	return Config{
+		BaseURLs:         urls,
+		MaxRetries:       3,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       5 * time.Millisecond,
+		BreakerThreshold: 10,
+		BreakerCooldown:  time.Hour,
+	}
+}
+
+// statusServer responds with statuses in turn, then 200 with "ok".
+func statusServer(t *testing.T, hits *int32, statuses ...int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(hits, 1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRetryTransientStatus(t *testing.T) {
+	var hits int32
+	srv := statusServer(t, &hits, http.StatusServiceUnavailable, http.StatusBadGateway)
+
+	got, err := NewClientWithConfig(testConfig(srv.URL)).FetchTransaction(context.Background(), "ab")
+	if err != nil || string(got) != "ok" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if hits != 3 {
+		t.Errorf("expected 3 requests, got %d", hits)
+	}
+}
+
+func TestNotFoundNotRetried(t *testing.T) {
+	var hits int32
+	srv := statusServer(t, &hits, http.StatusNotFound, http.StatusNotFound)
+
+	_, err := NewClientWithConfig(testConfig(srv.URL)).FetchTransaction(context.Background(), "ab")
+	if !errors.Is(err, ErrTxNotFound) {
+		t.Fatalf("expected ErrTxNotFound, got %v", err)
+	}
+	if hits != 1 {
+		t.Errorf("expected 1 request, got %d", hits)
+	}
+}
+
+func TestNotFoundFailsOver(t *testing.T) {
+	var missHits, okHits, goneHits int32
+	miss := statusServer(t, &missHits, http.StatusNotFound)
+	ok := statusServer(t, &okHits)
+
+	got, err := NewClientWithConfig(testConfig(miss.URL, ok.URL)).FetchTransaction(context.Background(), "ab")
+	if err != nil || string(got) != "ok" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if missHits != 1 || okHits != 1 {
+		t.Errorf("expected 1 request to each server, got %d and %d", missHits, okHits)
+	}
+
+	// Only once every server has responded 404 is the tx not found
+	missHits = 0
+	gone := statusServer(t, &goneHits, http.StatusNotFound)
+	_, err = NewClientWithConfig(testConfig(miss.URL, gone.URL)).FetchTransaction(context.Background(), "ab")
+	if !errors.Is(err, ErrTxNotFound) {
+		t.Fatalf("expected ErrTxNotFound, got %v", err)
+	}
+	if missHits != 1 || goneHits != 1 {
+		t.Errorf("expected 1 request to each server, got %d and %d", missHits, goneHits)
+	}
+}
+
+func TestClientErrorNotRetried(t *testing.T) {
+	var hits int32
+	srv := statusServer(t, &hits, http.StatusBadRequest, http.StatusBadRequest)
+
+	_, err := NewClientWithConfig(testConfig(srv.URL)).FetchSubtreeData(context.Background(), srv.URL+"/subtree/ab")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400 error, got %v", err)
+	}
+	if hits != 1 {
+		t.Errorf("expected 1 request, got %d", hits)
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	var hits int32
+	srv := statusServer(t, &hits, 500, 500, 500, 500, 500)
+
+	_, err := NewClientWithConfig(testConfig(srv.URL)).FetchTransaction(context.Background(), "ab")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if hits != 4 {
+		t.Errorf("expected 4 requests, got %d", hits)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	var downHits, upHits int32
+	down := statusServer(t, &downHits, 500, 500, 500, 500, 500)
+	up := statusServer(t, &upHits)
+
+	c := NewClientWithConfig(testConfig(down.URL, up.URL))
+	for i := 0; i < 2; i++ {
+		if _, err := c.FetchTransaction(context.Background(), "ab"); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	// The second request goes straight to the healthy server
+	if downHits != 1 || upHits != 2 {
+		t.Errorf("requests: down %d, up %d", downHits, upHits)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits int32
+	srv := statusServer(t, &hits, 500, 500, 500, 500, 500, 500)
+
+	config := testConfig(srv.URL)
+	config.BreakerThreshold = 2
+	c := NewClientWithConfig(config)
+
+	_, err := c.FetchTransaction(context.Background(), "ab")
+	if !errors.Is(err, ErrUnavailable) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if hits != 2 {
+		t.Fatalf("expected breaker to stop requests after 2 failures, got %d", hits)
+	}
+
+	if _, err := c.FetchTransaction(context.Background(), "ab"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if hits != 2 {
+		t.Errorf("expected no requests while open, got %d", hits)
+	}
+
+	// After the cooldown a trial request is let through
+	c.breakers[endpoint(srv.URL)].openUntil = time.Now()
+	atomic.StoreInt32(&hits, 100)
+	if _, err := c.FetchTransaction(context.Background(), "ab"); err != nil {
+		t.Fatalf("expected half-open request to succeed, got %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/bsv-blockchain/go-sdk/block"
 	"github.com/bsv-blockchain/go-sdk/chainhash"
 	"github.com/bsv-blockchain/go-sdk/script"
 	"github.com/bsv-blockchain/go-sdk/transaction"
@@ -141,6 +143,20 @@ func TestIntegration(t *testing.T) {
 	txHashes := [][32]byte{*txid1, *txid2, *txid3}
 	subtreeBytes := buildSubtreeData(txHashes)
 
+	// The block's first subtree starts with the coinbase placeholder
+	tx4 := buildP2PKHTx(t, []string{addr3}, dummyPrevTxID, 3)
+	txid4 := tx4.TxID()
+	txMap[reverseTxID(txid4[:])] = tx4.Bytes()
+
+	var placeholder [32]byte
+	for i := range placeholder {
+		placeholder[i] = 0xFF
+	}
+	coinbaseSubtreeBytes := buildSubtreeData([][32]byte{placeholder, *txid4})
+	for i := 0; i < 32; i++ {
+		coinbaseSubtreeBytes[i] = 0xCC
+	}
+
 	// --- Mock Teranode HTTP server ---
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/subtree" {
@@ -148,6 +164,11 @@ func TestIntegration(t *testing.T) {
 			w.Write(subtreeBytes)
 			return
 		}
+		if r.URL.Path == "/coinbase-subtree" {
+			w.WriteHeader(200)
+			w.Write(coinbaseSubtreeBytes)
+			return
+		}
 
 		if strings.HasPrefix(r.URL.Path, "/api/v1/tx/") {
 			txidHex := strings.TrimPrefix(r.URL.Path, "/api/v1/tx/")
@@ -193,6 +214,7 @@ func TestIntegration(t *testing.T) {
 		client,
 		builder,
 		metaStore,
+		processor.Config{PowLimit: 0x207fffff},
 		logger,
 	)
 
@@ -379,16 +401,35 @@ func TestIntegration(t *testing.T) {
 	}
 
 	// --- Process block referencing the subtree ---
-	fakeHeader := make([]byte, 80)
-	for i := range fakeHeader {
-		fakeHeader[i] = byte(i % 256)
+	if err := proc.ProcessSubtree(ctx, "coinbasesubtree", mockServer.URL+"/coinbase-subtree"); err != nil {
+		t.Fatalf("ProcessSubtree (coinbase) failed: %v", err)
+	}
+	coinbaseSubtreeRoot := coinbaseSubtreeBytes[:32]
+
+	hashPair := func(left, right []byte) chainhash.Hash {
+		return chainhash.DoubleHashH(append(append([]byte{}, left...), right...))
 	}
+	coinbaseTx := buildP2PKHTx(t, []string{addr3}, make([]byte, 32), 0xFFFFFFFF).Bytes()
+	coinbaseTxID := chainhash.DoubleHashH(coinbaseTx)
+	firstRoot := hashPair(coinbaseTxID[:], txid4[:])
+	merkleRoot := hashPair(firstRoot[:], subtreeRootBytes)
+	header := &block.Header{Version: 1, MerkleRoot: merkleRoot, Timestamp: 1700000000, Bits: 0x207fffff}
+	for header.Hash()[31] >= 0x7f {
+		header.Nonce++
+	}
+	headerBytes := header.Bytes()
 
-	err = proc.ProcessBlock(ctx, 100, fakeHeader, [][]byte{subtreeRootBytes}, 3)
+	err = proc.ProcessBlock(ctx, 100, headerBytes, coinbaseTx, [][]byte{coinbaseSubtreeRoot, subtreeRootBytes}, 5)
 	if err != nil {
 		t.Fatalf("ProcessBlock failed: %v", err)
 	}
 
+	// --- A block whose merkle root does not commit to its subtrees is rejected ---
+	err = proc.ProcessBlock(ctx, 100, headerBytes, coinbaseTx, [][]byte{coinbaseSubtreeRoot}, 2)
+	if !errors.Is(err, processor.ErrInvalidBlock) {
+		t.Fatalf("expected ErrInvalidBlock, got %v", err)
+	}
+
 	// --- Verify block metadata ---
 	exists, err := metaStore.SubtreeExists(ctx, subtreeRootBytes)
 	if err != nil {
@@ -432,7 +473,7 @@ func TestIntegration(t *testing.T) {
 	// --- Test that processing a block with unknown subtree fails ---
 	unknownHash := make([]byte, 32)
 	unknownHash[0] = 0xFF
-	err = proc.ProcessBlock(ctx, 101, fakeHeader, [][]byte{unknownHash}, 1)
+	err = proc.ProcessBlock(ctx, 101, headerBytes, coinbaseTx, [][]byte{unknownHash}, 1)
 	if err == nil {
 		t.Fatal("ProcessBlock should fail with unknown subtree hash")
 	}
@@ -6,6 +6,14 @@ import (
 	"github.com/shruggr/inspiration/multihash"
 )
 
+// Config controls how subtree indexes are laid out.
+type Config struct {
+	// DigestKeys are tag keys whose values are always 32-byte digests in
+	// lowercase hex, such as script hashes. Their value nodes are keyed by
+	// the raw digests, and any other value fails the build.
+	DigestKeys []string
+}
+
 type Builder interface {
 	BuildSubtreeIndex(ctx context.Context, entries []TaggedTransaction) (multihash.IndexHash, error)
 }
@@ -20,4 +28,5 @@ type Tag struct {
 	Key   string
 	Value string
 	Vouts []uint32
+	Vins  []uint32
 }
@@ -12,11 +12,22 @@ import (
 )
 
 type implementation struct {
-	store kvstore.KVStore
+	store      kvstore.KVStore
+	digestKeys map[string]bool
 }
 
 func NewBuilder(store kvstore.KVStore) Builder {
-	return &implementation{store: store}
+	return NewBuilderWithConfig(store, Config{})
+}
+
+// NewBuilderWithConfig creates a builder that lays out config.DigestKeys as
+// fixed-key value nodes.
+func NewBuilderWithConfig(store kvstore.KVStore, config Config) Builder {
+	b := &implementation{store: store, digestKeys: make(map[string]bool, len(config.DigestKeys))}
+	for _, key := range config.DigestKeys {
+		b.digestKeys[key] = true
+	}
+	return b
 }
 
 func (b *implementation) BuildSubtreeIndex(ctx context.Context, txs []TaggedTransaction) (multihash.IndexHash, error) {
@@ -46,6 +57,7 @@ func (b *implementation) BuildSubtreeIndex(ctx context.Context, txs []TaggedTran
 				TxID:            tx.TxID[:],
 				SubtreePosition: tx.SubtreePosition,
 				Vouts:           tag.Vouts,
+				Vins:            tag.Vins,
 			})
 		}
 	}
@@ -54,16 +66,22 @@ func (b *implementation) BuildSubtreeIndex(ctx context.Context, txs []TaggedTran
 	keyToHash := make(map[string]multihash.IndexHash, len(keyMap))
 
 	for key, valueMap := range keyMap {
-		valueNode := indexnode.NewTagNode()
-		var dataSection []byte
-		dataSection = append(dataSection, 0) // padding byte
-
 		values := make([]string, 0, len(valueMap))
 		for v := range valueMap {
 			values = append(values, v)
 		}
 		sort.Strings(values)
 
+		// Digest keys get a fixed-width node keyed by the raw digest; see
+		// indexnode.ParseDigest.
+		fixed := b.digestKeys[key]
+		valueNode := indexnode.NewTagNode()
+		if fixed {
+			valueNode = indexnode.NewFixedKeyNode(indexnode.DigestKeySize)
+		}
+		var dataSection []byte
+		dataSection = append(dataSection, 0) // padding byte
+
 		for _, val := range values {
 			group := valueMap[val]
 
@@ -83,6 +101,16 @@ func (b *implementation) BuildSubtreeIndex(ctx context.Context, txs []TaggedTran
 			}
 
 			// Add entry to value node
+			if fixed {
+				digest, ok := indexnode.ParseDigest(val)
+				if !ok {
+					return nil, fmt.Errorf("tag %s: value %q is not a digest", key, val)
+				}
+				if err := valueNode.AddEntry(digest, leafHash.Bytes()[2:], 0); err != nil {
+					return nil, fmt.Errorf("add value entry: %w", err)
+				}
+				continue
+			}
 			offset := uint32(len(dataSection))
 			dataSection = appendLengthPrefixed(dataSection, val)
 			if err := valueNode.AddEntry(nil, leafHash.Bytes()[2:], offset); err != nil {
@@ -90,7 +118,9 @@ func (b *implementation) BuildSubtreeIndex(ctx context.Context, txs []TaggedTran
 			}
 		}
 
-		valueNode.SetDataSection(dataSection)
+		if !fixed {
+			valueNode.SetDataSection(dataSection)
+		}
 		if err := valueNode.Sort(); err != nil {
 			return nil, fmt.Errorf("sort value node: %w", err)
 		}
@@ -0,0 +1,209 @@
+package treereader
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shruggr/inspiration/indexnode"
+	"github.com/shruggr/inspiration/kvstore"
+	"github.com/shruggr/inspiration/multihash"
+)
+
+type implementation struct {
+	store kvstore.KVStore
+}
+
+func NewReader(store kvstore.KVStore) Reader {
+	return &implementation{store: store}
+}
+
+func (r *implementation) Lookup(ctx context.Context, root multihash.IndexHash, key, value string) ([]indexnode.LeafEntry, error) {
+	valueNode, err := r.loadValueNode(ctx, root, key)
+	if err != nil || valueNode == nil {
+		return nil, err
+	}
+
+	var leafDigest []byte
+	var ok bool
+	if valueNode.KeySize > 0 {
+		digest, isDigest := indexnode.ParseDigest(strings.ToLower(value))
+		if !isDigest {
+			return nil, nil
+		}
+		leafDigest, ok = valueNode.Find(digest)
+	} else {
+		leafDigest, ok = valueNode.FindByData([]byte(value))
+	}
+	if !ok {
+		return nil, nil
+	}
+	leafHash, err := multihash.IndexHashFromDigest(leafDigest)
+	if err != nil {
+		return nil, err
+	}
+	return r.loadLeaves(ctx, leafHash)
+}
+
+func (r *implementation) ScanPrefix(ctx context.Context, root multihash.IndexHash, key, prefix string) ([]ValueEntries, error) {
+	valueNode, err := r.loadValueNode(ctx, root, key)
+	if err != nil || valueNode == nil {
+		return nil, err
+	}
+	if valueNode.KeySize > 0 {
+		prefix = strings.ToLower(prefix)
+		return r.loadValueEntries(ctx, digestKeys(valueNode, prefix, func(v string) bool {
+			return !strings.HasPrefix(v, prefix)
+		}))
+	}
+	if prefix == "" {
+		return r.loadValueEntries(ctx, valueNode.ScanRangeKeys(nil, nil))
+	}
+	return r.loadValueEntries(ctx, valueNode.ScanPrefixKeys([]byte(prefix)))
+}
+
+func (r *implementation) ScanRange(ctx context.Context, root multihash.IndexHash, key, start, end string) ([]ValueEntries, error) {
+	valueNode, err := r.loadValueNode(ctx, root, key)
+	if err != nil || valueNode == nil {
+		return nil, err
+	}
+	if valueNode.KeySize > 0 {
+		start, end = strings.ToLower(start), strings.ToLower(end)
+		return r.loadValueEntries(ctx, digestKeys(valueNode, start, func(v string) bool {
+			return end != "" && v >= end
+		}))
+	}
+	var endKey []byte
+	if end != "" {
+		endKey = []byte(end)
+	}
+	return r.loadValueEntries(ctx, valueNode.ScanRangeKeys([]byte(start), endKey))
+}
+
+func (r *implementation) Keys(ctx context.Context, root multihash.IndexHash) ([]string, error) {
+	rootNode, err := r.loadNode(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("load root node: %w", err)
+	}
+
+	keys := make([]string, len(rootNode.Entries))
+	for i := range rootNode.Entries {
+		keys[i] = string(rootNode.EntryData(i))
+	}
+	return keys, nil
+}
+
+func (r *implementation) Walk(ctx context.Context, root multihash.IndexHash, fn WalkFunc) error {
+	rootNode, err := r.loadNode(ctx, root)
+	if err != nil {
+		return fmt.Errorf("load root node: %w", err)
+	}
+	if err := fn(root); err != nil {
+		return err
+	}
+
+	for _, keyEntry := range rootNode.Entries {
+		valueHash, err := multihash.IndexHashFromDigest(keyEntry.Value)
+		if err != nil {
+			return err
+		}
+		valueNode, err := r.loadNode(ctx, valueHash)
+		if err != nil {
+			return fmt.Errorf("load value node: %w", err)
+		}
+		if err := fn(valueHash); err != nil {
+			return err
+		}
+
+		for _, valueEntry := range valueNode.Entries {
+			leafHash, err := multihash.IndexHashFromDigest(valueEntry.Value)
+			if err != nil {
+				return err
+			}
+			if err := fn(leafHash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadValueNode returns the tag-value node for key, or nil if key is not in the tree.
+func (r *implementation) loadValueNode(ctx context.Context, root multihash.IndexHash, key string) (*indexnode.IndexNode, error) {
+	rootNode, err := r.loadNode(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("load root node: %w", err)
+	}
+
+	valueDigest, ok := rootNode.FindByData([]byte(key))
+	if !ok {
+		return nil, nil
+	}
+	valueHash, err := multihash.IndexHashFromDigest(valueDigest)
+	if err != nil {
+		return nil, err
+	}
+	valueNode, err := r.loadNode(ctx, valueHash)
+	if err != nil {
+		return nil, fmt.Errorf("load value node for %q: %w", key, err)
+	}
+	return valueNode, nil
+}
+
+// digestKeys scans a fixed-key value node, whose keys are raw digests, from
+// the first value >= from until stop, returning values in lowercase hex,
+// which sorts the same as the digest bytes. Callers lowercase their bounds.
+func digestKeys(node *indexnode.IndexNode, from string, stop func(value string) bool) []indexnode.KeyValue {
+	i := sort.Search(len(node.Entries), func(i int) bool {
+		return hex.EncodeToString(node.Entries[i].Key) >= from
+	})
+	var results []indexnode.KeyValue
+	for ; i < len(node.Entries); i++ {
+		v := hex.EncodeToString(node.Entries[i].Key)
+		if stop(v) {
+			break
+		}
+		results = append(results, indexnode.KeyValue{Key: []byte(v), Value: node.Entries[i].Value})
+	}
+	return results
+}
+
+func (r *implementation) loadValueEntries(ctx context.Context, matches []indexnode.KeyValue) ([]ValueEntries, error) {
+	results := make([]ValueEntries, 0, len(matches))
+	for _, m := range matches {
+		leafHash, err := multihash.IndexHashFromDigest(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := r.loadLeaves(ctx, leafHash)
+		if err != nil {
+			return nil, fmt.Errorf("load leaves for %q: %w", m.Key, err)
+		}
+		results = append(results, ValueEntries{Value: string(m.Key), Entries: entries})
+	}
+	return results, nil
+}
+
+func (r *implementation) loadNode(ctx context.Context, hash multihash.IndexHash) (*indexnode.IndexNode, error) {
+	data, err := r.store.Get(ctx, hash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("node %s %w", hash.Hex(), ErrNotFound)
+	}
+	return indexnode.Unmarshal(data)
+}
+
+func (r *implementation) loadLeaves(ctx context.Context, hash multihash.IndexHash) ([]indexnode.LeafEntry, error) {
+	data, err := r.store.Get(ctx, hash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("leaf list %s %w", hash.Hex(), ErrNotFound)
+	}
+	return indexnode.UnmarshalLeafEntryList(data)
+}
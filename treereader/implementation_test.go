@@ -0,0 +1,260 @@
+package treereader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shruggr/inspiration/indexnode"
+	"github.com/shruggr/inspiration/kvstore/memory"
+	"github.com/shruggr/inspiration/multihash"
+	"github.com/shruggr/inspiration/treebuilder"
+)
+
+const (
+	addr1 = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	addr2 = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+)
+
+func buildTestTree(t *testing.T) (*memory.Store, multihash.IndexHash) {
+	t.Helper()
+	store := memory.New()
+	builder := treebuilder.NewBuilder(store)
+
+	txs := []treebuilder.TaggedTransaction{
+		{
+			TxID:            [32]byte{1},
+			SubtreePosition: 0,
+			Tags: []treebuilder.Tag{
+				{Key: "address", Value: addr1, Vouts: []uint32{0}},
+				{Key: "output_type", Value: "p2pkh", Vouts: []uint32{0}},
+			},
+		},
+		{
+			TxID:            [32]byte{2},
+			SubtreePosition: 1,
+			Tags: []treebuilder.Tag{
+				{Key: "address", Value: addr1, Vouts: []uint32{0, 2}},
+				{Key: "address", Value: addr2, Vouts: []uint32{1}},
+			},
+		},
+	}
+
+	root, err := builder.BuildSubtreeIndex(context.Background(), txs)
+	if err != nil {
+		t.Fatalf("BuildSubtreeIndex: %v", err)
+	}
+	return store, root
+}
+
+func TestLookup(t *testing.T) {
+	store, root := buildTestTree(t)
+	reader := NewReader(store)
+
+	entries, err := reader.Lookup(context.Background(), root, "address", addr1)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries: got %d, want 2", len(entries))
+	}
+	if entries[0].SubtreePosition != 0 || entries[1].SubtreePosition != 1 {
+		t.Errorf("positions: got %d,%d, want 0,1", entries[0].SubtreePosition, entries[1].SubtreePosition)
+	}
+	wantTxID := [32]byte{2}
+	if !bytes.Equal(entries[1].TxID, wantTxID[:]) {
+		t.Errorf("second txid: got %x", entries[1].TxID)
+	}
+	if len(entries[1].Vouts) != 2 || entries[1].Vouts[0] != 0 || entries[1].Vouts[1] != 2 {
+		t.Errorf("second vouts: got %v, want [0 2]", entries[1].Vouts)
+	}
+}
+
+func TestLookupMissing(t *testing.T) {
+	store, root := buildTestTree(t)
+	reader := NewReader(store)
+	ctx := context.Background()
+
+	entries, err := reader.Lookup(ctx, root, "address", "1NotIndexed")
+	if err != nil {
+		t.Fatalf("Lookup missing value: %v", err)
+	}
+	if entries != nil {
+		t.Errorf("expected nil for missing value, got %v", entries)
+	}
+
+	entries, err = reader.Lookup(ctx, root, "protocol", "MAP")
+	if err != nil {
+		t.Fatalf("Lookup missing key: %v", err)
+	}
+	if entries != nil {
+		t.Errorf("expected nil for missing key, got %v", entries)
+	}
+}
+
+func TestLookupMissingRoot(t *testing.T) {
+	reader := NewReader(memory.New())
+	root, _ := multihash.NewIndexHash([]byte("no such node"))
+
+	if _, err := reader.Lookup(context.Background(), root, "address", addr1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing root node, got %v", err)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	store, root := buildTestTree(t)
+	reader := NewReader(store)
+
+	keys, err := reader.Keys(context.Background(), root)
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "address" || keys[1] != "output_type" {
+		t.Errorf("keys: got %v, want [address output_type]", keys)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	store, root := buildTestTree(t)
+	reader := NewReader(store)
+	ctx := context.Background()
+
+	// root + 2 value nodes + 3 leaf lists (addr1, addr2, p2pkh)
+	var visited []multihash.IndexHash
+	err := reader.Walk(ctx, root, func(key multihash.IndexHash) error {
+		visited = append(visited, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if len(visited) != 6 {
+		t.Fatalf("visited: got %d nodes, want 6", len(visited))
+	}
+	if !bytes.Equal(visited[0], root) {
+		t.Error("expected walk to start at root")
+	}
+	for _, key := range visited {
+		ok, err := store.Has(ctx, key)
+		if err != nil || !ok {
+			t.Errorf("visited key %s not in store", key.Hex())
+		}
+	}
+}
+
+func TestScanPrefix(t *testing.T) {
+	store, root := buildTestTree(t)
+	reader := NewReader(store)
+	ctx := context.Background()
+
+	results, err := reader.ScanPrefix(ctx, root, "address", "1")
+	if err != nil {
+		t.Fatalf("ScanPrefix: %v", err)
+	}
+	if len(results) != 2 || results[0].Value != addr1 || results[1].Value != addr2 {
+		t.Fatalf("ScanPrefix('1'): got %v", results)
+	}
+	if len(results[0].Entries) != 2 || len(results[1].Entries) != 1 {
+		t.Errorf("entry counts: got %d,%d, want 2,1", len(results[0].Entries), len(results[1].Entries))
+	}
+
+	results, err = reader.ScanPrefix(ctx, root, "address", "1B")
+	if err != nil {
+		t.Fatalf("ScanPrefix: %v", err)
+	}
+	if len(results) != 1 || results[0].Value != addr2 {
+		t.Fatalf("ScanPrefix('1B'): got %v", results)
+	}
+
+	results, err = reader.ScanPrefix(ctx, root, "protocol", "M")
+	if err != nil || results != nil {
+		t.Fatalf("ScanPrefix on missing key: got %v, %v", results, err)
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	store, root := buildTestTree(t)
+	reader := NewReader(store)
+	ctx := context.Background()
+
+	results, err := reader.ScanRange(ctx, root, "address", "1A", "1B")
+	if err != nil {
+		t.Fatalf("ScanRange: %v", err)
+	}
+	if len(results) != 1 || results[0].Value != addr1 {
+		t.Fatalf("ScanRange('1A','1B'): got %v", results)
+	}
+
+	// Empty end is unbounded
+	results, err = reader.ScanRange(ctx, root, "address", "1B", "")
+	if err != nil {
+		t.Fatalf("ScanRange: %v", err)
+	}
+	if len(results) != 1 || results[0].Value != addr2 {
+		t.Fatalf("ScanRange('1B',''): got %v", results)
+	}
+}
+
+func TestDigestValues(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+	hash1 := "1a" + strings.Repeat("00", 31)
+	hash2 := "1f" + strings.Repeat("ab", 31)
+	hash3 := "a0" + strings.Repeat("cd", 31)
+
+	var txs []treebuilder.TaggedTransaction
+	for i, h := range []string{hash3, hash1, hash2, hash1} {
+		txs = append(txs, treebuilder.TaggedTransaction{
+			TxID:            [32]byte{byte(i + 1)},
+			SubtreePosition: uint64(i),
+			Tags:            []treebuilder.Tag{{Key: "scripthash", Value: h, Vouts: []uint32{0}}},
+		})
+	}
+	builder := treebuilder.NewBuilderWithConfig(store, treebuilder.Config{DigestKeys: []string{"scripthash"}})
+	root, err := builder.BuildSubtreeIndex(ctx, txs)
+	if err != nil {
+		t.Fatalf("BuildSubtreeIndex: %v", err)
+	}
+	reader := NewReader(store).(*implementation)
+	valueNode, err := reader.loadValueNode(ctx, root, "scripthash")
+	if err != nil || valueNode.KeySize != indexnode.DigestKeySize {
+		t.Fatalf("expected a fixed-key value node, got %+v, %v", valueNode, err)
+	}
+
+	entries, err := reader.Lookup(ctx, root, "scripthash", hash1)
+	if err != nil || len(entries) != 2 || entries[1].SubtreePosition != 3 {
+		t.Fatalf("Lookup: got %v, %v", entries, err)
+	}
+	if entries, _ := reader.Lookup(ctx, root, "scripthash", strings.ToUpper(hash1)); len(entries) != 2 {
+		t.Errorf("uppercase lookup: got %v", entries)
+	}
+
+	results, err := reader.ScanPrefix(ctx, root, "scripthash", "1")
+	if err != nil || len(results) != 2 || results[0].Value != hash1 || results[1].Value != hash2 {
+		t.Fatalf("ScanPrefix('1'): got %v, %v", results, err)
+	}
+	results, err = reader.ScanRange(ctx, root, "scripthash", "1F", "A0")
+	if err != nil || len(results) != 1 || results[0].Value != hash2 {
+		t.Fatalf("ScanRange('1F','A0'): got %v, %v", results, err)
+	}
+
+	// An undeclared key keeps a tag node, even if every value is a digest
+	root, err = treebuilder.NewBuilder(store).BuildSubtreeIndex(ctx, txs)
+	if err != nil {
+		t.Fatalf("BuildSubtreeIndex: %v", err)
+	}
+	if valueNode, _ := reader.loadValueNode(ctx, root, "scripthash"); valueNode.KeySize != 0 {
+		t.Error("undeclared key built a fixed-key node")
+	}
+	if entries, _ := reader.Lookup(ctx, root, "scripthash", hash1); len(entries) != 2 {
+		t.Errorf("Lookup in tag node: got %v", entries)
+	}
+
+	// A declared key with any other value fails the build
+	txs[0].Tags[0].Value = "not a digest"
+	if _, err := builder.BuildSubtreeIndex(ctx, txs); err == nil {
+		t.Error("expected an error for a non-digest value")
+	}
+}
@@ -0,0 +1,43 @@
+package treereader
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shruggr/inspiration/indexnode"
+	"github.com/shruggr/inspiration/multihash"
+)
+
+// ErrNotFound is returned when a node referenced by the tree is missing from the store.
+var ErrNotFound = errors.New("not found")
+
+type Reader interface {
+	// Lookup returns the leaf entries indexed under key=value, sorted by SubtreePosition.
+	// Returns nil if the key or value is not present in the tree.
+	Lookup(ctx context.Context, root multihash.IndexHash, key, value string) ([]indexnode.LeafEntry, error)
+
+	// ScanPrefix returns every value of key that starts with prefix, with its
+	// leaf entries, in sorted value order.
+	ScanPrefix(ctx context.Context, root multihash.IndexHash, key, prefix string) ([]ValueEntries, error)
+
+	// ScanRange returns every value of key with start <= value < end, with its
+	// leaf entries, in sorted value order. An empty end is unbounded.
+	ScanRange(ctx context.Context, root multihash.IndexHash, key, start, end string) ([]ValueEntries, error)
+
+	// Keys returns the tag keys present in the tree, in sorted order.
+	Keys(ctx context.Context, root multihash.IndexHash) ([]string, error)
+
+	// Walk visits the store key of every node reachable from root: the root
+	// tag-key node, each tag-value node and each leaf entry list.
+	Walk(ctx context.Context, root multihash.IndexHash, fn WalkFunc) error
+}
+
+// ValueEntries pairs a tag value with the leaf entries indexed under it.
+type ValueEntries struct {
+	Value   string
+	Entries []indexnode.LeafEntry
+}
+
+// WalkFunc is called once per node visited by Walk.
+// Returning an error stops the walk.
+type WalkFunc func(key multihash.IndexHash) error
@@ -0,0 +1,172 @@
+package txindexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	bsm "github.com/bsv-blockchain/go-sdk/compat/bsm"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// Bitcom protocol prefixes.
+const (
+	MAPPrefix = "1PuQa7K62MiKCtssSLKy1kh56WWU7MtUR5"
+	BPrefix   = "19HxigV4QyBv3tHpQVcUEQyq1pzZVdoAut"
+	AIPPrefix = "15PciHG22SNLQJXMoSUaWVi7WSqc7hCfva"
+)
+
+const aipAlgorithm = "BITCOIN_ECDSA"
+
+var bitcomPipe = []byte("|")
+
+// BitcomConfig selects which MAP keys are indexed.
+type BitcomConfig struct {
+	// MapKeys names the MAP SET keys tagged as "map.<key>". Other keys are
+	// not indexed.
+	MapKeys []string
+	// MaxValueLen is the longest MAP value indexed as is; see tagValue.
+	MaxValueLen int
+}
+
+// DefaultBitcomConfig indexes the MAP app and type keys.
+func DefaultBitcomConfig() BitcomConfig {
+	return BitcomConfig{MapKeys: []string{"app", "type"}, MaxValueLen: 64}
+}
+
+// BitcomIndexer tags data-carrier outputs holding pipe-delimited Bitcom
+// protocol chains. MAP SET pairs for the configured keys are tagged
+// "map.<key>", B files "b.content-type", and AIP signatures "aip.address"
+// when the signature verifies against the data before it.
+type BitcomIndexer struct {
+	config  BitcomConfig
+	mapKeys map[string]bool
+}
+
+func NewBitcomIndexer(config BitcomConfig) *BitcomIndexer {
+	mapKeys := make(map[string]bool, len(config.MapKeys))
+	for _, k := range config.MapKeys {
+		mapKeys[k] = true
+	}
+	return &BitcomIndexer{config: config, mapKeys: mapKeys}
+}
+
+func (b *BitcomIndexer) Name() string { return "Bitcom" }
+
+func (b *BitcomIndexer) Index(_ context.Context, txCtx *TransactionContext) ([]*IndexResult, error) {
+	tx, err := transaction.NewTransactionFromBytes(txCtx.RawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags tagSet
+	for i, output := range tx.Outputs {
+		pushes, ok := dataPushes(*output.LockingScript)
+		if !ok {
+			continue
+		}
+		vout := uint32(i)
+		for _, seg := range bitcomSegments(pushes) {
+			fields := pushes[seg.start:seg.end]
+			switch string(fields[0]) {
+			case MAPPrefix:
+				b.indexMAP(&tags, fields[1:], vout)
+			case BPrefix:
+				if len(fields) > 2 && len(fields[2]) > 0 {
+					tags.add("b.content-type", tagValue(fields[2], maxContentTypeLen), vout)
+				}
+			case AIPPrefix:
+				if address, ok := verifyAIP(pushes, seg.start); ok {
+					tags.add("aip.address", address, vout)
+				}
+			}
+		}
+	}
+	return tags.results, nil
+}
+
+// indexMAP tags the configured keys of a MAP SET command.
+func (b *BitcomIndexer) indexMAP(tags *tagSet, fields [][]byte, vout uint32) {
+	if len(fields) == 0 || string(fields[0]) != "SET" {
+		return
+	}
+	for j := 1; j+1 < len(fields); j += 2 {
+		key := string(fields[j])
+		if b.mapKeys[key] && len(fields[j+1]) > 0 {
+			tags.add("map."+key, tagValue(fields[j+1], b.config.MaxValueLen), vout)
+		}
+	}
+}
+
+// bitcomSegment is the half-open range of pushes making up one protocol in
+// a Bitcom chain, starting with its prefix.
+type bitcomSegment struct {
+	start, end int
+}
+
+// bitcomSegments splits data-carrier pushes on "|" pushes, dropping empty
+// segments.
+func bitcomSegments(pushes [][]byte) []bitcomSegment {
+	var segs []bitcomSegment
+	start := 0
+	for i := 0; i <= len(pushes); i++ {
+		if i < len(pushes) && !bytes.Equal(pushes[i], bitcomPipe) {
+			continue
+		}
+		if i > start {
+			segs = append(segs, bitcomSegment{start, i})
+		}
+		start = i + 1
+	}
+	return segs
+}
+
+// verifyAIP checks the AIP signature whose prefix is pushes[start] and
+// returns the signing address if it verifies. The signed message is
+// OP_RETURN followed by every push before the prefix, pipes included, or
+// only the fields the signature lists by index, counting OP_RETURN as field
+// 0 and pushes from 1.
+func verifyAIP(pushes [][]byte, start int) (string, bool) {
+	fields := pushes[start+1:]
+	for i, f := range fields {
+		if bytes.Equal(f, bitcomPipe) {
+			fields = fields[:i]
+			break
+		}
+	}
+	if len(fields) < 3 || string(fields[0]) != aipAlgorithm {
+		return "", false
+	}
+	address := string(fields[1])
+	sig, err := base64.StdEncoding.DecodeString(string(fields[2]))
+	if err != nil {
+		return "", false
+	}
+
+	message := []byte{script.OpRETURN}
+	if indexes := fields[3:]; len(indexes) > 0 {
+		message = message[:0]
+		for _, idx := range indexes {
+			n, err := strconv.Atoi(string(idx))
+			if err != nil || n < 0 || n > start {
+				return "", false
+			}
+			if n == 0 {
+				message = append(message, script.OpRETURN)
+			} else {
+				message = append(message, pushes[n-1]...)
+			}
+		}
+	} else {
+		for _, p := range pushes[:start] {
+			message = append(message, p...)
+		}
+	}
+
+	if err := bsm.VerifyMessage(address, sig, message); err != nil {
+		return "", false
+	}
+	return address, true
+}
@@ -0,0 +1,108 @@
+package txindexer
+
+import (
+	"bytes"
+	"testing"
+
+	bsm "github.com/bsv-blockchain/go-sdk/compat/bsm"
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+)
+
+// signAIP appends an AIP signature by key over OP_RETURN, pushes and the
+// pipe before the AIP prefix.
+func signAIP(t *testing.T, key *ec.PrivateKey, pushes ...[]byte) [][]byte {
+	t.Helper()
+	address, err := script.NewAddressFromPublicKey(key.PubKey(), true)
+	if err != nil {
+		t.Fatalf("address: %v", err)
+	}
+	pushes = append(pushes, []byte("|"))
+	sig, err := bsm.SignMessageString(key, append([]byte{script.OpRETURN}, bytes.Join(pushes, nil)...))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return append(pushes, []byte(AIPPrefix), []byte(aipAlgorithm), []byte(address.AddressString), []byte(sig))
+}
+
+func TestBitcomMAPAndB(t *testing.T) {
+	got := indexByTag(t, NewBitcomIndexer(DefaultBitcomConfig()), buildTestP2PKHTx(t,
+		dataScript(t,
+			[]byte(BPrefix), []byte("hello"), []byte("text/markdown"), []byte("UTF-8"),
+			[]byte("|"),
+			[]byte(MAPPrefix), []byte("SET"), []byte("app"), []byte("twetch"), []byte("type"), []byte("post"), []byte("context"), []byte("tx"),
+		),
+		dataScript(t, []byte(MAPPrefix), []byte("SET"), []byte("app"), []byte("twetch"), []byte("type")),
+		dataScript(t, []byte(MAPPrefix), []byte("DEL"), []byte("type"), []byte("like")),
+	))
+	if r := got["b.content-type=text/markdown"]; r == nil || len(r.Vouts) != 1 || r.Vouts[0] != 0 {
+		t.Errorf("b.content-type: %+v", r)
+	}
+	if r := got["map.app=twetch"]; r == nil || len(r.Vouts) != 2 || r.Vouts[1] != 1 {
+		t.Errorf("map.app: %+v", r)
+	}
+	if r := got["map.type=post"]; r == nil || len(r.Vouts) != 1 || r.Vouts[0] != 0 {
+		t.Errorf("map.type: %+v", r)
+	}
+	if len(got) != 3 {
+		t.Errorf("expected 3 tags, got %v", got)
+	}
+}
+
+func TestBitcomAIP(t *testing.T) {
+	key, err := ec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	address, _ := script.NewAddressFromPublicKey(key.PubKey(), true)
+	tag := "aip.address=" + address.AddressString
+	signed := signAIP(t, key, []byte(MAPPrefix), []byte("SET"), []byte("app"), []byte("test"))
+
+	got := indexByTag(t, NewBitcomIndexer(DefaultBitcomConfig()), buildTestP2PKHTx(t, dataScript(t, signed...)))
+	if r := got[tag]; r == nil || r.Vouts[0] != 0 {
+		t.Fatalf("signed: %v", got)
+	}
+
+	// Changing the signed data invalidates the signature
+	tampered := append([][]byte{}, signed...)
+	tampered[3] = []byte("other")
+	if got := indexByTag(t, NewBitcomIndexer(DefaultBitcomConfig()), buildTestP2PKHTx(t, dataScript(t, tampered...))); got[tag] != nil {
+		t.Errorf("tampered data verified: %v", got)
+	}
+
+	// As does claiming someone else's address
+	otherKey, _ := ec.NewPrivateKey()
+	forged := signAIP(t, otherKey, []byte(MAPPrefix), []byte("SET"), []byte("app"), []byte("test"))
+	forged[len(forged)-2] = []byte(address.AddressString)
+	if got := indexByTag(t, NewBitcomIndexer(DefaultBitcomConfig()), buildTestP2PKHTx(t, dataScript(t, forged...))); len(got) != 1 {
+		t.Errorf("forged address verified: %v", got)
+	}
+}
+
+func TestBitcomAIPFieldIndexes(t *testing.T) {
+	key, _ := ec.NewPrivateKey()
+	address, _ := script.NewAddressFromPublicKey(key.PubKey(), true)
+
+	// Only OP_RETURN, the MAP prefix and the app value are signed
+	pushes := [][]byte{[]byte(MAPPrefix), []byte("SET"), []byte("app"), []byte("test")}
+	sig, _ := bsm.SignMessageString(key, append([]byte{script.OpRETURN}, append(append([]byte{}, pushes[0]...), pushes[3]...)...))
+	pushes = append(pushes, []byte("|"), []byte(AIPPrefix), []byte(aipAlgorithm), []byte(address.AddressString), []byte(sig),
+		[]byte("0"), []byte("1"), []byte("4"))
+
+	got := indexByTag(t, NewBitcomIndexer(DefaultBitcomConfig()), buildTestP2PKHTx(t, dataScript(t, pushes...)))
+	if got["aip.address="+address.AddressString] == nil {
+		t.Fatalf("indexed signature: %v", got)
+	}
+
+	// Unsigned fields may change
+	pushes[2] = []byte("other")
+	if got := indexByTag(t, NewBitcomIndexer(DefaultBitcomConfig()), buildTestP2PKHTx(t, dataScript(t, pushes...))); got["aip.address="+address.AddressString] == nil {
+		t.Errorf("unsigned field change: %v", got)
+	}
+
+	// Indexes past the AIP prefix are rejected
+	pushes[len(pushes)-1] = []byte("6")
+	if got := indexByTag(t, NewBitcomIndexer(DefaultBitcomConfig()), buildTestP2PKHTx(t, dataScript(t, pushes...))); got["aip.address="+address.AddressString] != nil {
+		t.Errorf("out of range index: %v", got)
+	}
+}
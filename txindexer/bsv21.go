@@ -0,0 +1,307 @@
+package txindexer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/shruggr/inspiration/kvstore"
+)
+
+// BSV-21 operations.
+const (
+	BSV21DeployMint = "deploy+mint"
+	BSV21Transfer   = "transfer"
+	BSV21Burn       = "burn"
+)
+
+const bsv20ContentType = "application/bsv-20"
+
+// bsv21RecordPrefix namespaces token records in a store shared with spend
+// records, which are keyed by bare outpoints.
+var bsv21RecordPrefix = []byte("bsv21:")
+
+// BSV21Config controls how BSV-21 transfers are validated.
+type BSV21Config struct {
+	// InputWait bounds how long to wait for the record of an input whose
+	// source output is known to carry a token but has not been indexed
+	// yet, as when its parent is indexed concurrently. Source outputs are
+	// only known for transactions in extended format; other inputs without
+	// a record carry no tokens.
+	InputWait time.Duration
+}
+
+// DefaultBSV21Config waits up to ten seconds for a token input's record.
+func DefaultBSV21Config() BSV21Config {
+	return BSV21Config{InputWait: 10 * time.Second}
+}
+
+// BSV21Indexer tags 1-sat outputs carrying BSV-21 token inscriptions with
+// "bsv21" (the token id), "bsv21.op" and "bsv21.valid".
+//
+// Every token output's balance is recorded in store under its outpoint.
+// Transfers and burns are valid only if the inputs carry at least as much
+// of the token as the outputs claim; tokens in inputs that are not
+// transferred on are burned. Tick-based BSV-20 (v1) inscriptions are
+// ignored.
+type BSV21Indexer struct {
+	store  kvstore.KVStore
+	config BSV21Config
+}
+
+func NewBSV21Indexer(store kvstore.KVStore, config BSV21Config) *BSV21Indexer {
+	return &BSV21Indexer{store: store, config: config}
+}
+
+func (b *BSV21Indexer) Name() string { return "BSV21" }
+
+// bsv21Inscription is the JSON body of a BSV-20 inscription.
+type bsv21Inscription struct {
+	P   string `json:"p"`
+	Op  string `json:"op"`
+	ID  string `json:"id"`
+	Amt string `json:"amt"`
+	Dec string `json:"dec"`
+}
+
+// bsv21Record is the token balance of an output. Outputs whose inscription
+// was invalid are recorded too, with Valid false, and outputs whose inputs
+// could not be checked with Unknown set, so that spending them does not wait
+// for a record that will never come.
+type bsv21Record struct {
+	ID      string
+	Amount  uint64
+	Valid   bool
+	Unknown bool
+}
+
+type bsv21Output struct {
+	vout uint32
+	op   string
+	id   string
+	amt  uint64
+	ok   bool // well formed
+}
+
+func (b *BSV21Indexer) Index(ctx context.Context, txCtx *TransactionContext) ([]*IndexResult, error) {
+	tx, err := transaction.NewTransactionFromBytes(txCtx.RawTx)
+	if err != nil {
+		return nil, err
+	}
+	txid := tx.TxID()
+
+	var outputs []bsv21Output
+	for vout, output := range tx.Outputs {
+		if out, ok := parseBSV21Output(txid, uint32(vout), output); ok {
+			outputs = append(outputs, out)
+		}
+	}
+	if len(outputs) == 0 {
+		return nil, nil
+	}
+
+	// Claimed totals per token, against the balances of the inputs
+	claimed := make(map[string]uint64)
+	overflow := make(map[string]bool)
+	for _, out := range outputs {
+		if out.ok && out.op != BSV21DeployMint {
+			sum, carry := bits.Add64(claimed[out.id], out.amt, 0)
+			if carry != 0 {
+				overflow[out.id] = true
+			}
+			claimed[out.id] = sum
+		}
+	}
+	balances := make(map[string]uint64)
+	unknown := make(map[string]bool)
+	if len(claimed) > 0 {
+		for _, input := range tx.Inputs {
+			rec, err := b.inputRecord(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+			if rec == nil {
+				if id, ok := carriesToken(input); ok {
+					unknown[id] = true
+				}
+				continue
+			}
+			if rec.Unknown {
+				unknown[rec.ID] = true
+				continue
+			}
+			if rec.Valid {
+				// Saturates, as no claim can exceed the maximum anyway
+				sum, carry := bits.Add64(balances[rec.ID], rec.Amount, 0)
+				if carry != 0 {
+					sum = math.MaxUint64
+				}
+				balances[rec.ID] = sum
+			}
+		}
+	}
+
+	var tags tagSet
+	for _, out := range outputs {
+		tags.add("bsv21", out.id, out.vout)
+		tags.add("bsv21.op", out.op, out.vout)
+		rec := bsv21Record{ID: out.id, Amount: out.amt, Valid: out.ok}
+		if rec.Valid && out.op != BSV21DeployMint {
+			if unknown[out.id] {
+				// The balance cannot be checked, so it is not tagged and
+				// spends of it are unknown too
+				rec.Valid, rec.Unknown = false, true
+			} else {
+				rec.Valid = !overflow[out.id] && claimed[out.id] <= balances[out.id]
+			}
+		}
+		if !rec.Unknown {
+			tags.add("bsv21.valid", strconv.FormatBool(rec.Valid), out.vout)
+		}
+
+		if out.op == BSV21Burn {
+			continue
+		}
+		if err := b.store.Put(ctx, bsv21RecordKey(txid[:], out.vout), encodeBSV21Record(rec)); err != nil {
+			return nil, fmt.Errorf("put bsv21 record: %w", err)
+		}
+	}
+	return tags.results, nil
+}
+
+// parseBSV21Output reads a BSV-21 inscription on a 1-sat output. ok is false
+// if the output carries none; a malformed one is returned with out.ok false.
+func parseBSV21Output(txid *chainhash.Hash, vout uint32, output *transaction.TransactionOutput) (out bsv21Output, ok bool) {
+	if output.Satoshis != 1 {
+		return out, false
+	}
+	ins, ok := parseInscription(*output.LockingScript)
+	if !ok || ins.ContentType != bsv20ContentType {
+		return out, false
+	}
+	var body bsv21Inscription
+	if err := json.Unmarshal(ins.Content, &body); err != nil || body.P != "bsv-20" {
+		return out, false
+	}
+
+	out = bsv21Output{vout: vout, op: body.Op, id: body.ID}
+	switch body.Op {
+	case BSV21DeployMint:
+		out.id = fmt.Sprintf("%s_%d", txid, vout)
+		if dec, err := strconv.ParseUint(body.Dec, 10, 8); body.Dec != "" && (err != nil || dec > 18) {
+			return out, true
+		}
+	case BSV21Transfer, BSV21Burn:
+		if body.ID == "" {
+			return out, false // tick-based v1
+		}
+	default:
+		return out, false
+	}
+	amt, err := strconv.ParseUint(body.Amt, 10, 64)
+	if err != nil || amt == 0 {
+		return out, true
+	}
+	out.amt, out.ok = amt, true
+	return out, true
+}
+
+// inputRecord returns the token record of the output an input spends,
+// waiting up to InputWait for one if the source output is known to carry
+// a token. It returns nil if there is none.
+func (b *BSV21Indexer) inputRecord(ctx context.Context, input *transaction.TransactionInput) (*bsv21Record, error) {
+	if input.SourceTXID == nil {
+		return nil, nil
+	}
+	var wait time.Duration
+	if _, ok := carriesToken(input); ok {
+		wait = b.config.InputWait
+	}
+	data, err := waitRecord(ctx, b.store, bsv21RecordKey(input.SourceTXID[:], input.SourceTxOutIndex), wait)
+	if err != nil {
+		return nil, fmt.Errorf("get bsv21 record: %w", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	return decodeBSV21Record(data)
+}
+
+// waitRecord polls store for key for up to wait, for records written by
+// the concurrent indexing of a parent. It returns nil if none appears.
+func waitRecord(ctx context.Context, store kvstore.KVStore, key []byte, wait time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		data, err := store.Get(ctx, key)
+		if err != nil || data != nil || wait <= 0 || time.Now().After(deadline) {
+			return data, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// carriesToken reports whether an input's source output, known only for
+// extended-format transactions, carries a well-formed BSV-21 inscription,
+// and which token.
+func carriesToken(input *transaction.TransactionInput) (string, bool) {
+	source := input.SourceTxOutput()
+	if source == nil || source.LockingScript == nil {
+		return "", false
+	}
+	out, ok := parseBSV21Output(input.SourceTXID, input.SourceTxOutIndex, source)
+	if !ok || !out.ok || out.op == BSV21Burn {
+		return "", false
+	}
+	return out.id, true
+}
+
+func bsv21RecordKey(txid []byte, vout uint32) []byte {
+	key := make([]byte, 0, len(bsv21RecordPrefix)+36)
+	key = append(key, bsv21RecordPrefix...)
+	key = append(key, txid...)
+	return binary.BigEndian.AppendUint32(key, vout)
+}
+
+// bsv21Record status bytes.
+const (
+	bsv21Invalid byte = iota
+	bsv21Valid
+	bsv21Unknown
+)
+
+// encodeBSV21Record lays out a record as 1b status | 8b amount | token id.
+func encodeBSV21Record(rec bsv21Record) []byte {
+	data := make([]byte, 9, 9+len(rec.ID))
+	switch {
+	case rec.Unknown:
+		data[0] = bsv21Unknown
+	case rec.Valid:
+		data[0] = bsv21Valid
+	}
+	binary.BigEndian.PutUint64(data[1:9], rec.Amount)
+	return append(data, rec.ID...)
+}
+
+func decodeBSV21Record(data []byte) (*bsv21Record, error) {
+	if len(data) < 9 {
+		return nil, errors.New("bsv21 record too short")
+	}
+	return &bsv21Record{
+		Valid:   data[0] == bsv21Valid,
+		Unknown: data[0] == bsv21Unknown,
+		Amount:  binary.BigEndian.Uint64(data[1:9]),
+		ID:      string(data[9:]),
+	}, nil
+}
@@ -0,0 +1,236 @@
+package txindexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	kvmem "github.com/shruggr/inspiration/kvstore/memory"
+)
+
+const testTokenID = "ae59f3b898ec61acbdb6cc7a245fabeded0c094bf046f35206a3aec60ef88127_0"
+
+// bsv21TestOutput builds a 1-sat output inscribed with a BSV-20 JSON body.
+func bsv21TestOutput(t *testing.T, body string) *transaction.TransactionOutput {
+	t.Helper()
+	s := &script.Script{}
+	s.AppendOpcodes(script.OpFALSE, script.OpIF)
+	s.AppendPushData([]byte("ord"))
+	s.AppendOpcodes(script.Op1)
+	s.AppendPushData([]byte(bsv20ContentType))
+	s.AppendOpcodes(script.OpFALSE)
+	s.AppendPushData([]byte(body))
+	s.AppendOpcodes(script.OpENDIF)
+	return &transaction.TransactionOutput{Satoshis: 1, LockingScript: s}
+}
+
+// bsv21TestTx spends output 0 of each of spends into outputs.
+func bsv21TestTx(spends []*transaction.Transaction, outputs ...*transaction.TransactionOutput) *transaction.Transaction {
+	tx := transaction.NewTransaction()
+	for _, parent := range spends {
+		tx.AddInput(&transaction.TransactionInput{
+			SourceTXID:       parent.TxID(),
+			SourceTxOutIndex: 0,
+			SequenceNumber:   0xffffffff,
+		})
+	}
+	for _, out := range outputs {
+		tx.AddOutput(out)
+	}
+	return tx
+}
+
+type bsv21Tags map[string]*IndexResult
+
+func indexBSV21(t *testing.T, ix *BSV21Indexer, rawTx []byte) bsv21Tags {
+	t.Helper()
+	return indexByTag(t, ix, rawTx)
+}
+
+// vouts returns the outputs tagged key=value.
+func (tags bsv21Tags) vouts(tag string) []uint32 {
+	if r := tags[tag]; r != nil {
+		return r.Vouts
+	}
+	return nil
+}
+
+func sameVouts(got []uint32, want ...uint32) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBSV21MainnetTransfer(t *testing.T) {
+	ctx := context.Background()
+	parentRaw := loadTx(t, "9d9eed2d6c0526193a909c2f4543a84f683523bcde9bcd0d37028414a9eb1224")
+	childRaw := loadTx(t, "437407e10a85c7b707a347a140e82a2c35e36d082253d21855d0d0825bbe5d8c")
+
+	// Without records for its inputs the transfer is unfunded
+	tags := indexBSV21(t, NewBSV21Indexer(kvmem.New(), DefaultBSV21Config()), parentRaw)
+	if !sameVouts(tags.vouts("bsv21="+testTokenID), 0, 1, 2) || !sameVouts(tags.vouts("bsv21.op=transfer"), 0, 1, 2) {
+		t.Fatalf("token tags: %v", tags)
+	}
+	if !sameVouts(tags.vouts("bsv21.valid=false"), 0, 1, 2) {
+		t.Errorf("unfunded transfer: %v", tags)
+	}
+
+	// Funded by one of its inputs, it is valid, and so is the transfer
+	// spending its first output
+	store := kvmem.New()
+	parent, _ := transaction.NewTransactionFromBytes(parentRaw)
+	in := parent.Inputs[0]
+	store.Put(ctx, bsv21RecordKey(in.SourceTXID[:], in.SourceTxOutIndex), encodeBSV21Record(bsv21Record{
+		ID: testTokenID, Amount: 2870813 + 1000 + 17741623, Valid: true,
+	}))
+	ix := NewBSV21Indexer(store, DefaultBSV21Config())
+	if tags := indexBSV21(t, ix, parentRaw); !sameVouts(tags.vouts("bsv21.valid=true"), 0, 1, 2) {
+		t.Errorf("funded transfer: %v", tags)
+	}
+	if tags := indexBSV21(t, ix, childRaw); !sameVouts(tags.vouts("bsv21.valid=true"), 0, 1, 2) {
+		t.Errorf("onward transfer: %v", tags)
+	}
+
+	child, _ := transaction.NewTransactionFromBytes(childRaw)
+	data, _ := store.Get(ctx, bsv21RecordKey(child.TxID()[:], 0))
+	rec, err := decodeBSV21Record(data)
+	if err != nil || rec.ID != testTokenID || rec.Amount != 1000000 || !rec.Valid {
+		t.Errorf("output record: %+v, %v", rec, err)
+	}
+}
+
+func TestBSV21DeployTransferBurn(t *testing.T) {
+	ix := NewBSV21Indexer(kvmem.New(), DefaultBSV21Config())
+
+	deploy := bsv21TestTx(nil, bsv21TestOutput(t, `{"p":"bsv-20","op":"deploy+mint","sym":"TEST","amt":"1000","dec":"2"}`))
+	id := deploy.TxID().String() + "_0"
+	tags := indexBSV21(t, ix, deploy.Bytes())
+	if !sameVouts(tags.vouts("bsv21="+id), 0) || !sameVouts(tags.vouts("bsv21.op=deploy+mint"), 0) || !sameVouts(tags.vouts("bsv21.valid=true"), 0) {
+		t.Fatalf("deploy: %v", tags)
+	}
+
+	split := bsv21TestTx([]*transaction.Transaction{deploy},
+		bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","id":"`+id+`","amt":"600"}`),
+		bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","id":"`+id+`","amt":"400"}`),
+	)
+	if tags := indexBSV21(t, ix, split.Bytes()); !sameVouts(tags.vouts("bsv21.valid=true"), 0, 1) {
+		t.Fatalf("split: %v", tags)
+	}
+
+	overspend := bsv21TestTx([]*transaction.Transaction{split},
+		bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","id":"`+id+`","amt":"700"}`),
+	)
+	if tags := indexBSV21(t, ix, overspend.Bytes()); !sameVouts(tags.vouts("bsv21.valid=false"), 0) {
+		t.Errorf("overspend: %v", tags)
+	}
+
+	// Spending an invalid output carries no balance
+	respend := bsv21TestTx([]*transaction.Transaction{overspend},
+		bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","id":"`+id+`","amt":"1"}`),
+	)
+	if tags := indexBSV21(t, ix, respend.Bytes()); !sameVouts(tags.vouts("bsv21.valid=false"), 0) {
+		t.Errorf("spend of invalid output: %v", tags)
+	}
+
+	burn := bsv21TestTx([]*transaction.Transaction{split},
+		bsv21TestOutput(t, `{"p":"bsv-20","op":"burn","id":"`+id+`","amt":"600"}`),
+	)
+	if tags := indexBSV21(t, ix, burn.Bytes()); !sameVouts(tags.vouts("bsv21.op=burn"), 0) || !sameVouts(tags.vouts("bsv21.valid=true"), 0) {
+		t.Errorf("burn: %v", tags)
+	}
+	if data, _ := ix.store.Get(context.Background(), bsv21RecordKey(burn.TxID()[:], 0)); data != nil {
+		t.Error("burned output recorded a balance")
+	}
+}
+
+func TestBSV21OverflowingTransfer(t *testing.T) {
+	// Amounts summing to 2^64 wrap to 0, which no input balance is below
+	tx := bsv21TestTx(nil,
+		bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","id":"`+testTokenID+`","amt":"18446744073709551615"}`),
+		bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","id":"`+testTokenID+`","amt":"1"}`),
+	)
+	tags := indexBSV21(t, NewBSV21Indexer(kvmem.New(), DefaultBSV21Config()), tx.Bytes())
+	if tags["bsv21.valid=true"] != nil || !sameVouts(tags.vouts("bsv21.valid=false"), 0, 1) {
+		t.Errorf("overflowing transfer: %v", tags)
+	}
+}
+
+func TestBSV21IgnoresOtherInscriptions(t *testing.T) {
+	ix := NewBSV21Indexer(kvmem.New(), DefaultBSV21Config())
+	tx := bsv21TestTx(nil,
+		bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","tick":"ORDI","amt":"5"}`),
+		bsv21TestOutput(t, `{"p":"other","op":"transfer","id":"`+testTokenID+`","amt":"5"}`),
+		bsv21TestOutput(t, `not json`),
+	)
+	funded := bsv21TestOutput(t, `{"p":"bsv-20","op":"deploy+mint","amt":"5"}`)
+	funded.Satoshis = 2
+	tx.AddOutput(funded)
+	if tags := indexBSV21(t, ix, tx.Bytes()); len(tags) != 0 {
+		t.Errorf("expected no tags, got %v", tags)
+	}
+}
+
+func TestBSV21WaitsForParent(t *testing.T) {
+	ctx := context.Background()
+	parentTxID := chainhash.Hash{1}
+	source := bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","id":"`+testTokenID+`","amt":"5"}`)
+
+	child := transaction.NewTransaction()
+	input := &transaction.TransactionInput{SourceTXID: &parentTxID, SequenceNumber: 0xffffffff}
+	input.SetSourceTxOutput(source)
+	child.AddInput(input)
+	child.AddOutput(bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","id":"`+testTokenID+`","amt":"5"}`))
+	ef, err := child.EF()
+	if err != nil {
+		t.Fatalf("EF: %v", err)
+	}
+
+	// The parent's record is written while the child waits for it
+	store := kvmem.New()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		store.Put(ctx, bsv21RecordKey(parentTxID[:], 0), encodeBSV21Record(bsv21Record{ID: testTokenID, Amount: 5, Valid: true}))
+	}()
+	ix := NewBSV21Indexer(store, BSV21Config{InputWait: 5 * time.Second})
+	if tags := indexBSV21(t, ix, ef); !sameVouts(tags.vouts("bsv21.valid=true"), 0) {
+		t.Errorf("after waiting: %v", tags)
+	}
+
+	// A parent that never arrives leaves validity unknown
+	store = kvmem.New()
+	ix = NewBSV21Indexer(store, BSV21Config{InputWait: 100 * time.Millisecond})
+	tags := indexBSV21(t, ix, ef)
+	if !sameVouts(tags.vouts("bsv21="+testTokenID), 0) || tags["bsv21.valid=true"] != nil || tags["bsv21.valid=false"] != nil {
+		t.Errorf("unknown parent: %v", tags)
+	}
+
+	// and is recorded, so a grandchild is unknown without waiting
+	childTxID := chainhash.DoubleHashH(child.Bytes())
+	grandchild := transaction.NewTransaction()
+	input = &transaction.TransactionInput{SourceTXID: &childTxID, SequenceNumber: 0xffffffff}
+	input.SetSourceTxOutput(child.Outputs[0])
+	grandchild.AddInput(input)
+	grandchild.AddOutput(bsv21TestOutput(t, `{"p":"bsv-20","op":"transfer","id":"`+testTokenID+`","amt":"5"}`))
+	ef, err = grandchild.EF()
+	if err != nil {
+		t.Fatalf("EF: %v", err)
+	}
+	ix = NewBSV21Indexer(store, BSV21Config{InputWait: 5 * time.Second})
+	start := time.Now()
+	tags = indexBSV21(t, ix, ef)
+	if tags["bsv21.valid=true"] != nil || tags["bsv21.valid=false"] != nil {
+		t.Errorf("unknown grandparent: %v", tags)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("waited %v for an unknown input", waited)
+	}
+}
@@ -2,6 +2,7 @@ package txindexer
 
 import (
 	"context"
+	"fmt"
 )
 
 // IndexResult represents a key-value pair extracted from a transaction
@@ -9,6 +10,9 @@ type IndexResult struct {
 	Key   string
 	Value string
 	Vouts []uint32
+	// Vins lists the inputs a result was derived from, for terms about
+	// what a transaction spends rather than what it creates.
+	Vins []uint32
 }
 
 // TransactionContext provides transaction data to indexers
@@ -27,6 +31,13 @@ type Indexer interface {
 	Name() string
 }
 
+// DigestKeyer is implemented by indexers whose tag keys always carry
+// 32-byte digests in lowercase hex, which are indexed compactly; see
+// treebuilder.Config.
+type DigestKeyer interface {
+	DigestKeys() []string
+}
+
 // MultiIndexer combines multiple indexers
 type MultiIndexer struct {
 	indexers []Indexer
@@ -39,15 +50,16 @@ func NewMultiIndexer(indexers ...Indexer) *MultiIndexer {
 	}
 }
 
-// Index runs all child indexers and combines their results
+// Index runs all child indexers and combines their results. A child's error
+// fails the whole transaction, so it is retried rather than indexed with
+// that child's terms missing.
 func (m *MultiIndexer) Index(ctx context.Context, tx *TransactionContext) ([]*IndexResult, error) {
 	var allResults []*IndexResult
 
 	for _, indexer := range m.indexers {
 		results, err := indexer.Index(ctx, tx)
 		if err != nil {
-			// Log error but continue with other indexers
-			continue
+			return nil, fmt.Errorf("%s: %w", indexer.Name(), err)
 		}
 		allResults = append(allResults, results...)
 	}
@@ -60,6 +72,17 @@ func (m *MultiIndexer) Name() string {
 	return "MultiIndexer"
 }
 
+// DigestKeys returns the digest keys declared by its indexers.
+func (m *MultiIndexer) DigestKeys() []string {
+	var keys []string
+	for _, indexer := range m.indexers {
+		if d, ok := indexer.(DigestKeyer); ok {
+			keys = append(keys, d.DigestKeys()...)
+		}
+	}
+	return keys
+}
+
 // AddIndexer adds a new indexer to the multi-indexer
 func (m *MultiIndexer) AddIndexer(indexer Indexer) {
 	m.indexers = append(m.indexers, indexer)
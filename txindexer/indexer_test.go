@@ -0,0 +1,37 @@
+package txindexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type failingIndexer struct{ err error }
+
+func (f failingIndexer) Index(context.Context, *TransactionContext) ([]*IndexResult, error) {
+	return nil, f.err
+}
+
+func (f failingIndexer) Name() string { return "Failing" }
+
+func TestMultiIndexerReturnsChildErrors(t *testing.T) {
+	errStore := errors.New("store unavailable")
+	m := NewMultiIndexer(NewP2PKHIndexer(), failingIndexer{err: errStore})
+	results, err := m.Index(context.Background(), &TransactionContext{
+		TxID:  make([]byte, 32),
+		RawTx: buildTestP2PKHTx(t),
+	})
+	if !errors.Is(err, errStore) {
+		t.Fatalf("expected child error, got %v", err)
+	}
+	if results != nil {
+		t.Errorf("expected no partial results, got %v", results)
+	}
+}
+
+func TestMultiIndexerDigestKeys(t *testing.T) {
+	m := NewMultiIndexer(NewP2PKHIndexer(), NewScriptHashIndexer(DefaultScriptHashConfig()))
+	if keys := m.DigestKeys(); len(keys) != 2 || keys[0] != "scripthash" || keys[1] != "scripthash.template" {
+		t.Errorf("DigestKeys: got %v", keys)
+	}
+}
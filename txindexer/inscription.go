@@ -0,0 +1,277 @@
+package txindexer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/shruggr/inspiration/kvstore"
+)
+
+// maxContentTypeLen bounds the content type indexed as is; see tagValue.
+const maxContentTypeLen = 128
+
+// inscription is a 1Sat Ordinals inscription parsed from an
+// OP_FALSE OP_IF "ord" ... OP_ENDIF envelope.
+type inscription struct {
+	ContentType string
+	Content     []byte
+}
+
+// originRecordPrefix namespaces ordinal origin records in a store shared
+// with other records.
+var originRecordPrefix = []byte("origin:")
+
+// InscriptionConfig controls how ordinals are followed across transfers.
+type InscriptionConfig struct {
+	// InputWait bounds how long to wait for the record of an input whose
+	// source output is known to carry an inscription but has not been
+	// indexed yet. As in BSV21Config, source outputs are only known for
+	// transactions in extended format.
+	InputWait time.Duration
+}
+
+// DefaultInscriptionConfig waits up to ten seconds for an inscribed input's
+// record.
+func DefaultInscriptionConfig() InscriptionConfig {
+	return InscriptionConfig{InputWait: 10 * time.Second}
+}
+
+// InscriptionIndexer follows 1Sat Ordinals: 1-sat outputs carrying an
+// inscription envelope and the 1-sat outputs they are transferred to. Each
+// is tagged with its "origin", the txid_vout where the sat was first
+// inscribed, and each envelope with its "inscription.type" and the SHA-256
+// of its content as "inscription.sha256". Re-inscribing a sat keeps its
+// origin.
+//
+// Origins are recorded in store under each outpoint. A sat comes from the
+// input covering the same offset in the inputs' satoshis, whose values are
+// known from their records or, in extended format, their source outputs;
+// other inputs without a record carry no ordinals. A sat that may come from
+// a recorded input past one of unknown value gets no origin, and is
+// recorded as unknown so that its transfers get none either.
+type InscriptionIndexer struct {
+	store  kvstore.KVStore
+	config InscriptionConfig
+}
+
+func NewInscriptionIndexer(store kvstore.KVStore, config InscriptionConfig) *InscriptionIndexer {
+	return &InscriptionIndexer{store: store, config: config}
+}
+
+func (i *InscriptionIndexer) Name() string { return "Inscription" }
+
+// satRange is the satoshis an input contributes, by offset across the
+// inputs. rec is the origin record of a 1-sat input, if any.
+type satRange struct {
+	start, end uint64
+	rec        *originRecord
+}
+
+func (i *InscriptionIndexer) Index(ctx context.Context, txCtx *TransactionContext) ([]*IndexResult, error) {
+	tx, err := transaction.NewTransactionFromBytes(txCtx.RawTx)
+	if err != nil {
+		return nil, err
+	}
+	txid := tx.TxID()
+
+	var ranges []satRange
+	var known uint64 // offset up to which input values are known
+	exact := true
+	pastUnknown := false // a recorded input lies past one of unknown value
+	for _, input := range tx.Inputs {
+		rec, err := i.inputRecord(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		if !exact {
+			pastUnknown = pastUnknown || rec != nil
+			continue
+		}
+		var sats uint64
+		switch source := input.SourceTxOutput(); {
+		case rec != nil:
+			sats = 1
+		case source != nil:
+			sats = source.Satoshis
+		default:
+			exact = false
+			continue
+		}
+		ranges = append(ranges, satRange{start: known, end: known + sats, rec: rec})
+		known += sats
+	}
+
+	var tags tagSet
+	var offset uint64
+	for vout, output := range tx.Outputs {
+		at := offset
+		offset += output.Satoshis
+		if output.Satoshis != 1 {
+			continue
+		}
+		var ins *inscription
+		if output.LockingScript != nil {
+			ins, _ = parseInscription(*output.LockingScript)
+		}
+
+		var rec *originRecord
+		switch {
+		case at < known:
+			for _, r := range ranges {
+				if at >= r.start && at < r.end {
+					rec = r.rec
+					break
+				}
+			}
+		case pastUnknown:
+			rec = &originRecord{}
+		}
+		if rec == nil {
+			if ins == nil {
+				continue
+			}
+			rec = &originRecord{Origin: fmt.Sprintf("%s_%d", txid, vout)}
+		}
+
+		if rec.Origin != "" {
+			tags.add("origin", rec.Origin, uint32(vout))
+		}
+		if ins != nil {
+			sum := sha256.Sum256(ins.Content)
+			if ins.ContentType != "" {
+				tags.add("inscription.type", tagValue([]byte(ins.ContentType), maxContentTypeLen), uint32(vout))
+			}
+			tags.add("inscription.sha256", hex.EncodeToString(sum[:]), uint32(vout))
+		}
+		if err := i.store.Put(ctx, originRecordKey(txid[:], uint32(vout)), encodeOriginRecord(*rec)); err != nil {
+			return nil, fmt.Errorf("put origin record: %w", err)
+		}
+	}
+	return tags.results, nil
+}
+
+// inputRecord returns the origin record of the output an input spends,
+// waiting up to InputWait for one if the source output is known to carry an
+// inscription. It returns nil if there is none.
+func (i *InscriptionIndexer) inputRecord(ctx context.Context, input *transaction.TransactionInput) (*originRecord, error) {
+	if input.SourceTXID == nil {
+		return nil, nil
+	}
+	var wait time.Duration
+	if source := input.SourceTxOutput(); source != nil && source.Satoshis == 1 && source.LockingScript != nil {
+		if _, ok := parseInscription(*source.LockingScript); ok {
+			wait = i.config.InputWait
+		}
+	}
+	data, err := waitRecord(ctx, i.store, originRecordKey(input.SourceTXID[:], input.SourceTxOutIndex), wait)
+	if err != nil {
+		return nil, fmt.Errorf("get origin record: %w", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	return decodeOriginRecord(data)
+}
+
+// originRecord is the origin of the sat in a 1-sat output, empty if it
+// could not be traced.
+type originRecord struct {
+	Origin string
+}
+
+func originRecordKey(txid []byte, vout uint32) []byte {
+	key := make([]byte, 0, len(originRecordPrefix)+36)
+	key = append(key, originRecordPrefix...)
+	key = append(key, txid...)
+	return binary.BigEndian.AppendUint32(key, vout)
+}
+
+// encodeOriginRecord lays out a record as 1b version | origin, so that an
+// unknown origin is still a non-empty value.
+func encodeOriginRecord(rec originRecord) []byte {
+	return append([]byte{0}, rec.Origin...)
+}
+
+func decodeOriginRecord(data []byte) (*originRecord, error) {
+	if len(data) < 1 || data[0] != 0 {
+		return nil, errors.New("bad origin record")
+	}
+	return &originRecord{Origin: string(data[1:])}, nil
+}
+
+var ordTag = []byte("ord")
+
+// parseInscription finds an inscription envelope anywhere in a locking
+// script. Field 1 is the content type and field 0 starts the content, which
+// runs to OP_ENDIF and may be split over several pushes. Other fields are
+// skipped.
+func parseInscription(s script.Script) (*inscription, bool) {
+	chunks, err := script.DecodeScript(s)
+	if err != nil {
+		return nil, false
+	}
+	for i := 0; i+2 < len(chunks); i++ {
+		if chunks[i].Op != script.OpFALSE || chunks[i+1].Op != script.OpIF || !bytes.Equal(chunks[i+2].Data, ordTag) {
+			continue
+		}
+		ins, ok := parseEnvelope(chunks[i+3:])
+		if ok {
+			return ins, true
+		}
+	}
+	return nil, false
+}
+
+// parseEnvelope reads field/value pairs up to OP_ENDIF.
+func parseEnvelope(chunks []*script.ScriptChunk) (*inscription, bool) {
+	ins := &inscription{}
+	for i := 0; i < len(chunks); i++ {
+		c := chunks[i]
+		if c.Op == script.OpENDIF {
+			return ins, true
+		}
+		field, ok := envelopeField(c)
+		if !ok || i+1 >= len(chunks) {
+			return nil, false
+		}
+		if field == 0 {
+			for i++; i < len(chunks) && chunks[i].Op <= script.OpPUSHDATA4; i++ {
+				ins.Content = append(ins.Content, chunks[i].Data...)
+			}
+			if i < len(chunks) && chunks[i].Op == script.OpENDIF {
+				return ins, true
+			}
+			return nil, false
+		}
+		i++
+		if chunks[i].Op > script.OpPUSHDATA4 {
+			return nil, false
+		}
+		if field == 1 {
+			ins.ContentType = string(chunks[i].Data)
+		}
+	}
+	return nil, false
+}
+
+// envelopeField decodes a field tag pushed as OP_0, OP_1..OP_16 or a
+// single byte.
+func envelopeField(c *script.ScriptChunk) (int, bool) {
+	switch {
+	case c.Op == script.OpFALSE:
+		return 0, true
+	case c.Op >= script.Op1 && c.Op <= script.Op16:
+		return int(c.Op-script.Op1) + 1, true
+	case c.Op <= script.OpPUSHDATA4 && len(c.Data) == 1:
+		return int(c.Data[0]), true
+	}
+	return 0, false
+}
@@ -0,0 +1,162 @@
+package txindexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	kvmem "github.com/shruggr/inspiration/kvstore/memory"
+)
+
+// loadTx reads a mainnet transaction checked in under testdata as hex.
+func loadTx(t *testing.T, txid string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + txid + ".hex")
+	if err != nil {
+		t.Fatalf("read test vector: %v", err)
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("decode test vector: %v", err)
+	}
+	return raw
+}
+
+func TestInscriptionMainnetTx(t *testing.T) {
+	const txid = "9d9eed2d6c0526193a909c2f4543a84f683523bcde9bcd0d37028414a9eb1224"
+	got := indexByTag(t, NewInscriptionIndexer(kvmem.New(), DefaultInscriptionConfig()), loadTx(t, txid))
+
+	// Three 1-sat BSV-20 transfer inscriptions, one per output
+	if r := got["inscription.type=application/bsv-20"]; r == nil || len(r.Vouts) != 3 {
+		t.Fatalf("inscription.type: %+v", r)
+	}
+	for vout, amt := range []string{"2870813", "1000", "17741623"} {
+		origin := fmt.Sprintf("%s_%d", txid, vout)
+		if r := got["origin="+origin]; r == nil || len(r.Vouts) != 1 || r.Vouts[0] != uint32(vout) {
+			t.Errorf("origin %s: %+v", origin, r)
+		}
+		content := `{"p":"bsv-20","op":"transfer","id":"ae59f3b898ec61acbdb6cc7a245fabeded0c094bf046f35206a3aec60ef88127_0","amt":"` + amt + `"}`
+		sum := sha256.Sum256([]byte(content))
+		if r := got["inscription.sha256="+hex.EncodeToString(sum[:])]; r == nil || r.Vouts[0] != uint32(vout) {
+			t.Errorf("content hash of vout %d: %+v", vout, r)
+		}
+	}
+	if len(got) != 7 {
+		t.Errorf("expected 7 tags, got %d", len(got))
+	}
+}
+
+func TestInscriptionFollowsTransfer(t *testing.T) {
+	const parentID = "9d9eed2d6c0526193a909c2f4543a84f683523bcde9bcd0d37028414a9eb1224"
+	const childID = "437407e10a85c7b707a347a140e82a2c35e36d082253d21855d0d0825bbe5d8c"
+	store := kvmem.New()
+	ix := NewInscriptionIndexer(store, DefaultInscriptionConfig())
+	indexByTag(t, ix, loadTx(t, parentID))
+
+	// Input 0 spends the parent's first output, so the child's output 0
+	// re-inscribes that sat and keeps its origin. Outputs 1 and 2 take sats
+	// of the unrecorded funding input and are new origins.
+	got := indexByTag(t, ix, loadTx(t, childID))
+	if r := got["origin="+parentID+"_0"]; r == nil || len(r.Vouts) != 1 || r.Vouts[0] != 0 {
+		t.Errorf("transferred origin: %+v", r)
+	}
+	for _, vout := range []uint32{1, 2} {
+		if r := got[fmt.Sprintf("origin=%s_%d", childID, vout)]; r == nil || r.Vouts[0] != vout {
+			t.Errorf("new origin of vout %d: %+v", vout, r)
+		}
+	}
+	if got["origin="+childID+"_0"] != nil {
+		t.Error("re-inscription tagged as a new origin")
+	}
+
+	// A plain 1-sat transfer carries the origin on
+	child, _ := transaction.NewTransactionFromBytes(loadTx(t, childID))
+	lock, _ := hex.DecodeString("76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
+	transfer := transaction.NewTransaction()
+	transfer.AddInput(&transaction.TransactionInput{SourceTXID: child.TxID(), SourceTxOutIndex: 0, SequenceNumber: 0xffffffff})
+	transfer.AddOutput(&transaction.TransactionOutput{Satoshis: 1, LockingScript: script.NewFromBytes(lock)})
+	if got := indexByTag(t, ix, transfer.Bytes()); got["origin="+parentID+"_0"] == nil || len(got) != 1 {
+		t.Errorf("plain transfer: %v", got)
+	}
+
+	// Behind an input of unknown value the sat cannot be traced, and
+	// neither can its transfers
+	untraced := transaction.NewTransaction()
+	untraced.AddInput(&transaction.TransactionInput{SourceTXID: &chainhash.Hash{1}, SequenceNumber: 0xffffffff})
+	untraced.AddInput(&transaction.TransactionInput{SourceTXID: transfer.TxID(), SourceTxOutIndex: 0, SequenceNumber: 0xffffffff})
+	untraced.AddOutput(&transaction.TransactionOutput{Satoshis: 1, LockingScript: script.NewFromBytes(lock)})
+	if got := indexByTag(t, ix, untraced.Bytes()); len(got) != 0 {
+		t.Errorf("untraced sat: %v", got)
+	}
+	onward := transaction.NewTransaction()
+	onward.AddInput(&transaction.TransactionInput{SourceTXID: untraced.TxID(), SourceTxOutIndex: 0, SequenceNumber: 0xffffffff})
+	onward.AddOutput(child.Outputs[0])
+	if got := indexByTag(t, ix, onward.Bytes()); got["inscription.type=application/bsv-20"] == nil || len(got) != 2 {
+		t.Errorf("transfer of untraced sat: %v", got)
+	}
+}
+
+func TestInscriptionSkipsFundedOutputs(t *testing.T) {
+	// A transfer spending the first output of the transaction above. The
+	// same envelope on an output worth more than 1 sat is not an ordinal.
+	raw := loadTx(t, "437407e10a85c7b707a347a140e82a2c35e36d082253d21855d0d0825bbe5d8c")
+	tx, err := transaction.NewTransactionFromBytes(raw)
+	if err != nil {
+		t.Fatalf("parse tx: %v", err)
+	}
+	if got := indexByTag(t, NewInscriptionIndexer(kvmem.New(), DefaultInscriptionConfig()), raw); len(got["inscription.type=application/bsv-20"].Vouts) != 3 {
+		t.Fatalf("expected 3 inscriptions, got %v", got)
+	}
+	tx.Outputs[1].Satoshis = 1000
+	got := indexByTag(t, NewInscriptionIndexer(kvmem.New(), DefaultInscriptionConfig()), tx.Bytes())
+	if r := got["inscription.type=application/bsv-20"]; r == nil || len(r.Vouts) != 2 || r.Vouts[1] != 2 {
+		t.Errorf("inscription.type: %+v", r)
+	}
+}
+
+func TestParseInscription(t *testing.T) {
+	envelope := func(parts ...any) script.Script {
+		s := &script.Script{}
+		for _, p := range parts {
+			switch v := p.(type) {
+			case byte:
+				s.AppendOpcodes(v)
+			case string:
+				s.AppendPushData([]byte(v))
+			}
+		}
+		return *s
+	}
+
+	tests := []struct {
+		name    string
+		script  script.Script
+		ok      bool
+		typ     string
+		content string
+	}{
+		{"after lock", envelope(script.OpDUP, script.OpDROP, script.OpFALSE, script.OpIF, "ord", script.Op1, "text/plain", script.OpFALSE, "hello", script.OpENDIF), true, "text/plain", "hello"},
+		{"split content", envelope(script.OpFALSE, script.OpIF, "ord", script.Op1, "text/plain", script.OpFALSE, "hel", "lo", script.OpENDIF), true, "text/plain", "hello"},
+		{"unknown field", envelope(script.OpFALSE, script.OpIF, "ord", script.Op5, "meta", script.Op1, "image/png", script.OpFALSE, "png", script.OpENDIF), true, "image/png", "png"},
+		{"no type", envelope(script.OpFALSE, script.OpIF, "ord", script.OpFALSE, "x", script.OpENDIF), true, "", "x"},
+		{"unterminated", envelope(script.OpFALSE, script.OpIF, "ord", script.Op1, "text/plain", script.OpFALSE, "hello"), false, "", ""},
+		{"other envelope", envelope(script.OpFALSE, script.OpIF, "bsv", script.OpFALSE, "x", script.OpENDIF), false, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ins, ok := parseInscription(tt.script)
+			if ok != tt.ok {
+				t.Fatalf("ok: got %v, want %v", ok, tt.ok)
+			}
+			if ok && (ins.ContentType != tt.typ || string(ins.Content) != tt.content) {
+				t.Errorf("got %q %q, want %q %q", ins.ContentType, ins.Content, tt.typ, tt.content)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package txindexer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// OpReturnConfig selects which pushes of a data-carrier output are indexed.
+type OpReturnConfig struct {
+	// Keys names the pushes after the first, which is always indexed as
+	// "protocol": Keys[0] is the second push, Keys[1] the third, and so on.
+	// Pushes with no key or an empty key are not indexed.
+	Keys []string
+	// MaxValueLen is the longest value indexed as is. Longer values are
+	// replaced by "sha256:" and the hex SHA-256 of the push, so they can
+	// still be looked up exactly by hashing the full value.
+	MaxValueLen int
+}
+
+// DefaultOpReturnConfig indexes only the protocol push, hashing values
+// longer than 64 bytes.
+func DefaultOpReturnConfig() OpReturnConfig {
+	return OpReturnConfig{MaxValueLen: 64}
+}
+
+// OpReturnIndexer tags OP_RETURN and OP_FALSE OP_RETURN outputs with their
+// first push, usually a Bitcom protocol prefix, as "protocol".
+type OpReturnIndexer struct {
+	config OpReturnConfig
+}
+
+func NewOpReturnIndexer(config OpReturnConfig) *OpReturnIndexer {
+	return &OpReturnIndexer{config: config}
+}
+
+func (o *OpReturnIndexer) Name() string { return "OpReturn" }
+
+func (o *OpReturnIndexer) Index(_ context.Context, txCtx *TransactionContext) ([]*IndexResult, error) {
+	tx, err := transaction.NewTransactionFromBytes(txCtx.RawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags tagSet
+	for i, output := range tx.Outputs {
+		pushes, ok := dataPushes(*output.LockingScript)
+		if !ok || len(pushes) == 0 || len(pushes[0]) == 0 {
+			continue
+		}
+		tags.add("protocol", tagValue(pushes[0], o.config.MaxValueLen), uint32(i))
+		for j, push := range pushes[1:] {
+			if j >= len(o.config.Keys) {
+				break
+			}
+			if key := o.config.Keys[j]; key != "" && len(push) > 0 {
+				tags.add(key, tagValue(push, o.config.MaxValueLen), uint32(i))
+			}
+		}
+	}
+	return tags.results, nil
+}
+
+// dataPushes returns the pushes following OP_RETURN in a data-carrier
+// script, stopping at the first opcode that is not a push. ok is false if
+// the script is not a data carrier.
+func dataPushes(s script.Script) (pushes [][]byte, ok bool) {
+	var data []byte
+	switch {
+	case len(s) > 0 && s[0] == script.OpRETURN:
+		data = s[1:]
+	case len(s) > 1 && s[0] == script.OpFALSE && s[1] == script.OpRETURN:
+		data = s[2:]
+	default:
+		return nil, false
+	}
+
+	// Chunks that fail to decode are a truncated final push; keep the rest.
+	chunks, _ := script.DecodeScript(data, script.DecodeOptionsParseOpReturn)
+	for _, c := range chunks {
+		if c.Op > script.OpPUSHDATA4 {
+			break
+		}
+		pushes = append(pushes, c.Data)
+	}
+	return pushes, true
+}
+
+// tagValue renders a push as a tag value: printable UTF-8 as text, anything
+// else as hex, and either form longer than maxLen as "sha256:" and the hex
+// SHA-256 of the push. maxLen 0 disables hashing.
+func tagValue(push []byte, maxLen int) string {
+	v := hex.EncodeToString(push)
+	if isPrintable(push) {
+		v = string(push)
+	}
+	if maxLen > 0 && len(v) > maxLen {
+		sum := sha256.Sum256(push)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return v
+}
+
+func isPrintable(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// tagSet collects results in first-seen order, merging the vouts of
+// repeated key/value pairs.
+type tagSet struct {
+	results []*IndexResult
+	index   map[[2]string]*IndexResult
+}
+
+func (t *tagSet) add(key, value string, vout uint32) {
+	if t.index == nil {
+		t.index = make(map[[2]string]*IndexResult)
+	}
+	r, ok := t.index[[2]string{key, value}]
+	if !ok {
+		r = &IndexResult{Key: key, Value: value}
+		t.index[[2]string{key, value}] = r
+		t.results = append(t.results, r)
+	}
+	if n := len(r.Vouts); n == 0 || r.Vouts[n-1] != vout {
+		r.Vouts = append(r.Vouts, vout)
+	}
+}
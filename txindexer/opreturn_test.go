@@ -0,0 +1,88 @@
+package txindexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+)
+
+// dataScript builds an OP_FALSE OP_RETURN script pushing each of pushes.
+func dataScript(t *testing.T, pushes ...[]byte) []byte {
+	t.Helper()
+	s := &script.Script{script.OpFALSE, script.OpRETURN}
+	for _, p := range pushes {
+		if err := s.AppendPushData(p); err != nil {
+			t.Fatalf("AppendPushData: %v", err)
+		}
+	}
+	return *s
+}
+
+func TestOpReturnProtocol(t *testing.T) {
+	p2pkhScript, _ := hex.DecodeString("76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
+	bare, _ := hex.DecodeString("6a0568656c6c6f")
+	bProtocol := []byte("19HxigV4QyBv3tHpQVcUEQyq1pzZVdoAut")
+
+	got := indexByTag(t, NewOpReturnIndexer(DefaultOpReturnConfig()), buildTestP2PKHTx(t,
+		dataScript(t, bProtocol, []byte("hello world"), []byte("text/plain")),
+		p2pkhScript,
+		bare,
+		dataScript(t, bProtocol, []byte("again")),
+	))
+	if len(got) != 2 {
+		t.Fatalf("expected 2 tags, got %v", got)
+	}
+	if r := got["protocol=19HxigV4QyBv3tHpQVcUEQyq1pzZVdoAut"]; r == nil || len(r.Vouts) != 2 || r.Vouts[0] != 0 || r.Vouts[1] != 3 {
+		t.Errorf("protocol tag: %+v", r)
+	}
+	if r := got["protocol=hello"]; r == nil || len(r.Vouts) != 1 || r.Vouts[0] != 2 {
+		t.Errorf("bare OP_RETURN tag: %+v", r)
+	}
+}
+
+func TestOpReturnKeys(t *testing.T) {
+	config := DefaultOpReturnConfig()
+	config.Keys = []string{"content", "", "encoding"}
+
+	got := indexByTag(t, NewOpReturnIndexer(config), buildTestP2PKHTx(t,
+		dataScript(t, []byte("proto"), []byte("hi"), []byte("skipped"), []byte("utf-8"), []byte("ignored")),
+	))
+	for _, tag := range []string{"protocol=proto", "content=hi", "encoding=utf-8"} {
+		if got[tag] == nil {
+			t.Errorf("missing tag %s in %v", tag, got)
+		}
+	}
+	if len(got) != 3 {
+		t.Errorf("expected 3 tags, got %v", got)
+	}
+}
+
+func TestOpReturnValueEncoding(t *testing.T) {
+	config := DefaultOpReturnConfig()
+	config.Keys = []string{"data", "body"}
+	long := []byte(strings.Repeat("x", 65))
+	sum := sha256.Sum256(long)
+
+	got := indexByTag(t, NewOpReturnIndexer(config), buildTestP2PKHTx(t,
+		dataScript(t, []byte{0x01, 0x02, 0xff}, []byte("line\nbreak"), long),
+	))
+	for _, tag := range []string{
+		"protocol=0102ff",
+		"data=" + hex.EncodeToString([]byte("line\nbreak")),
+		"body=sha256:" + hex.EncodeToString(sum[:]),
+	} {
+		if got[tag] == nil {
+			t.Errorf("missing tag %s in %v", tag, got)
+		}
+	}
+}
+
+func TestOpReturnNotDataCarrier(t *testing.T) {
+	p2pkhScript, _ := hex.DecodeString("76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
+	if got := indexByTag(t, NewOpReturnIndexer(DefaultOpReturnConfig()), buildTestP2PKHTx(t, p2pkhScript, []byte{script.OpFALSE, script.OpRETURN})); len(got) != 0 {
+		t.Errorf("expected no tags, got %v", got)
+	}
+}
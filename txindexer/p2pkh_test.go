@@ -28,6 +28,23 @@ func buildTestP2PKHTx(t *testing.T, lockingScripts ...[]byte) []byte {
 	return tx.Bytes()
 }
 
+// indexByTag runs ix over rawTx and returns its results keyed by "key=value".
+func indexByTag(t *testing.T, ix Indexer, rawTx []byte) map[string]*IndexResult {
+	t.Helper()
+	results, err := ix.Index(context.Background(), &TransactionContext{
+		TxID:  make([]byte, 32),
+		RawTx: rawTx,
+	})
+	if err != nil {
+		t.Fatalf("%s: %v", ix.Name(), err)
+	}
+	byTag := make(map[string]*IndexResult)
+	for _, r := range results {
+		byTag[r.Key+"="+r.Value] = r
+	}
+	return byTag
+}
+
 func TestP2PKHIndexer(t *testing.T) {
 	p2pkhScript, _ := hex.DecodeString("76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
 	rawTx := buildTestP2PKHTx(t, p2pkhScript)
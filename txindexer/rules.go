@@ -0,0 +1,377 @@
+package txindexer
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"gopkg.in/yaml.v3"
+)
+
+// RulesConfig is a set of declarative output rules, loaded from YAML or JSON
+// by LoadRulesConfig.
+type RulesConfig struct {
+	// MaxValueLen is the longest captured value indexed as is; see tagValue.
+	MaxValueLen int    `json:"maxValueLen" yaml:"maxValueLen"`
+	Rules       []Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule tags outputs matching all of its matchers; a rule needs at least one.
+type Rule struct {
+	Name string `json:"name" yaml:"name"`
+	// Template matches the whole locking script, one token per chunk:
+	//   OP_DUP            an opcode, by its go-sdk name
+	//   0x76a9            a push of exactly these bytes
+	//   <name>            any push, captured as name ("_" discards it)
+	//   <name:20>         a push of exactly 20 bytes, captured
+	//   ...               any run of chunks, including none; at most one
+	//                     per template
+	// Everything after an OP_RETURN outside any IF is a single chunk.
+	Template string `json:"template,omitempty" yaml:"template,omitempty"`
+	// OpReturn matches the leading pushes of an OP_RETURN or
+	// OP_FALSE OP_RETURN output. Elements are literal text, 0x-prefixed
+	// hex or captures as in Template; an empty list matches any such output.
+	OpReturn []string `json:"opReturn,omitempty" yaml:"opReturn,omitempty"`
+	// Satoshis bounds the output value.
+	Satoshis *SatoshiRange `json:"satoshis,omitempty" yaml:"satoshis,omitempty"`
+	// Tags are emitted for each matching output. Values may refer to
+	// captures as {name}.
+	Tags []RuleTag `json:"tags" yaml:"tags"`
+}
+
+// SatoshiRange is an inclusive range of output values; a nil bound is open.
+type SatoshiRange struct {
+	Min *uint64 `json:"min,omitempty" yaml:"min,omitempty"`
+	Max *uint64 `json:"max,omitempty" yaml:"max,omitempty"`
+}
+
+type RuleTag struct {
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// DefaultRulesConfig returns the configuration rule files are loaded over.
+func DefaultRulesConfig() RulesConfig {
+	return RulesConfig{MaxValueLen: 64}
+}
+
+// LoadRulesConfig reads a rules file, as JSON if its extension is .json and
+// as YAML otherwise.
+func LoadRulesConfig(path string) (RulesConfig, error) {
+	config := DefaultRulesConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("read rules: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &config)
+	} else {
+		err = yaml.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return config, fmt.Errorf("parse rules %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// RuleIndexer tags outputs by declarative rules, so protocols can be indexed
+// without code changes.
+type RuleIndexer struct {
+	rules       []*compiledRule
+	maxValueLen int
+}
+
+// NewRuleIndexer compiles the rules in config, failing on any that are
+// malformed.
+func NewRuleIndexer(config RulesConfig) (*RuleIndexer, error) {
+	r := &RuleIndexer{maxValueLen: config.MaxValueLen}
+	for i, rule := range config.Rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			name := rule.Name
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		r.rules = append(r.rules, c)
+	}
+	return r, nil
+}
+
+func (r *RuleIndexer) Name() string { return "Rules" }
+
+func (r *RuleIndexer) Index(_ context.Context, txCtx *TransactionContext) ([]*IndexResult, error) {
+	tx, err := transaction.NewTransactionFromBytes(txCtx.RawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags tagSet
+	for i, output := range tx.Outputs {
+		if output.LockingScript == nil {
+			continue
+		}
+		// Decoded lazily, once per output
+		var chunks []*script.ScriptChunk
+		var pushes [][]byte
+		var decoded, isData, chunksOK bool
+		for _, rule := range r.rules {
+			if !rule.matchSatoshis(output.Satoshis) {
+				continue
+			}
+			if !decoded && (rule.template != nil || rule.opReturn != nil) {
+				decoded = true
+				c, err := script.DecodeScript(*output.LockingScript)
+				chunks, chunksOK = c, err == nil
+				pushes, isData = dataPushes(*output.LockingScript)
+			}
+			captures := make(map[string][]byte)
+			if rule.template != nil && (!chunksOK || !matchTemplate(rule.template, chunks, captures)) {
+				continue
+			}
+			if rule.opReturn != nil && (!isData || !matchPushes(rule.opReturn, pushes, captures)) {
+				continue
+			}
+			for _, tag := range rule.tags {
+				if value := tag.render(captures, r.maxValueLen); value != "" {
+					tags.add(tag.key, value, uint32(i))
+				}
+			}
+		}
+	}
+	return tags.results, nil
+}
+
+type compiledRule struct {
+	template []templateToken
+	opReturn []templateToken
+	min, max *uint64
+	tags     []compiledTag
+}
+
+type tokenKind int
+
+const (
+	tokenOpcode tokenKind = iota
+	tokenData
+	tokenCapture
+	tokenAny
+)
+
+type templateToken struct {
+	kind tokenKind
+	op   byte
+	data []byte
+	name string
+	size int // required push length for captures, or -1
+}
+
+// compiledTag is a tag value split into literal text and capture names,
+// alternating and starting with text.
+type compiledTag struct {
+	key   string
+	parts []string
+}
+
+var captureRef = regexp.MustCompile(`\{([A-Za-z0-9_.-]+)\}`)
+
+func compileRule(rule Rule) (*compiledRule, error) {
+	if rule.Template == "" && rule.OpReturn == nil && rule.Satoshis == nil {
+		return nil, errors.New("no matchers")
+	}
+	if len(rule.Tags) == 0 {
+		return nil, errors.New("no tags")
+	}
+	c := &compiledRule{}
+	if rule.Satoshis != nil {
+		c.min, c.max = rule.Satoshis.Min, rule.Satoshis.Max
+	}
+
+	captures := make(map[string]bool)
+	if rule.Template != "" {
+		anys := 0
+		for _, field := range strings.Fields(rule.Template) {
+			tok, err := parseToken(field, false)
+			if err != nil {
+				return nil, fmt.Errorf("template: %w", err)
+			}
+			// Each "..." multiplies the backtracking in matchTemplate by the
+			// script's length.
+			if tok.kind == tokenAny {
+				if anys++; anys > 1 {
+					return nil, errors.New("template: more than one ...")
+				}
+			}
+			c.template = append(c.template, tok)
+			if tok.kind == tokenCapture {
+				captures[tok.name] = true
+			}
+		}
+	}
+	for _, field := range rule.OpReturn {
+		tok, err := parseToken(field, true)
+		if err != nil {
+			return nil, fmt.Errorf("opReturn: %w", err)
+		}
+		c.opReturn = append(c.opReturn, tok)
+		if tok.kind == tokenCapture {
+			captures[tok.name] = true
+		}
+	}
+	if rule.OpReturn != nil && c.opReturn == nil {
+		c.opReturn = []templateToken{}
+	}
+
+	for _, tag := range rule.Tags {
+		if tag.Key == "" {
+			return nil, errors.New("tag without a key")
+		}
+		ct := compiledTag{key: tag.Key}
+		last := 0
+		for _, m := range captureRef.FindAllStringSubmatchIndex(tag.Value, -1) {
+			name := tag.Value[m[2]:m[3]]
+			if name == "_" || !captures[name] {
+				return nil, fmt.Errorf("tag %s: unknown capture {%s}", tag.Key, name)
+			}
+			ct.parts = append(ct.parts, tag.Value[last:m[0]], name)
+			last = m[1]
+		}
+		ct.parts = append(ct.parts, tag.Value[last:])
+		c.tags = append(c.tags, ct)
+	}
+	return c, nil
+}
+
+var captureToken = regexp.MustCompile(`^<([A-Za-z0-9_.-]+)(?::(\d+))?>$`)
+
+// parseToken parses a template or opReturn element. In opReturn anything
+// that is not hex or a capture is literal text.
+func parseToken(field string, text bool) (templateToken, error) {
+	if m := captureToken.FindStringSubmatch(field); m != nil {
+		tok := templateToken{kind: tokenCapture, name: m[1], size: -1}
+		if m[2] != "" {
+			size, err := strconv.Atoi(m[2])
+			if err != nil {
+				return tok, fmt.Errorf("capture %s: bad size", field)
+			}
+			tok.size = size
+		}
+		return tok, nil
+	}
+	if strings.HasPrefix(field, "0x") {
+		data, err := hex.DecodeString(field[2:])
+		if err != nil {
+			return templateToken{}, fmt.Errorf("bad hex %s", field)
+		}
+		return templateToken{kind: tokenData, data: data}, nil
+	}
+	if text {
+		return templateToken{kind: tokenData, data: []byte(field)}, nil
+	}
+	if field == "..." {
+		return templateToken{kind: tokenAny}, nil
+	}
+	op, ok := script.OpCodeStrings[field]
+	if !ok {
+		return templateToken{}, fmt.Errorf("unknown token %s", field)
+	}
+	return templateToken{kind: tokenOpcode, op: op}, nil
+}
+
+func (c *compiledRule) matchSatoshis(sats uint64) bool {
+	return (c.min == nil || sats >= *c.min) && (c.max == nil || sats <= *c.max)
+}
+
+// matchTemplate matches tokens against all of chunks, backtracking over
+// "..." tokens.
+func matchTemplate(tokens []templateToken, chunks []*script.ScriptChunk, captures map[string][]byte) bool {
+	if len(tokens) == 0 {
+		return len(chunks) == 0
+	}
+	tok := tokens[0]
+	if tok.kind == tokenAny {
+		for skip := 0; skip <= len(chunks); skip++ {
+			if matchTemplate(tokens[1:], chunks[skip:], captures) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(chunks) == 0 {
+		return false
+	}
+	c := chunks[0]
+	switch tok.kind {
+	case tokenOpcode:
+		if c.Op != tok.op {
+			return false
+		}
+	default:
+		if c.Op > script.OpPUSHDATA4 || !tok.matchPush(c.Data) {
+			return false
+		}
+	}
+	if !matchTemplate(tokens[1:], chunks[1:], captures) {
+		return false
+	}
+	if tok.kind == tokenCapture && tok.name != "_" {
+		captures[tok.name] = c.Data
+	}
+	return true
+}
+
+// matchPushes matches tokens against the leading pushes of a data carrier.
+func matchPushes(tokens []templateToken, pushes [][]byte, captures map[string][]byte) bool {
+	if len(pushes) < len(tokens) {
+		return false
+	}
+	for i, tok := range tokens {
+		if !tok.matchPush(pushes[i]) {
+			return false
+		}
+	}
+	for i, tok := range tokens {
+		if tok.kind == tokenCapture && tok.name != "_" {
+			captures[tok.name] = pushes[i]
+		}
+	}
+	return true
+}
+
+func (t templateToken) matchPush(data []byte) bool {
+	if t.kind == tokenData {
+		return string(data) == string(t.data)
+	}
+	return t.size < 0 || len(data) == t.size
+}
+
+// render fills in a tag value's captures. A tag referring to an empty
+// capture renders empty and is skipped.
+func (t compiledTag) render(captures map[string][]byte, maxValueLen int) string {
+	if len(t.parts) == 1 {
+		return t.parts[0]
+	}
+	var b strings.Builder
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+			continue
+		}
+		v := captures[part]
+		if len(v) == 0 {
+			return ""
+		}
+		b.WriteString(tagValue(v, maxValueLen))
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package txindexer
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+const testRulesYAML = `
+maxValueLen: 48
+rules:
+  - name: p2pkh
+    template: OP_DUP OP_HASH160 <pkh:20> OP_EQUALVERIFY OP_CHECKSIG
+    tags:
+      - {key: pkh, value: "{pkh}"}
+  - name: ordinal lock
+    template: OP_FALSE OP_IF 0x6f7264 ... OP_ENDIF OP_DUP OP_HASH160 <_:20> OP_EQUALVERIFY OP_CHECKSIG
+    satoshis: {min: 1, max: 1}
+    tags:
+      - {key: type, value: ordinal}
+  - name: social
+    opReturn: [1PuQa7K62MiKCtssSLKy1kh56WWU7MtUR5, SET, app, <app>]
+    tags:
+      - {key: social.app, value: "{app}"}
+      - {key: social.post, value: "{app}/post"}
+  - name: dust
+    satoshis: {max: 545}
+    tags:
+      - {key: dust, value: "true"}
+`
+
+func writeRules(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+	return path
+}
+
+// ruleTx builds a transaction with a single input and the given outputs.
+func ruleTx(outputs ...*transaction.TransactionOutput) []byte {
+	tx := transaction.NewTransaction()
+	tx.AddInput(&transaction.TransactionInput{SourceTXID: &chainhash.Hash{}, SequenceNumber: 0xffffffff})
+	for _, out := range outputs {
+		tx.AddOutput(out)
+	}
+	return tx.Bytes()
+}
+
+func ruleOutput(t *testing.T, sats uint64, scriptHex string) *transaction.TransactionOutput {
+	t.Helper()
+	s, err := script.NewFromHex(scriptHex)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	return &transaction.TransactionOutput{Satoshis: sats, LockingScript: s}
+}
+
+func TestRuleIndexer(t *testing.T) {
+	config, err := LoadRulesConfig(writeRules(t, "rules.yaml", testRulesYAML))
+	if err != nil {
+		t.Fatalf("LoadRulesConfig: %v", err)
+	}
+	ix, err := NewRuleIndexer(config)
+	if err != nil {
+		t.Fatalf("NewRuleIndexer: %v", err)
+	}
+	const pkh = "62e907b15cbf27d5425399ebf6f0fb50ebb88f18"
+	p2pkh := "76a914" + pkh + "88ac"
+	envelope := "0063036f726451" + "0a746578742f706c61696e" + "00" + "0568656c6c6f" + "68"
+	social := "006a" + hex.EncodeToString([]byte{34}) + hex.EncodeToString([]byte(MAPPrefix)) +
+		"03534554" + "03617070" + "06747765746368" + "0474797065" + "04706f7374"
+
+	got := indexByTag(t, ix, ruleTx(
+		ruleOutput(t, 1000, p2pkh),
+		ruleOutput(t, 1, envelope+p2pkh),
+		ruleOutput(t, 1000, envelope+p2pkh),
+		ruleOutput(t, 0, social),
+	))
+	if r := got["pkh="+pkh]; r == nil || len(r.Vouts) != 1 || r.Vouts[0] != 0 {
+		t.Errorf("p2pkh capture: %+v", r)
+	}
+	if r := got["type=ordinal"]; r == nil || len(r.Vouts) != 1 || r.Vouts[0] != 1 {
+		t.Errorf("ordinal template: %+v", r)
+	}
+	if r := got["social.app=twetch"]; r == nil || r.Vouts[0] != 3 {
+		t.Errorf("opReturn capture: %+v", r)
+	}
+	if r := got["social.post=twetch/post"]; r == nil || r.Vouts[0] != 3 {
+		t.Errorf("interpolated value: %+v", r)
+	}
+	if r := got["dust=true"]; r == nil || len(r.Vouts) != 2 || r.Vouts[0] != 1 || r.Vouts[1] != 3 {
+		t.Errorf("satoshi predicate: %+v", r)
+	}
+	if len(got) != 5 {
+		t.Errorf("expected 5 tags, got %v", got)
+	}
+
+	// Captures longer than maxValueLen are hashed
+	long := "006a" + hex.EncodeToString([]byte{34}) + hex.EncodeToString([]byte(MAPPrefix)) +
+		"03534554" + "03617070" + "3c" + strings.Repeat("61", 60)
+	got = indexByTag(t, ix, ruleTx(ruleOutput(t, 1000, long)))
+	if r := got["social.app="+tagValue([]byte(strings.Repeat("a", 60)), 48)]; r == nil {
+		t.Errorf("long capture: %v", got)
+	}
+}
+
+func TestLoadRulesConfigJSON(t *testing.T) {
+	path := writeRules(t, "rules.json", `{"rules": [
+		{"name": "run", "opReturn": ["run", "<version>"], "tags": [{"key": "run.version", "value": "{version}"}]}
+	]}`)
+	config, err := LoadRulesConfig(path)
+	if err != nil {
+		t.Fatalf("LoadRulesConfig: %v", err)
+	}
+	if config.MaxValueLen != DefaultRulesConfig().MaxValueLen {
+		t.Errorf("maxValueLen: got %d", config.MaxValueLen)
+	}
+	ix, err := NewRuleIndexer(config)
+	if err != nil {
+		t.Fatalf("NewRuleIndexer: %v", err)
+	}
+	got := indexByTag(t, ix, ruleTx(ruleOutput(t, 0, "006a"+"0372756e"+"0105")))
+	if r := got["run.version=05"]; r == nil {
+		t.Errorf("json rule: %v", got)
+	}
+}
+
+func TestRuleIndexerRejectsBadRules(t *testing.T) {
+	tags := []RuleTag{{Key: "k", Value: "v"}}
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"no matchers", Rule{Tags: tags}},
+		{"no tags", Rule{Template: "OP_RETURN ..."}},
+		{"unknown opcode", Rule{Template: "OP_NOPE", Tags: tags}},
+		{"bad hex", Rule{Template: "0xzz", Tags: tags}},
+		{"unknown capture", Rule{Template: "<a>", Tags: []RuleTag{{Key: "k", Value: "{b}"}}}},
+		{"discarded capture", Rule{Template: "<_>", Tags: []RuleTag{{Key: "k", Value: "{_}"}}}},
+		{"empty key", Rule{Template: "<a>", Tags: []RuleTag{{Value: "{a}"}}}},
+		{"two wildcards", Rule{Template: "... <a> ... OP_RETURN", Tags: tags}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRuleIndexer(RulesConfig{Rules: []Rule{tt.rule}}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package txindexer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// ScriptHashConfig controls which script hashes are indexed.
+type ScriptHashConfig struct {
+	// Templates also tags each output with "scripthash.template", the hash of
+	// its locking script with every push masked, which is shared by all
+	// instances of a contract. Common templates such as P2PKH match most
+	// transactions, so it is off by default.
+	Templates bool
+}
+
+// DefaultScriptHashConfig indexes script hashes without templates.
+func DefaultScriptHashConfig() ScriptHashConfig {
+	return ScriptHashConfig{}
+}
+
+// ScriptHashIndexer tags every output with "scripthash", the Electrum-style
+// script hash of its locking script: the SHA-256 in reversed byte order, as
+// hex. Unlike addresses it covers any script, standard or not.
+type ScriptHashIndexer struct {
+	config ScriptHashConfig
+}
+
+func NewScriptHashIndexer(config ScriptHashConfig) *ScriptHashIndexer {
+	return &ScriptHashIndexer{config: config}
+}
+
+func (s *ScriptHashIndexer) Name() string { return "ScriptHash" }
+
+func (s *ScriptHashIndexer) DigestKeys() []string {
+	return []string{"scripthash", "scripthash.template"}
+}
+
+func (s *ScriptHashIndexer) Index(_ context.Context, txCtx *TransactionContext) ([]*IndexResult, error) {
+	tx, err := transaction.NewTransactionFromBytes(txCtx.RawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags tagSet
+	for i, output := range tx.Outputs {
+		if output.LockingScript == nil || len(*output.LockingScript) == 0 {
+			continue
+		}
+		tags.add("scripthash", scriptHash(*output.LockingScript), uint32(i))
+		if !s.config.Templates {
+			continue
+		}
+		if template, ok := scriptTemplate(*output.LockingScript); ok {
+			tags.add("scripthash.template", scriptHash(template), uint32(i))
+		}
+	}
+	return tags.results, nil
+}
+
+// scriptHash returns the SHA-256 of a script in reversed byte order, as hex.
+func scriptHash(s []byte) string {
+	sum := sha256.Sum256(s)
+	slices.Reverse(sum[:])
+	return hex.EncodeToString(sum[:])
+}
+
+// scriptTemplate masks every push in a script with OP_0, keeping its other
+// opcodes. Everything after an OP_RETURN outside any IF, such as a stateful
+// contract's state, is dropped.
+func scriptTemplate(s script.Script) ([]byte, bool) {
+	chunks, err := script.DecodeScript(s)
+	if err != nil {
+		return nil, false
+	}
+	template := make([]byte, len(chunks))
+	for i, c := range chunks {
+		if c.Op <= script.OpPUSHDATA4 {
+			template[i] = script.Op0
+		} else {
+			template[i] = c.Op
+		}
+	}
+	return template, true
+}
@@ -0,0 +1,56 @@
+package txindexer
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+)
+
+func TestScriptHashElectrum(t *testing.T) {
+	// The example from the Electrum protocol docs
+	p2pkhScript, _ := hex.DecodeString("76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
+	// 1-of-1 bare multisig
+	bare, _ := hex.DecodeString("5121" + "02" + strings.Repeat("11", 32) + "51ae")
+
+	rawTx := buildTestP2PKHTx(t, p2pkhScript, bare, p2pkhScript)
+	got := indexByTag(t, NewScriptHashIndexer(DefaultScriptHashConfig()), rawTx)
+	if r := got["scripthash=8b01df4e368ea28f8dc0423bcf7a4923e3a12d307c875e47a0cfbf90b5c39161"]; r == nil || len(r.Vouts) != 2 || r.Vouts[1] != 2 {
+		t.Errorf("p2pkh script hash: %+v", r)
+	}
+	if r := got["scripthash="+scriptHash(bare)]; r == nil || r.Vouts[0] != 1 {
+		t.Errorf("bare multisig script hash: %+v", r)
+	}
+	if len(got) != 2 {
+		t.Errorf("expected 2 tags without templates, got %v", got)
+	}
+}
+
+func TestScriptHashTemplates(t *testing.T) {
+	p2pkh1, _ := hex.DecodeString("76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
+	p2pkh2, _ := hex.DecodeString("76a914000000000000000000000000000000000000000088ac")
+	contract := func(owner string, state ...string) []byte {
+		s := &script.Script{}
+		s.AppendPushData([]byte(owner))
+		s.AppendOpcodes(script.OpCHECKSIGVERIFY, script.OpRETURN)
+		for _, st := range state {
+			s.AppendPushData([]byte(st))
+		}
+		return *s
+	}
+
+	rawTx := buildTestP2PKHTx(t, p2pkh1, p2pkh2, contract("alice", "1"), contract("bob", "2", "3"))
+	got := indexByTag(t, NewScriptHashIndexer(ScriptHashConfig{Templates: true}), rawTx)
+	p2pkhTemplate := scriptHash([]byte{script.OpDUP, script.OpHASH160, script.Op0, script.OpEQUALVERIFY, script.OpCHECKSIG})
+	if r := got["scripthash.template="+p2pkhTemplate]; r == nil || len(r.Vouts) != 2 || r.Vouts[1] != 1 {
+		t.Errorf("p2pkh template: %+v", r)
+	}
+	contractTemplate := scriptHash([]byte{script.Op0, script.OpCHECKSIGVERIFY, script.OpRETURN})
+	if r := got["scripthash.template="+contractTemplate]; r == nil || len(r.Vouts) != 2 || r.Vouts[0] != 2 {
+		t.Errorf("contract template: %+v", r)
+	}
+	if len(got) != 6 {
+		t.Errorf("expected 4 script hashes and 2 templates, got %v", got)
+	}
+}
@@ -0,0 +1,74 @@
+package txindexer
+
+import (
+	"context"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// SpendAddressIndexer tags the inputs of a transaction that spend P2PKH
+// outputs with the spender's "spend.address", derived from the public key in
+// the unlocking script, so spends can be found without looking up the
+// outputs they consume.
+type SpendAddressIndexer struct{}
+
+func NewSpendAddressIndexer() *SpendAddressIndexer { return &SpendAddressIndexer{} }
+
+func (s *SpendAddressIndexer) Name() string { return "SpendAddress" }
+
+func (s *SpendAddressIndexer) Index(_ context.Context, txCtx *TransactionContext) ([]*IndexResult, error) {
+	tx, err := transaction.NewTransactionFromBytes(txCtx.RawTx)
+	if err != nil {
+		return nil, err
+	}
+	if tx.IsCoinbase() {
+		return nil, nil
+	}
+
+	var results []*IndexResult
+	byAddr := make(map[string]*IndexResult)
+	for i, input := range tx.Inputs {
+		if input.UnlockingScript == nil {
+			continue
+		}
+		addr, ok := p2pkhSpender(*input.UnlockingScript)
+		if !ok {
+			continue
+		}
+		r, ok := byAddr[addr]
+		if !ok {
+			r = &IndexResult{Key: "spend.address", Value: addr}
+			byAddr[addr] = r
+			results = append(results, r)
+		}
+		r.Vins = append(r.Vins, uint32(i))
+	}
+	return results, nil
+}
+
+// p2pkhSpender returns the address of the public key in a P2PKH unlocking
+// script, <signature> <public key>.
+func p2pkhSpender(s script.Script) (string, bool) {
+	chunks, err := script.DecodeScript(s)
+	if err != nil || len(chunks) != 2 || chunks[0].Op > script.OpPUSHDATA4 || chunks[1].Op > script.OpPUSHDATA4 {
+		return "", false
+	}
+	if sig := chunks[0].Data; len(sig) < 9 || len(sig) > 73 || sig[0] != 0x30 {
+		return "", false
+	}
+	pubKey := chunks[1].Data
+	if len(pubKey) != 33 && len(pubKey) != 65 {
+		return "", false
+	}
+	key, err := ec.ParsePubKey(pubKey)
+	if err != nil {
+		return "", false
+	}
+	addr, err := script.NewAddressFromPublicKeyWithCompression(key, true, len(pubKey) == 33)
+	if err != nil {
+		return "", false
+	}
+	return addr.AddressString, true
+}
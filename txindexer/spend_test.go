@@ -0,0 +1,71 @@
+package txindexer
+
+import (
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// noVouts reports any spend tag that also names outputs.
+func noVouts(t *testing.T, got map[string]*IndexResult) {
+	t.Helper()
+	for tag, r := range got {
+		if len(r.Vouts) != 0 {
+			t.Errorf("%s tagged outputs %v", tag, r.Vouts)
+		}
+	}
+}
+
+func TestSpendAddressMainnetTx(t *testing.T) {
+	// Input 0 unlocks a three-push ordinal lock; input 1 is a plain P2PKH spend
+	got := indexByTag(t, NewSpendAddressIndexer(), loadTx(t, "437407e10a85c7b707a347a140e82a2c35e36d082253d21855d0d0825bbe5d8c"))
+	noVouts(t, got)
+	if r := got["spend.address=1BFaJwJz5KPYGe28afDkGswbuKK6uK8hzQ"]; r == nil || len(r.Vins) != 1 || r.Vins[0] != 1 {
+		t.Errorf("spend.address: %+v", r)
+	}
+	if len(got) != 1 {
+		t.Errorf("expected 1 tag, got %v", got)
+	}
+}
+
+func TestSpendAddressKeyFormats(t *testing.T) {
+	key, _ := ec.NewPrivateKey()
+	sig := append([]byte{0x30, 0x44}, make([]byte, 0x44+1)...)
+	unlock := func(pubKey []byte) *script.Script {
+		s := &script.Script{}
+		s.AppendPushData(sig)
+		s.AppendPushData(pubKey)
+		return s
+	}
+
+	tx := transaction.NewTransaction()
+	for _, s := range []*script.Script{
+		unlock(key.PubKey().Compressed()),
+		unlock(key.PubKey().Uncompressed()),
+		unlock(make([]byte, 33)), // not a point
+		unlock(key.PubKey().Compressed()),
+	} {
+		tx.AddInput(&transaction.TransactionInput{
+			SourceTXID:      &chainhash.Hash{1},
+			UnlockingScript: s,
+			SequenceNumber:  0xffffffff,
+		})
+	}
+
+	compressed, _ := script.NewAddressFromPublicKeyWithCompression(key.PubKey(), true, true)
+	uncompressed, _ := script.NewAddressFromPublicKeyWithCompression(key.PubKey(), true, false)
+	got := indexByTag(t, NewSpendAddressIndexer(), tx.Bytes())
+	noVouts(t, got)
+	if r := got["spend.address="+compressed.AddressString]; r == nil || len(r.Vins) != 2 || r.Vins[0] != 0 || r.Vins[1] != 3 {
+		t.Errorf("compressed key: %+v", r)
+	}
+	if r := got["spend.address="+uncompressed.AddressString]; r == nil || len(r.Vins) != 1 || r.Vins[0] != 1 {
+		t.Errorf("uncompressed key: %+v", r)
+	}
+	if len(got) != 2 {
+		t.Errorf("expected 2 tags, got %v", got)
+	}
+}